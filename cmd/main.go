@@ -6,8 +6,15 @@ import (
 	_ "image/png"
 	"log"
 	"os"
+	"strings"
 
+	"myebiten/internal/controls"
+	"myebiten/internal/discovery"
 	"myebiten/internal/game"
+	"myebiten/internal/host"
+	"myebiten/internal/interpolation"
+	"myebiten/internal/models"
+	"myebiten/internal/netcond"
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/examples/resources/fonts"
@@ -18,21 +25,69 @@ import (
 var (
 	DEBUG_MODE = flag.Bool("debug", true, "true / false")
 
-	CONNECTION_MODE  = flag.String("mode", "offline", "offline / server / client")
+	CONNECTION_MODE  = flag.String("mode", "offline", "offline / server / client / dedicated / replay")
 	SERVER_MODE_PORT = flag.String("server_mode_port", "8080", "IF TRUE THEN GAME IS IN HOST MODE AND WAITING FOR CONNECTION OF OTHER PLAYER")
 
 	ADDRESS       = flag.String("address", "localhost:8080", "IF SET THEN GAME TRYING TO CONNECT TO HOST")
 	PLAYERS_COUNT = flag.Int("players_count", game.DEFAULT_PLAYERS_COUNT, "SERVER/OFFLINE PLAYERS COUNT FROM 2 TO 10")
-	PLAYER_ID     = flag.Int("player_id", 1, "CLIENT PLAYER ID FROM 1 TO SERVER players_count-1")
+	PLAYER_ID     = flag.Int("player_id", 1, "CLIENT PLAYER ID FROM 1 (0 ON A DEDICATED SERVER) TO SERVER players_count-1")
+	LOCAL_PLAYERS = flag.Int("local_players", 1, fmt.Sprintf("SERVER/CLIENT PLAYERS AT THIS KEYBOARD FROM 1 TO %d, EACH WITH ITS OWN KEYS. THE SERVER SEATS THEM FROM SLOT 0, A CLIENT FROM player_id ON", game.MAX_LOCAL_PLAYERS))
+	SEED          = flag.Int64("seed", 0, "SERVER/OFFLINE SEED OF THE FIRST ROUND, 0 PICKS A RANDOM ONE. EVERY ROUND SEED IS LOGGED")
+
+	TICK_RATE     = flag.Int("tick_rate", models.DEFAULT_TICK_RATE, fmt.Sprintf("SERVER/DEDICATED/OFFLINE SIMULATION TICKS PER SECOND FROM %d TO %d, CLIENTS TAKE THE RATE OF THE SERVER", models.MIN_TICK_RATE, models.MAX_TICK_RATE))
+	SNAPSHOT_RATE = flag.Int("snapshot_rate", host.DEFAULT_SNAPSHOT_RATE, "SERVER/DEDICATED SNAPSHOTS SENT TO EVERY CLIENT PER SECOND, AT MOST tick_rate")
+	RECORD        = flag.String("record", "", "SERVER/DEDICATED/OFFLINE RECORDS THE MATCH TO THIS REPLAY FILE")
+	FILE          = flag.String("file", "", "REPLAY FILE PLAYED IN REPLAY MODE")
+	BINDINGS      = flag.String("bindings", "", "KEY BINDINGS FILE OF THE PLAYERS AT THIS KEYBOARD, tanks/bindings.json IN THE USER CONFIG DIR BY DEFAULT. F2 REBINDS KEYS IN A MATCH AND SAVES THEM THERE")
+
+	PASSWORD = flag.String("password", "", "SERVER/DEDICATED: CLIENTS NEED IT TO TAKE A SLOT. CLIENT: THE PASSWORD OF THE SERVER")
+	TOKEN    = flag.String("token", "", "CLIENT SESSION TOKENS OF SLOTS TAKEN EARLIER, LOGGED WHEN JOINING, COMMA SEPARATED FOR local_players. NEEDED TO GET THE SLOTS BACK AFTER A RESTART")
+
+	SERVER_NAME    = flag.String("server_name", defaultServerName(), "SERVER/DEDICATED NAME SHOWN IN THE SERVER BROWSER")
+	DISCOVERY_PORT = flag.Int("discovery_port", discovery.DEFAULT_PORT, "UDP PORT SERVERS ANNOUNCE THEMSELVES ON AND THE SERVER BROWSER LISTENS ON")
+	SPECTATE       = flag.Bool("spectate", false, "CLIENT WATCHES THE MATCH WITHOUT TAKING A SLOT, player_id IS IGNORED")
+	BROWSE         = flag.Bool("browse", false, "CLIENT PICKS A SERVER ON THE LOCAL NETWORK INSTEAD OF CONNECTING TO address")
+
+	MIN_PLAYERS = flag.Int("min_players", 2, "DEDICATED SERVER STARTS THE MATCH ONCE THIS MANY PLAYERS ARE CONNECTED, FROM 2 TO players_count")
+	BOTS        = flag.Bool("bots", false, "DEDICATED SERVER GIVES SLOTS NOBODY TOOK WHEN THE MATCH STARTS TO BOTS")
+
+	NET_DELAY     = flag.Duration("net_delay", 0, "SIMULATED BAD NETWORK: DELAY ADDED TO EVERY MESSAGE SENT AND RECEIVED")
+	NET_JITTER    = flag.Duration("net_jitter", 0, "SIMULATED BAD NETWORK: RANDOM DELAY WITHIN ±net_jitter ON TOP OF net_delay")
+	NET_LOSS      = flag.Float64("net_loss", 0, "SIMULATED BAD NETWORK: CHANCE FROM 0 TO 1 THAT A SNAPSHOT OR INPUT IS LOST")
+	NET_REORDER   = flag.Float64("net_reorder", 0, "SIMULATED BAD NETWORK: CHANCE FROM 0 TO 1 THAT A SNAPSHOT OR INPUT IS OVERTAKEN BY THE NEXT ONES")
+	NET_BANDWIDTH = flag.Int("net_bandwidth", 0, "SIMULATED BAD NETWORK: BYTES PER SECOND EACH DIRECTION OF A CONNECTION CARRIES, 0 IS UNLIMITED")
+
+	INTERPOLATION_DELAY = flag.Duration("interpolation_delay", interpolation.DEFAULT_DELAY, "CLIENT SHOWS OTHER PLAYERS AND BULLETS THIS MUCH IN THE PAST TO MOVE THEM SMOOTHLY")
+	EXTRAPOLATION_LIMIT = flag.Duration("extrapolation_limit", interpolation.DEFAULT_EXTRAPOLATION_LIMIT, "CLIENT GUESSES MOVEMENT AT MOST THIS FAR PAST THE NEWEST SERVER SNAPSHOT")
 )
 
 func main() {
 	flag.Parse()
 
-	ebiten.SetTPS(300)
+	if *CONNECTION_MODE == game.CONNECTION_MODE_DEDICATED {
+		// no window and no GPU, logs stay on stderr where containers collect them
+		log.SetFlags(log.LstdFlags | log.Lshortfile)
+		host.RunDedicated(host.DedicatedConfig{
+			Name:          *SERVER_NAME,
+			Port:          *SERVER_MODE_PORT,
+			DiscoveryPort: *DISCOVERY_PORT,
+			PlayersCount:  game.NormalizePlayersCount(*PLAYERS_COUNT),
+			Seed:          *SEED,
+			TickRate:      models.NormalizeTickRate(*TICK_RATE),
+			SnapshotRate:  *SNAPSHOT_RATE,
+			Password:      *PASSWORD,
+			NetConditions: netConditions(),
+			MinPlayers:    *MIN_PLAYERS,
+			FillWithBots:  *BOTS,
+			RecordPath:    *RECORD,
+		})
+		return
+	}
+
+	// the world is stepped at its own tick rate, Update runs once per frame so rendering follows the display
+	ebiten.SetTPS(ebiten.SyncWithFPS)
 	if *CONNECTION_MODE == game.CONNECTION_MODE_CLIENT {
 		fmt.Println("Running in client mode")
-		ebiten.SetTPS(400)
 	}
 
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
@@ -71,8 +126,84 @@ func main() {
 	}
 	ebiten.SetFullscreen(false)
 
-	tanksGame := game.CreateGame(*CONNECTION_MODE, *SERVER_MODE_PORT, *ADDRESS, *PLAYERS_COUNT, *PLAYER_ID)
-	if err := ebiten.RunGame(tanksGame); err != nil {
+	bindingsPath, bindings := loadBindings()
+	tanksGame := game.CreateGame(game.Config{
+		ConnectionMode:     *CONNECTION_MODE,
+		ServerPort:         *SERVER_MODE_PORT,
+		Address:            *ADDRESS,
+		PlayersCount:       *PLAYERS_COUNT,
+		PlayerID:           *PLAYER_ID,
+		LocalPlayers:       *LOCAL_PLAYERS,
+		Seed:               *SEED,
+		TickRate:           models.NormalizeTickRate(*TICK_RATE),
+		SnapshotRate:       *SNAPSHOT_RATE,
+		RecordPath:         *RECORD,
+		ReplayPath:         *FILE,
+		Bindings:           bindings,
+		BindingsPath:       bindingsPath,
+		Password:           *PASSWORD,
+		Tokens:             tokens(*TOKEN),
+		InterpolationDelay: *INTERPOLATION_DELAY,
+		ExtrapolationLimit: *EXTRAPOLATION_LIMIT,
+		ServerName:         *SERVER_NAME,
+		DiscoveryPort:      *DISCOVERY_PORT,
+		Browse:             *BROWSE,
+		Spectate:           *SPECTATE,
+		NetConditions:      netConditions(),
+	})
+	err = ebiten.RunGame(tanksGame)
+	tanksGame.Close()
+	if err != nil {
 		log.Fatal(err)
 	}
 }
+
+func netConditions() netcond.Config {
+	return netcond.Config{
+		Delay:     *NET_DELAY,
+		Jitter:    *NET_JITTER,
+		Loss:      *NET_LOSS,
+		Reorder:   *NET_REORDER,
+		Bandwidth: *NET_BANDWIDTH,
+	}
+}
+
+// loadBindings reads the key bindings file, a bad file is logged with every bad entry and the default keys are used.
+// Without a user config dir the path is empty and rebound keys aren't saved.
+func loadBindings() (string, controls.Bindings) {
+	path := *BINDINGS
+	if path == "" {
+		var err error
+		if path, err = controls.DefaultBindingsPath(); err != nil {
+			log.Println(err, "- key changes won't be saved")
+			return "", controls.DefaultBindings()
+		}
+	}
+
+	bindings, err := controls.LoadBindings(path)
+	if err != nil {
+		log.Println(err)
+		log.Println("playing with the default keys")
+		return path, controls.DefaultBindings()
+	}
+
+	return path, bindings
+}
+
+// tokens splits the -token flag, the token of the first local player comes first.
+func tokens(flagValue string) []string {
+	if flagValue == "" {
+		return nil
+	}
+
+	return strings.Split(flagValue, ",")
+}
+
+func defaultServerName() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "tanks"
+	}
+
+	return name
+}
@@ -0,0 +1,108 @@
+package bot
+
+import (
+	"math"
+
+	"myebiten/internal/models"
+	"myebiten/internal/models/character"
+	"myebiten/internal/sim"
+)
+
+const (
+	// the bot turns until the enemy is within this angle and shoots when it is within twice of it
+	AIM_TOLERANCE  = 0.05
+	SHOOT_DISTANCE = 600.0
+	// the bot stops driving towards an enemy closer than this
+	KEEP_DISTANCE = 250.0
+
+	// a bot that drives but moves slower than STUCK_SPEED pixels per second for STUCK_TIME seconds
+	// hit a wall and backs off for BACK_OFF_TIME seconds
+	STUCK_SPEED   = 30.0
+	STUCK_TIME    = 1.0 / 3
+	BACK_OFF_TIME = 0.5
+)
+
+// Bot plays the character of a slot nobody took. It decides only from the world,
+// so matches with bots stay deterministic for a given seed.
+type Bot struct {
+	ID int
+
+	lastPosition models.Vector2D
+	driving      bool
+	stuckTicks   int
+	backOffTicks int
+}
+
+func New(id int) *Bot {
+	return &Bot{ID: id}
+}
+
+// Input is what the bot presses this tick.
+func (bot *Bot) Input(world *sim.World) models.Input {
+	var input models.Input
+	if bot.ID < 0 || bot.ID >= len(world.Characters) || world.State() != sim.STATE_GAME_RUNNING {
+		return input
+	}
+
+	char := world.Characters[bot.ID]
+	if !char.IsActive() {
+		return input
+	}
+
+	if bot.backOffTicks > 0 {
+		bot.backOffTicks--
+		input.MoveBackward = true
+		input.RotateLeft = true
+		return input
+	}
+
+	stuckDistance := models.PerTick(STUCK_SPEED, world.TickRate)
+	if bot.driving && models.SquareDistance(char.Position, bot.lastPosition) < stuckDistance*stuckDistance {
+		bot.stuckTicks++
+	} else {
+		bot.stuckTicks = 0
+	}
+	bot.lastPosition = char.Position
+
+	if bot.stuckTicks >= models.Ticks(STUCK_TIME, world.TickRate) {
+		bot.stuckTicks = 0
+		bot.backOffTicks = models.Ticks(BACK_OFF_TIME, world.TickRate)
+	}
+
+	target := nearestEnemy(world, char)
+	if target == nil {
+		input.MoveForward = true
+		bot.driving = true
+		return input
+	}
+
+	dx := target.Position.X - char.Position.X
+	dy := target.Position.Y - char.Position.Y
+	turn := math.Remainder(math.Atan2(dy, dx)-char.Rotation, 2*math.Pi)
+	distance := math.Hypot(dx, dy)
+
+	input.RotateRight = turn > AIM_TOLERANCE
+	input.RotateLeft = turn < -AIM_TOLERANCE
+	input.MoveForward = distance > KEEP_DISTANCE
+	input.Shoot = math.Abs(turn) < 2*AIM_TOLERANCE && distance < SHOOT_DISTANCE
+	bot.driving = input.MoveForward
+
+	return input
+}
+
+func nearestEnemy(world *sim.World, char *character.Character) *character.Character {
+	var nearest *character.Character
+	nearestDistance := math.Inf(1)
+	for _, other := range world.Characters {
+		if other == char || !other.IsActive() {
+			continue
+		}
+
+		if distance := models.SquareDistance(char.Position, other.Position); distance < nearestDistance {
+			nearest = other
+			nearestDistance = distance
+		}
+	}
+
+	return nearest
+}
@@ -0,0 +1,233 @@
+package controls
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+const (
+	BINDINGS_DIR  = "tanks"
+	BINDINGS_FILE = "bindings.json"
+)
+
+// ACTIONS name the keys of a layout in the bindings file, in the order the rebind screen shows them.
+var ACTIONS = []string{"rotate_right", "rotate_left", "move_forward", "move_backward", "shoot"}
+
+// RESERVED_KEYS open the chat, the stats and the rebind screen, no layout may take them.
+var RESERVED_KEYS = []ebiten.Key{ebiten.KeyEnter, ebiten.KeyEscape, ebiten.KeyF2, ebiten.KeyF3}
+
+// Bindings are the keyboard layouts of the players at one machine, player i plays on Bindings[i].
+type Bindings []ControlSettings
+
+// DefaultBindings are the layouts used when the bindings file doesn't say otherwise.
+func DefaultBindings() Bindings {
+	return Bindings{
+		{
+			RotateRightButton:  ebiten.KeyD,
+			RotateLeftButton:   ebiten.KeyA,
+			MoveForwardButton:  ebiten.KeyW,
+			MoveBackwardButton: ebiten.KeyS,
+			ShootButton:        ebiten.KeySpace,
+		},
+		{
+			RotateRightButton:  ebiten.KeyArrowRight,
+			RotateLeftButton:   ebiten.KeyArrowLeft,
+			MoveForwardButton:  ebiten.KeyArrowUp,
+			MoveBackwardButton: ebiten.KeyArrowDown,
+			ShootButton:        ebiten.KeySlash,
+		},
+		{
+			RotateRightButton:  ebiten.KeyL,
+			RotateLeftButton:   ebiten.KeyJ,
+			MoveForwardButton:  ebiten.KeyI,
+			MoveBackwardButton: ebiten.KeyK,
+			ShootButton:        ebiten.KeyO,
+		},
+		{
+			RotateRightButton:  ebiten.KeyNumpad6,
+			RotateLeftButton:   ebiten.KeyNumpad4,
+			MoveForwardButton:  ebiten.KeyNumpad8,
+			MoveBackwardButton: ebiten.KeyNumpad5,
+			ShootButton:        ebiten.KeyNumpad0,
+		},
+	}
+}
+
+// ForPlayer returns the layout of player, players past the last layout share the layouts from the first one.
+func (bindings Bindings) ForPlayer(player int) ControlSettings {
+	return bindings[player%len(bindings)]
+}
+
+// Key returns the key of the action with index action in ACTIONS.
+func (cs *ControlSettings) Key(action int) ebiten.Key {
+	return *cs.keys()[action]
+}
+
+// SetKey binds the action with index action in ACTIONS to key.
+func (cs *ControlSettings) SetKey(action int, key ebiten.Key) {
+	*cs.keys()[action] = key
+}
+
+func (cs *ControlSettings) keys() []*ebiten.Key {
+	return []*ebiten.Key{&cs.RotateRightButton, &cs.RotateLeftButton, &cs.MoveForwardButton, &cs.MoveBackwardButton, &cs.ShootButton}
+}
+
+// Owner returns the player and action key is bound to, ok is false when it is free.
+// The action of skipPlayer with index skipAction doesn't count.
+func (bindings Bindings) Owner(key ebiten.Key, skipPlayer, skipAction int) (player, action int, ok bool) {
+	for player := range bindings {
+		for action := range ACTIONS {
+			if (player != skipPlayer || action != skipAction) && bindings[player].Key(action) == key {
+				return player, action, true
+			}
+		}
+	}
+
+	return 0, 0, false
+}
+
+// CheckKey tells why key can't be bound to the action of player, nil when it can.
+func (bindings Bindings) CheckKey(player, action int, key ebiten.Key) error {
+	for _, reserved := range RESERVED_KEYS {
+		if key == reserved {
+			return fmt.Errorf("%s is reserved", key)
+		}
+	}
+	if owner, ownerAction, ok := bindings.Owner(key, player, action); ok {
+		return fmt.Errorf("%s is already %s of player %d", key, ACTIONS[ownerAction], owner)
+	}
+
+	return nil
+}
+
+// Validate lists every reserved key and every key bound twice.
+func (bindings Bindings) Validate() error {
+	var errs []error
+	for player := range bindings {
+		for action, name := range ACTIONS {
+			key := bindings[player].Key(action)
+			// a key bound twice is reported once, by the action bound later
+			if owner, ownerAction, ok := bindings.Owner(key, player, action); ok && (owner > player || owner == player && ownerAction > action) {
+				continue
+			}
+			if err := bindings.CheckKey(player, action, key); err != nil {
+				errs = append(errs, fmt.Errorf("player %d %s: %w", player, name, err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// DefaultBindingsPath is the bindings file in the config dir of the user.
+func DefaultBindingsPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, BINDINGS_DIR, BINDINGS_FILE), nil
+}
+
+// LoadBindings reads the bindings file at path, without one the default bindings are used.
+// A bad file gives an error naming every bad entry.
+func LoadBindings(path string) (Bindings, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return DefaultBindings(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	bindings, err := ParseBindings(data)
+	if err != nil {
+		return nil, fmt.Errorf("bad bindings file %s:\n%w", path, err)
+	}
+
+	return bindings, nil
+}
+
+// ParseBindings reads the layouts of the bindings file, a list of layouts mapping the ACTIONS to key names
+// like "W", "ArrowUp" or "Numpad8". Players the file has no layout for keep their default one.
+func ParseBindings(data []byte) (Bindings, error) {
+	var layouts []map[string]string
+	if err := json.Unmarshal(data, &layouts); err != nil {
+		return nil, err
+	}
+
+	bindings := DefaultBindings()
+	if len(layouts) > len(bindings) {
+		return nil, fmt.Errorf("%d layouts, at most %d players play at one machine", len(layouts), len(bindings))
+	}
+
+	var errs []error
+	for player, layout := range layouts {
+		for name := range layout {
+			if actionIndex(name) < 0 {
+				errs = append(errs, fmt.Errorf("player %d: unknown action %q, the actions are %s", player, name, strings.Join(ACTIONS, ", ")))
+			}
+		}
+
+		for action, name := range ACTIONS {
+			keyName, ok := layout[name]
+			if !ok {
+				errs = append(errs, fmt.Errorf("player %d: no key for %s", player, name))
+				continue
+			}
+
+			var key ebiten.Key
+			if err := key.UnmarshalText([]byte(keyName)); err != nil {
+				errs = append(errs, fmt.Errorf("player %d %s: unknown key %q", player, name, keyName))
+				continue
+			}
+			bindings[player].SetKey(action, key)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	if err := bindings.Validate(); err != nil {
+		return nil, err
+	}
+
+	return bindings, nil
+}
+
+// SaveBindings writes bindings to the bindings file at path, creating its directory.
+func SaveBindings(path string, bindings Bindings) error {
+	layouts := make([]map[string]string, len(bindings))
+	for player := range bindings {
+		layouts[player] = make(map[string]string, len(ACTIONS))
+		for action, name := range ACTIONS {
+			layouts[player][name] = bindings[player].Key(action).String()
+		}
+	}
+
+	data, err := json.MarshalIndent(layouts, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+func actionIndex(name string) int {
+	for action, actionName := range ACTIONS {
+		if actionName == name {
+			return action
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,121 @@
+package controls
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// layout writes a layout of the bindings file binding ACTIONS in order to keys.
+func layout(keys ...string) string {
+	entries := make([]string, len(keys))
+	for action, key := range keys {
+		entries[action] = fmt.Sprintf("%q: %q", ACTIONS[action], key)
+	}
+
+	return "{" + strings.Join(entries, ", ") + "}"
+}
+
+func TestParseBindings(t *testing.T) {
+	bindings, err := ParseBindings([]byte("[" + layout("H", "F", "T", "G", "E") + "]"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key := bindings[0].Key(0); key != ebiten.KeyH {
+		t.Fatalf("player 0 rotates right with %s, want H", key)
+	}
+	// players the file leaves out keep their default layout
+	if len(bindings) != len(DefaultBindings()) || bindings[1] != DefaultBindings()[1] {
+		t.Fatalf("got layouts %v, want the defaults after the first", bindings)
+	}
+}
+
+func TestParseBindingsErrors(t *testing.T) {
+	wasd := layout("D", "A", "W", "S", "Space")
+	arrows := layout("ArrowRight", "ArrowLeft", "ArrowUp", "ArrowDown", "Slash")
+	ijkl := layout("L", "J", "I", "K", "O")
+	numpad := layout("Numpad6", "Numpad4", "Numpad8", "Numpad5", "Numpad0")
+
+	cases := []struct {
+		name string
+		file string
+		// every error expected, each must be reported exactly once
+		want []string
+	}{
+		{"unknown action", `[{"rotate_right": "D", "rotate_left": "A", "move_forward": "W", "move_backward": "S", "shoot": "Space", "jump": "E"}]`,
+			[]string{`player 0: unknown action "jump"`}},
+		{"unknown key", "[" + layout("D", "A", "W", "S", "Spacebar") + "]",
+			[]string{`player 0 shoot: unknown key "Spacebar"`}},
+		{"missing action", `[{"rotate_right": "D", "rotate_left": "A", "move_forward": "W", "move_backward": "S"}]`,
+			[]string{"player 0: no key for shoot"}},
+		{"too many layouts", "[" + strings.Join([]string{wasd, arrows, ijkl, numpad, wasd}, ", ") + "]",
+			[]string{"5 layouts, at most 4 players"}},
+		{"reserved key", "[" + layout("D", "A", "W", "S", "Enter") + "]",
+			[]string{"player 0 shoot: Enter is reserved"}},
+		{"key of two players", "[" + wasd + ", " + layout("ArrowRight", "ArrowLeft", "ArrowUp", "ArrowDown", "Space") + "]",
+			[]string{"player 1 shoot: Space is already shoot of player 0"}},
+		{"keys of a player left out", "[" + layout("L", "J", "I", "K", "Space") + "]",
+			[]string{
+				"player 2 rotate_right: L is already rotate_right of player 0",
+				"player 2 rotate_left: J is already rotate_left of player 0",
+				"player 2 move_forward: I is already move_forward of player 0",
+				"player 2 move_backward: K is already move_backward of player 0",
+			}},
+		{"several bad entries", "[" + layout("D", "A", "W", "S", "Spacebar") + `, {"rotate_right": "ArrowRight"}]`,
+			[]string{
+				`player 0 shoot: unknown key "Spacebar"`,
+				"player 1: no key for rotate_left",
+				"player 1: no key for move_forward",
+				"player 1: no key for move_backward",
+				"player 1: no key for shoot",
+			}},
+		{"not json", `{"rotate_right": "D"}`, []string{"cannot unmarshal"}},
+	}
+
+	for _, c := range cases {
+		_, err := ParseBindings([]byte(c.file))
+		if err == nil {
+			t.Errorf("%s: parsed without an error", c.name)
+			continue
+		}
+
+		text := err.Error()
+		for _, want := range c.want {
+			if count := strings.Count(text, want); count != 1 {
+				t.Errorf("%s: %q is reported %d times in:\n%s", c.name, want, count, text)
+			}
+		}
+		if lines := strings.Count(text, "\n") + 1; lines != len(c.want) {
+			t.Errorf("%s: got %d errors, want %d:\n%s", c.name, lines, len(c.want), text)
+		}
+	}
+}
+
+func TestCheckKey(t *testing.T) {
+	bindings := DefaultBindings()
+	cases := []struct {
+		name   string
+		player int
+		action int
+		key    ebiten.Key
+		want   string
+	}{
+		{"free key", 0, 4, ebiten.KeyE, ""},
+		{"its own key", 0, 4, ebiten.KeySpace, ""},
+		{"reserved", 0, 4, ebiten.KeyF2, "F2 is reserved"},
+		{"another action", 0, 4, ebiten.KeyW, "W is already move_forward of player 0"},
+		{"another player", 1, 0, ebiten.KeyD, "D is already rotate_right of player 0"},
+	}
+
+	for _, c := range cases {
+		err := bindings.CheckKey(c.player, c.action, c.key)
+		switch {
+		case c.want == "" && err != nil:
+			t.Errorf("%s: %v", c.name, err)
+		case c.want != "" && (err == nil || err.Error() != c.want):
+			t.Errorf("%s: got %v, want %q", c.name, err, c.want)
+		}
+	}
+}
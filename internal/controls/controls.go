@@ -0,0 +1,54 @@
+package controls
+
+import (
+	"myebiten/internal/models"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+type ControlSettings struct {
+	RotateRightButton  ebiten.Key
+	RotateLeftButton   ebiten.Key
+	MoveForwardButton  ebiten.Key
+	MoveBackwardButton ebiten.Key
+	ShootButton        ebiten.Key
+}
+
+// Update reads the keyboard and applies pressed and released buttons to in.
+func (cs ControlSettings) Update(in *models.Input) {
+	if inpututil.IsKeyJustPressed(cs.RotateRightButton) {
+		in.RotateRight = true
+	}
+	if in.RotateRight && inpututil.IsKeyJustReleased(cs.RotateRightButton) {
+		in.RotateRight = false
+	}
+
+	if inpututil.IsKeyJustPressed(cs.RotateLeftButton) {
+		in.RotateLeft = true
+	}
+	if in.RotateLeft && inpututil.IsKeyJustReleased(cs.RotateLeftButton) {
+		in.RotateLeft = false
+	}
+
+	if inpututil.IsKeyJustPressed(cs.MoveBackwardButton) {
+		in.MoveBackward = true
+	}
+	if in.MoveBackward && inpututil.IsKeyJustReleased(cs.MoveBackwardButton) {
+		in.MoveBackward = false
+	}
+
+	if inpututil.IsKeyJustPressed(cs.MoveForwardButton) {
+		in.MoveForward = true
+	}
+	if in.MoveForward && inpututil.IsKeyJustReleased(cs.MoveForwardButton) {
+		in.MoveForward = false
+	}
+
+	if inpututil.IsKeyJustPressed(cs.ShootButton) {
+		in.Shoot = true
+	}
+	if in.Shoot && inpututil.IsKeyJustReleased(cs.ShootButton) {
+		in.Shoot = false
+	}
+}
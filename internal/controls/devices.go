@@ -0,0 +1,100 @@
+package controls
+
+import (
+	"log"
+
+	"myebiten/internal/gamepad"
+	"myebiten/internal/models"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Devices are the keyboard layouts and gamepads of the players at this machine. Player i plays
+// on its layout of bindings until a gamepad joins it, unplugging the gamepad gives the player the keyboard back.
+type Devices struct {
+	bindings   Bindings
+	players    int
+	assignment *gamepad.Assignment
+	gamepads   []gamepad.State
+	changes    []gamepad.Change
+	ids        []ebiten.GamepadID
+}
+
+func NewDevices(bindings Bindings, players int) *Devices {
+	return &Devices{
+		bindings:   bindings,
+		players:    players,
+		assignment: gamepad.NewAssignment(players),
+	}
+}
+
+// Players tells how many players play at this machine.
+func (devices *Devices) Players() int {
+	return devices.players
+}
+
+// SetBindings changes the keyboard layouts, keys held while they change count once released.
+func (devices *Devices) SetBindings(bindings Bindings) {
+	devices.bindings = bindings
+}
+
+// Update reads the gamepads once a frame, joins the ones a button was pressed on and logs who changed device.
+func (devices *Devices) Update() {
+	devices.ids = ebiten.AppendGamepadIDs(devices.ids[:0])
+	devices.gamepads = devices.gamepads[:0]
+	for _, id := range devices.ids {
+		devices.gamepads = append(devices.gamepads, readGamepad(id))
+	}
+
+	devices.changes = devices.assignment.Update(devices.gamepads, devices.changes[:0])
+	for _, change := range devices.changes {
+		if change.Joined {
+			log.Printf("player %d plays with gamepad %d (%s)\n", change.Player, change.Gamepad, change.Name)
+		} else {
+			log.Printf("gamepad %d of player %d was unplugged, back to the keyboard\n", change.Gamepad, change.Player)
+		}
+	}
+}
+
+// Read applies the device of player to in.
+func (devices *Devices) Read(player int, in *models.Input) {
+	if devices.assignment.Map(player, devices.gamepads, in) {
+		return
+	}
+	if player < devices.players {
+		devices.bindings.ForPlayer(player).Update(in)
+	}
+}
+
+// readGamepad reads a gamepad with the standard layout by its buttons. Other gamepads are guessed at:
+// the first two axes are usually the left stick and the first button the one under the right thumb.
+func readGamepad(id ebiten.GamepadID) gamepad.State {
+	state := gamepad.State{ID: gamepad.ID(id), Name: ebiten.GamepadName(id)}
+
+	if !ebiten.IsStandardGamepadLayoutAvailable(id) {
+		if ebiten.GamepadAxisCount(id) >= 2 {
+			state.StickX = ebiten.GamepadAxisValue(id, 0)
+			state.StickY = ebiten.GamepadAxisValue(id, 1)
+		}
+		state.ShootButton = ebiten.IsGamepadButtonPressed(id, ebiten.GamepadButton0)
+		for button := range ebiten.GamepadButtonCount(id) {
+			state.AnyButton = state.AnyButton || ebiten.IsGamepadButtonPressed(id, ebiten.GamepadButton(button))
+		}
+		return state
+	}
+
+	state.StickX = ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisLeftStickHorizontal)
+	state.StickY = ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisLeftStickVertical)
+	state.Trigger = max(
+		ebiten.StandardGamepadButtonValue(id, ebiten.StandardGamepadButtonFrontBottomRight),
+		ebiten.StandardGamepadButtonValue(id, ebiten.StandardGamepadButtonFrontBottomLeft))
+	state.DPadUp = ebiten.IsStandardGamepadButtonPressed(id, ebiten.StandardGamepadButtonLeftTop)
+	state.DPadDown = ebiten.IsStandardGamepadButtonPressed(id, ebiten.StandardGamepadButtonLeftBottom)
+	state.DPadLeft = ebiten.IsStandardGamepadButtonPressed(id, ebiten.StandardGamepadButtonLeftLeft)
+	state.DPadRight = ebiten.IsStandardGamepadButtonPressed(id, ebiten.StandardGamepadButtonLeftRight)
+	state.ShootButton = ebiten.IsStandardGamepadButtonPressed(id, ebiten.StandardGamepadButtonRightBottom)
+	for button := ebiten.StandardGamepadButton(0); button <= ebiten.StandardGamepadButtonMax; button++ {
+		state.AnyButton = state.AnyButton || ebiten.IsStandardGamepadButtonPressed(id, button)
+	}
+	return state
+}
@@ -0,0 +1,189 @@
+package discovery
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_PORT      = 8089
+	ANNOUNCE_INTERVAL = time.Second
+	// servers not heard of for this long are dropped from the list
+	SERVER_TIMEOUT = 3 * ANNOUNCE_INTERVAL
+
+	// every announcement carries it so other broadcasts on the port are ignored
+	ANNOUNCEMENT_GAME     = "tanks in maze"
+	MAX_ANNOUNCEMENT_SIZE = 1024
+)
+
+// BroadcastAddress is where servers announce themselves on the local network.
+func BroadcastAddress(port int) string {
+	return net.JoinHostPort("255.255.255.255", strconv.Itoa(port))
+}
+
+// Announcement describes a running server, Port is its game port on the host the announcement came from.
+// The maze sizes are the smallest and the largest a round can have, both included.
+type Announcement struct {
+	Game             string
+	Name             string
+	Port             string
+	ProtocolVersion  int
+	PlayersConnected int
+	PlayersCount     int
+	MinMazeHeight    int
+	MaxMazeHeight    int
+	MinMazeWidth     int
+	MaxMazeWidth     int
+}
+
+// Announcer sends the current announcement of a server every interval.
+type Announcer struct {
+	conn   *net.UDPConn
+	target *net.UDPAddr
+	info   func() Announcement
+	done   chan struct{}
+}
+
+// StartAnnouncer starts announcing to target, the broadcast address on a LAN or a loopback one in tests.
+// info is called from the announcer goroutine.
+func StartAnnouncer(target string, interval time.Duration, info func() Announcement) (*Announcer, error) {
+	targetAddr, err := net.ResolveUDPAddr("udp4", target)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Announcer{
+		conn:   conn,
+		target: targetAddr,
+		info:   info,
+		done:   make(chan struct{}),
+	}
+	go a.run(interval)
+
+	return a, nil
+}
+
+func (a *Announcer) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := a.announce(); err != nil {
+			log.Println(err)
+		}
+
+		select {
+		case <-a.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *Announcer) announce() error {
+	announcement := a.info()
+	announcement.Game = ANNOUNCEMENT_GAME
+
+	message, err := json.Marshal(announcement)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.conn.WriteToUDP(message, a.target)
+	return err
+}
+
+func (a *Announcer) Close() error {
+	close(a.done)
+	return a.conn.Close()
+}
+
+// Server is a server found by a Listener, Address is what clients connect to.
+type Server struct {
+	Announcement
+	Address  string
+	LastSeen time.Time
+}
+
+// Listener collects the announcements of servers on the local network.
+type Listener struct {
+	sync.Mutex
+	conn    *net.UDPConn
+	servers map[string]Server
+}
+
+// Listen starts collecting announcements sent to address, like ":8089".
+func Listen(address string) (*Listener, error) {
+	addr, err := net.ResolveUDPAddr("udp4", address)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenUDP("udp4", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Listener{
+		conn:    conn,
+		servers: map[string]Server{},
+	}
+	go l.receive()
+
+	return l, nil
+}
+
+func (l *Listener) receive() {
+	buffer := make([]byte, MAX_ANNOUNCEMENT_SIZE)
+	for {
+		n, from, err := l.conn.ReadFromUDP(buffer)
+		if err != nil {
+			// the listener was closed
+			return
+		}
+
+		var announcement Announcement
+		if err := json.Unmarshal(buffer[:n], &announcement); err != nil || announcement.Game != ANNOUNCEMENT_GAME {
+			continue
+		}
+
+		address := net.JoinHostPort(from.IP.String(), announcement.Port)
+		l.Lock()
+		l.servers[address] = Server{Announcement: announcement, Address: address, LastSeen: time.Now()}
+		l.Unlock()
+	}
+}
+
+// Servers returns the servers heard of recently sorted by address.
+func (l *Listener) Servers() []Server {
+	l.Lock()
+	defer l.Unlock()
+
+	servers := make([]Server, 0, len(l.servers))
+	for address, server := range l.servers {
+		if time.Since(server.LastSeen) > SERVER_TIMEOUT {
+			delete(l.servers, address)
+			continue
+		}
+		servers = append(servers, server)
+	}
+
+	sort.Slice(servers, func(i, j int) bool {
+		return servers[i].Address < servers[j].Address
+	})
+	return servers
+}
+
+func (l *Listener) Close() error {
+	return l.conn.Close()
+}
@@ -0,0 +1,53 @@
+package discovery
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAnnouncementsOverLoopback(t *testing.T) {
+	listener, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	port := listener.conn.LocalAddr().(*net.UDPAddr).Port
+
+	announcer, err := StartAnnouncer(net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), 20*time.Millisecond, func() Announcement {
+		return Announcement{Name: "test server", Port: "8080", ProtocolVersion: 9, PlayersConnected: 1, PlayersCount: 4}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	servers := waitForServers(listener, func(servers []Server) bool { return len(servers) > 0 })
+	if len(servers) != 1 {
+		announcer.Close()
+		t.Fatalf("got %d servers, want 1", len(servers))
+	}
+	server := servers[0]
+	if server.Name != "test server" || server.Address != "127.0.0.1:8080" || server.PlayersConnected != 1 || server.PlayersCount != 4 {
+		t.Errorf("got %+v", server)
+	}
+
+	if err := announcer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if servers := waitForServers(listener, func(servers []Server) bool { return len(servers) == 0 }); len(servers) != 0 {
+		t.Fatalf("server still listed %s after its last announcement", SERVER_TIMEOUT)
+	}
+}
+
+// waitForServers polls the listener until done accepts its servers, for a bit longer than SERVER_TIMEOUT.
+func waitForServers(listener *Listener, done func([]Server) bool) []Server {
+	deadline := time.Now().Add(SERVER_TIMEOUT + time.Second)
+	for {
+		servers := listener.Servers()
+		if done(servers) || time.Now().After(deadline) {
+			return servers
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
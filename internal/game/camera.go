@@ -0,0 +1,145 @@
+package game
+
+import (
+	"fmt"
+	"image"
+	"time"
+
+	"myebiten/internal/models"
+	"myebiten/internal/sim"
+	"myebiten/internal/ui"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+const (
+	CAMERA_MAX_ZOOM    = 4.0
+	CAMERA_ZOOM_STEP   = 1.25
+	CAMERA_FOLLOW_ZOOM = 2.0
+	// how many screen pixels the free camera moves per second
+	CAMERA_PAN_SPEED = 2000.0
+)
+
+// CAMERA_FOLLOW_KEYS follow the player of the same index
+var CAMERA_FOLLOW_KEYS = []ebiten.Key{
+	ebiten.KeyDigit1, ebiten.KeyDigit2, ebiten.KeyDigit3, ebiten.KeyDigit4, ebiten.KeyDigit5,
+	ebiten.KeyDigit6, ebiten.KeyDigit7, ebiten.KeyDigit8, ebiten.KeyDigit9, ebiten.KeyDigit0,
+}
+
+// camera is how spectators look at the maze: freely moved and zoomed, or following one of the players.
+// At zoom 1 the whole maze fits the playing area like it does for players.
+type camera struct {
+	follow     bool
+	followedID int
+	zoom       float64
+	// the maze point shown in the middle of the playing area
+	center models.Vector2D
+
+	// the maze area as SetDrawingSettings fitted it
+	fit        ui.DrawingSettings
+	fitHeight  float64
+	fitWidth   float64
+	boardImage *ebiten.Image
+}
+
+func newCamera() *camera {
+	return &camera{zoom: 1.0}
+}
+
+// reset shows the whole new maze, the followed player stays followed.
+func (camera *camera) reset(mazeArea *ui.DrawingArea, viewArea *ui.DrawingArea) {
+	camera.fit = mazeArea.DrawingSettings
+	camera.fitHeight = mazeArea.Height
+	camera.fitWidth = mazeArea.Width
+	camera.center = models.Vector2D{X: mazeArea.Width / mazeArea.Scale / 2, Y: mazeArea.Height / mazeArea.Scale / 2}
+
+	// zoomed in the maze must not cover the score and status lines
+	bounds := image.Rect(int(viewArea.Offset.X), int(viewArea.Offset.Y), int(viewArea.Offset.X+viewArea.Width), int(viewArea.Offset.Y+viewArea.Height))
+	camera.boardImage = viewArea.BoardImage.SubImage(bounds).(*ebiten.Image)
+}
+
+// update reads the camera keys: F toggles following, TAB picks the next player to follow, 1 to 0 follow
+// the first ten players, arrows move the free camera and +/- zoom. elapsed is how long the last frame took.
+func (camera *camera) update(world *sim.World, elapsed time.Duration) {
+	if inpututil.IsKeyJustPressed(ebiten.KeyF) {
+		camera.follow = !camera.follow
+		if camera.follow && camera.zoom < CAMERA_FOLLOW_ZOOM {
+			camera.zoom = CAMERA_FOLLOW_ZOOM
+		}
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyTab) {
+		camera.follow = true
+		camera.followedID = nextActiveCharacter(world, camera.followedID)
+	}
+	for i, key := range CAMERA_FOLLOW_KEYS {
+		if i < len(world.Characters) && inpututil.IsKeyJustPressed(key) {
+			camera.follow = true
+			camera.followedID = i
+		}
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyEqual) || inpututil.IsKeyJustPressed(ebiten.KeyNumpadAdd) {
+		camera.zoom = min(camera.zoom*CAMERA_ZOOM_STEP, CAMERA_MAX_ZOOM)
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyMinus) || inpututil.IsKeyJustPressed(ebiten.KeyNumpadSubtract) {
+		camera.zoom = max(camera.zoom/CAMERA_ZOOM_STEP, 1.0)
+	}
+
+	if camera.follow {
+		if camera.followedID < len(world.Characters) && world.Characters[camera.followedID].IsActive() {
+			camera.center = world.Characters[camera.followedID].Position
+		}
+		return
+	}
+
+	step := CAMERA_PAN_SPEED * elapsed.Seconds() / (camera.fit.Scale * camera.zoom)
+	if ebiten.IsKeyPressed(ebiten.KeyArrowLeft) {
+		camera.center.X -= step
+	}
+	if ebiten.IsKeyPressed(ebiten.KeyArrowRight) {
+		camera.center.X += step
+	}
+	if ebiten.IsKeyPressed(ebiten.KeyArrowUp) {
+		camera.center.Y -= step
+	}
+	if ebiten.IsKeyPressed(ebiten.KeyArrowDown) {
+		camera.center.Y += step
+	}
+}
+
+// apply moves the maze area so that center is in the middle of what the fitted maze covered.
+func (camera *camera) apply(mazeArea *ui.DrawingArea) {
+	if camera.boardImage == nil {
+		return
+	}
+
+	scale := camera.fit.Scale * camera.zoom
+	mazeArea.Scale = scale
+	mazeArea.Offset = models.Vector2D{
+		X: camera.fit.Offset.X + camera.fitWidth/2 - camera.center.X*scale,
+		Y: camera.fit.Offset.Y + camera.fitHeight/2 - camera.center.Y*scale,
+	}
+	mazeArea.BoardImage = camera.boardImage
+}
+
+func (camera *camera) statusText() string {
+	if camera.follow {
+		return fmt.Sprintf("spectating player %d, TAB or 1-0 pick a player, F free camera, +/- zoom", camera.followedID)
+	}
+
+	return "spectating, arrows move, +/- zoom, F follow a player"
+}
+
+// nextActiveCharacter returns the first character after id still in the round, id itself when there is none.
+func nextActiveCharacter(world *sim.World, id int) int {
+	count := len(world.Characters)
+	for i := 1; i <= count; i++ {
+		next := (id + i) % count
+		if world.Characters[next].IsActive() {
+			return next
+		}
+	}
+
+	return id
+}
@@ -0,0 +1,169 @@
+package game
+
+import (
+	"fmt"
+
+	"myebiten/internal/models"
+	"myebiten/internal/protocol"
+	"myebiten/internal/ui"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+const (
+	CHAT_LOG_LINES = 3
+	// older lines are forgotten
+	CHAT_HISTORY = 100
+
+	CHAT_LOG_AREA_ID   = "chat_log_area"
+	CHAT_INPUT_AREA_ID = "chat_input_area"
+)
+
+// chat is the log of chat lines in the top bar and the input line players type into.
+// While the input is open it takes all keystrokes, the tank stands still.
+type chat struct {
+	open  bool
+	input []rune
+	chars []rune
+	// how many lines the log is scrolled back from the newest one
+	scroll  int
+	history []protocol.ChatMessage
+
+	logTexts  []ui.UIText
+	inputText ui.UIText
+}
+
+func newChat() *chat {
+	chat := &chat{
+		logTexts:  make([]ui.UIText, CHAT_LOG_LINES),
+		inputText: ui.CreateUIText("", REGULAR_FONT),
+	}
+	for i := range chat.logTexts {
+		chat.logTexts[i] = ui.CreateUIText("", REGULAR_FONT)
+	}
+
+	return chat
+}
+
+// addTo puts the log on the right half of UI_AREA1_ID and the input line at the bottom of the playing area.
+func (chat *chat) addTo(scene *ui.SceneUI) {
+	UIArea1 := scene.GetArea(UI_AREA1_ID)
+	lineHeight := UIArea1.Height / (CHAT_LOG_LINES + 1)
+	for i := range chat.logTexts {
+		areaID := fmt.Sprintf("%s_%d", CHAT_LOG_AREA_ID, i)
+		area := UIArea1.NewArea(
+			lineHeight,
+			UIArea1.Width/2,
+			ui.DrawingSettings{
+				Offset: models.Vector2D{X: 0.5 * UIArea1.Width, Y: float64(i+1) * lineHeight},
+				Scale:  1.0,
+			})
+		scene.AddDrawingArea(areaID, area)
+
+		chat.logTexts[i].SetActive(true)
+		scene.AddObject(&chat.logTexts[i], areaID)
+	}
+
+	mainArea := scene.GetArea(MAIN_PLAYING_AREA_ID)
+	inputArea := scene.GetRootArea().NewArea(
+		lineHeight,
+		mainArea.Width,
+		ui.DrawingSettings{
+			Offset: models.Vector2D{X: 0.05 * mainArea.Width, Y: mainArea.Offset.Y + mainArea.Height - lineHeight/2},
+			Scale:  1.0,
+		})
+	scene.AddDrawingArea(CHAT_INPUT_AREA_ID, inputArea)
+	scene.AddObject(&chat.inputText, CHAT_INPUT_AREA_ID)
+}
+
+// uiObjectsCount is how many objects addTo adds.
+func (chat *chat) uiObjectsCount() int {
+	return len(chat.logTexts) + 1
+}
+
+// update reads the keyboard: ENTER opens the input and sends the typed line, ESC drops it,
+// PAGE UP and PAGE DOWN scroll the log. It returns the line to send when there is one.
+func (chat *chat) update() (string, bool) {
+	text, send := "", false
+
+	switch {
+	case !chat.open:
+		if inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
+			chat.open = true
+		}
+	case inpututil.IsKeyJustPressed(ebiten.KeyEnter):
+		text = protocol.CleanChatText(string(chat.input))
+		send = text != ""
+		chat.close()
+	case inpututil.IsKeyJustPressed(ebiten.KeyEscape):
+		chat.close()
+	default:
+		chat.typeChars()
+	}
+
+	if chat.open && inpututil.IsKeyJustPressed(ebiten.KeyPageUp) {
+		chat.scroll = min(chat.scroll+1, max(len(chat.history)-CHAT_LOG_LINES, 0))
+	}
+	if chat.open && inpututil.IsKeyJustPressed(ebiten.KeyPageDown) {
+		chat.scroll = max(chat.scroll-1, 0)
+	}
+
+	chat.syncTexts()
+	return text, send
+}
+
+// typeChars applies the characters typed this frame, the line never gets longer than the server accepts.
+func (chat *chat) typeChars() {
+	if inpututil.IsKeyJustPressed(ebiten.KeyBackspace) && len(chat.input) > 0 {
+		chat.input = chat.input[:len(chat.input)-1]
+	}
+
+	chat.chars = ebiten.AppendInputChars(chat.chars[:0])
+	for _, char := range chat.chars {
+		if len(string(chat.input))+len(string(char)) > protocol.MAX_CHAT_TEXT {
+			break
+		}
+		chat.input = append(chat.input, char)
+	}
+}
+
+func (chat *chat) close() {
+	chat.open = false
+	chat.input = chat.input[:0]
+	chat.scroll = 0
+}
+
+// add puts a line into the log, a log scrolled back stays on the lines it shows.
+func (chat *chat) add(message protocol.ChatMessage) {
+	chat.history = append(chat.history, message)
+	if len(chat.history) > CHAT_HISTORY {
+		chat.history = append(chat.history[:0], chat.history[len(chat.history)-CHAT_HISTORY:]...)
+	}
+
+	if chat.scroll > 0 {
+		chat.scroll = min(chat.scroll+1, max(len(chat.history)-CHAT_LOG_LINES, 0))
+	}
+	chat.syncTexts()
+}
+
+func (chat *chat) syncTexts() {
+	last := len(chat.history) - chat.scroll
+	first := max(last-len(chat.logTexts), 0)
+	for i := range chat.logTexts {
+		line := &chat.logTexts[i]
+		if first+i >= last {
+			line.SetText("")
+			continue
+		}
+
+		message := chat.history[first+i]
+		line.SetText(fmt.Sprintf("player %d: %s", message.Sender, message.Text))
+		if message.Sender >= 0 {
+			line.SetColor(playerColor(message.Sender))
+		}
+	}
+
+	chat.inputText.SetActive(chat.open)
+	chat.inputText.SetText(fmt.Sprintf("say: %s_", string(chat.input)))
+}
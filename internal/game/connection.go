@@ -1,195 +1,246 @@
 package game
 
 import (
-	"encoding/json"
 	"log"
+	"time"
 
 	"myebiten/internal/models"
 	"myebiten/internal/models/character"
 	modelitem "myebiten/internal/models/item"
+	"myebiten/internal/netstats"
+	"myebiten/internal/protocol"
 )
 
 var (
 	CONNECTION_MODE_OFFLINE = "offline"
 	CONNECTION_MODE_SERVER  = "server"
 	CONNECTION_MODE_CLIENT  = "client"
+	// dedicated servers open no window and leave every slot to remote players
+	CONNECTION_MODE_DEDICATED = "dedicated"
+	// replays play a recorded match, nobody is connected
+	CONNECTION_MODE_REPLAY = "replay"
 )
 
-type MazeDTO struct {
-	H, W  int
-	Walls []models.Wall
-}
-
 type connectionClient interface {
 	GetPlayerID() int
-	ReadMessage() []byte
-	ReadMapMessage() []byte
+	Connected() bool
+	ReadMessages(dst [][]byte) [][]byte
 	WriteMessage(message []byte) error
+	Counters() *netstats.Counters
 }
 
-type connectionServer interface {
-	GetInput(playerID int) models.Input
-	WriteThingsMessage(message []byte) error
-	WriteMapMessage(message []byte) error
-}
+// UpdateFromServer applies the received messages in the order the server sent them.
+// It reports whether a snapshot was applied.
+func (mainScene *MainScene) UpdateFromServer(client connectionClient) bool {
+	mainScene.messages = client.ReadMessages(mainScene.messages[:0])
 
-func (mainScene *MainScene) UpdateGameFromServer(client connectionClient) {
-	msg := client.ReadMessage()
+	applied := false
+	for _, message := range mainScene.messages {
+		kind, err := protocol.MessageType(message)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
 
-	var newGame MainScene
-	err := json.Unmarshal(msg, &newGame)
-	if err != nil {
-		log.Println(err)
-		return
+		switch kind {
+		case protocol.MESSAGE_MAZE:
+			client.Counters().ResetSnapshots()
+			mainScene.applyMaze(message)
+		case protocol.MESSAGE_SNAPSHOT, protocol.MESSAGE_DELTA_SNAPSHOT:
+			sequence, err := protocol.SnapshotSequence(message)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			if !client.Counters().Snapshot(sequence) {
+				// a newer snapshot overtook it, applying it would move everything back
+				continue
+			}
+			if mainScene.applySnapshot(message) {
+				applied = true
+			}
+		case protocol.MESSAGE_CHAT:
+			var chatMessage protocol.ChatMessage
+			if err := protocol.DecodeChat(message, &chatMessage); err != nil {
+				log.Println(err)
+				continue
+			}
+			mainScene.chat.add(chatMessage)
+		case protocol.MESSAGE_SNAPSHOT_DUMP:
+			mainScene.desync.compare(message)
+		default:
+			log.Printf("server sent unexpected message type %d\n", kind)
+		}
 	}
+	clear(mainScene.messages)
+	mainScene.desync.report(client)
 
-	if len(newGame.Characters) == 0 {
-		return
+	return applied
+}
+
+// applySnapshot takes the scores from the snapshot, reconciles the predicted local tanks with it
+// and queues it for interpolating the rest of the world. A snapshot carrying a state hash is put into
+// the world as a whole first, the world is checked against the hash before the local tanks run ahead again.
+func (mainScene *MainScene) applySnapshot(message []byte) bool {
+	snapshot := &mainScene.snapshot
+	if err := protocol.DecodeSnapshotMessage(message, &mainScene.snapshotHistory, snapshot); err != nil {
+		// acking 0 makes the server fall back to a full snapshot
+		log.Println(err)
+		mainScene.snapshotAck = 0
+		return false
 	}
+	mainScene.snapshotHistory.Put(snapshot)
+	mainScene.snapshotAck = snapshot.Sequence
 
-	mainScene.Characters = copyCharacters(mainScene.Characters, newGame.Characters)
-	mainScene.Bullets = copyBullets(mainScene.Bullets, newGame.Bullets)
-	mainScene.Items = mainScene.copyItems(newGame.Items)
-	mainScene.CharactersScores = newGame.CharactersScores
+	world := mainScene.world
+	mainScene.interpolation.Push(snapshot, time.Now())
+	world.Tick = snapshot.Tick
+	copy(world.CharactersScores, snapshot.Scores)
 	mainScene.syncScoreUITexts()
-}
+	if snapshot.StateHash != 0 {
+		// the interpolation takes the remote entities back to their delayed state before the frame is drawn
+		mainScene.applyRemoteState(snapshot)
+	}
+	if len(mainScene.seats) == 0 {
+		// spectators have no tank to reconcile
+		mainScene.desync.check(world, snapshot)
+		return false
+	}
 
-// func (c *Character) SendInputToServer(ws *websocket.Conn) {
-// 	msg, err := json.Marshal(c.input)
-// 	if err != nil {
-// 		log.Fatal(err)
-// 	}
-
-// 	err = ws.WriteMessage(websocket.TextMessage, msg)
-// 	if err != nil {
-// 		log.Fatal(err)
-// 	}
-// }
-
-func copyCharacters(dst []*character.Character, src []*character.Character) []*character.Character {
-	if len(dst) == 0 {
-		dst = append(dst, src...)
-	} else {
-		for i, char := range src {
-			if i >= len(dst) {
-				break
-			}
+	for _, seat := range mainScene.seats {
+		seat.acked = false
+		playerID := seat.playerID()
+		if playerID < 0 || playerID >= len(snapshot.Characters) || playerID >= len(world.Characters) {
+			continue
+		}
 
-			c := dst[i]
-			if char == nil {
-				c.Position.X = 99999
-				c.Position.Y = 99999
-				continue
-			}
+		localChar := world.Characters[playerID]
+		seat.shownPosition = models.Vector2D{
+			X: localChar.Position.X + seat.prediction.offset.X,
+			Y: localChar.Position.Y + seat.prediction.offset.Y,
+		}
+		seat.shownRotation = localChar.Rotation + seat.prediction.rotationOffset
 
-			c.Position.X = char.Position.X
-			c.Position.Y = char.Position.Y
-			c.Rotation = char.Rotation
+		if playerID < len(snapshot.InputAcks) {
+			if text, ok := seat.prediction.verify(world, playerID, snapshot.Characters[playerID], snapshot.InputAcks[playerID], snapshot.Tick); ok {
+				log.Printf("desync of player %d: %s\n", playerID, text)
+			}
+			seat.acked = true
+		}
+		copyCharacter(localChar, snapshot.Characters[playerID])
+	}
+	mainScene.desync.check(world, snapshot)
 
-			c.SetActive(char.IsActive())
+	for _, seat := range mainScene.seats {
+		if seat.acked {
+			seat.prediction.reconcile(world, seat.playerID(), snapshot.InputAcks[seat.playerID()], seat.shownPosition, seat.shownRotation)
 		}
 	}
 
-	return dst
+	return true
 }
 
-func copyBullets(dst []*models.Bullet, src []*models.Bullet) []*models.Bullet {
-	if len(dst) == 0 {
-		dst = append(dst, src...)
-	} else {
-		for i, b := range src {
-			if i >= len(dst) {
-				break
-			}
-
-			bullet := dst[i]
+// applyInterpolatedSnapshot shows everything but the predicted local tanks as it was a little while ago.
+func (mainScene *MainScene) applyInterpolatedSnapshot() {
+	snapshot := &mainScene.renderSnapshot
+	if !mainScene.interpolation.Sample(time.Now(), snapshot) {
+		return
+	}
 
-			bullet.Position.X = b.Position.X
-			bullet.Position.Y = b.Position.Y
-			bullet.Rotation = b.Rotation
-			bullet.Sprite.R = b.Sprite.R
+	mainScene.applyRemoteState(snapshot)
+}
 
-			bullet.SetActive(b.IsActive())
+// applyRemoteState puts everything but the predicted local tanks where snapshot has it.
+func (mainScene *MainScene) applyRemoteState(snapshot *protocol.Snapshot) {
+	world := mainScene.world
+	for i, state := range snapshot.Characters {
+		if i >= len(world.Characters) {
+			break
 		}
+		if mainScene.isLocalSeat(i) {
+			continue
+		}
+
+		copyCharacter(world.Characters[i], state)
 	}
+	copyBullets(world.Bullets, snapshot.Bullets)
+	world.Items = mainScene.copyItems(snapshot.Items)
+}
 
-	return dst
+func copyCharacter(c *character.Character, state protocol.EntityState) {
+	c.SetActive(state.Active)
+	if !state.Active {
+		return
+	}
+
+	c.Position = state.Position
+	c.Rotation = state.Rotation
 }
 
-func (mainScene *MainScene) copyItems(src []*modelitem.Item) []*modelitem.Item {
-	for i := len(src); i < len(mainScene.Items); i++ {
-		if mainScene.Items[i] != nil {
-			mainScene.Items[i].SetActive(false)
+func copyBullets(dst []*models.Bullet, src []protocol.BulletState) {
+	for i, state := range src {
+		if i >= len(dst) {
+			break
+		}
+
+		bullet := dst[i]
+		bullet.SetActive(state.Active)
+		if !state.Active {
+			continue
+		}
+
+		bullet.Position = state.Position
+		bullet.R = state.R
+	}
+}
+
+func (mainScene *MainScene) copyItems(src []protocol.ItemState) []*modelitem.Item {
+	for i := len(src); i < len(mainScene.world.Items); i++ {
+		if mainScene.world.Items[i] != nil {
+			mainScene.world.Items[i].SetActive(false)
 		}
 	}
 
-	dst := mainScene.Items
+	dst := mainScene.world.Items
 	if len(dst) < len(src) {
 		dst = append(dst, make([]*modelitem.Item, len(src)-len(dst))...)
 	}
 	dst = dst[:len(src)]
 
-	for i, srcItem := range src {
-		if srcItem == nil {
-			if dst[i] != nil {
-				dst[i].SetActive(false)
+	for i, state := range src {
+		if dst[i] == nil {
+			if !state.Active {
+				continue
 			}
-			continue
-		}
 
-		if dst[i] == nil {
 			dst[i] = &modelitem.Item{}
-			mainScene.AddObject(dst[i], MAZE_AREA_ID)
+			mainScene.addItemView(dst[i])
 		}
 
 		dstItem := dst[i]
-		dstItem.GameObject = srcItem.GameObject
-		dstItem.Type = srcItem.Type
-
-		if dstItem.IsActive() && dstItem.IconSprite.Image == nil {
-			if sprite := getItemSprite(dstItem.Type); sprite != nil {
-				dstItem.IconSprite = *sprite
-			}
-		}
+		dstItem.SetActive(state.Active)
+		dstItem.Position = state.Position
+		dstItem.Type = state.Type
 	}
 
 	return dst
 }
 
-func (mainScene *MainScene) UpdateMazeFromClient(client connectionClient) {
-	message := client.ReadMapMessage()
-	if len(message) == 0 {
-		return
-	}
-
-	var maze MazeDTO
-	err := json.Unmarshal(message, &maze)
+func (mainScene *MainScene) applyMaze(message []byte) {
+	seed, err := protocol.DecodeMaze(message)
 	if err != nil {
-		log.Fatal(err)
+		log.Println(err)
+		return
 	}
 
-	mainScene.Walls = maze.Walls
-
-	for i := range mainScene.Walls {
-		mainScene.Walls[i].Hitbox = models.RectangleHitbox{W: WALL_WIDTH, H: WALL_HEIGHT}
-		mainScene.Walls[i].Sprite = models.RectangleSprite{W: WALL_WIDTH, H: WALL_HEIGHT}
+	h, w, _ := mainScene.world.BuildLevel(seed)
+	mainScene.world.Reset()
+	for _, seat := range mainScene.seats {
+		seat.prediction.reset()
 	}
+	mainScene.interpolation.Reset()
+	log.Printf("round seed %d\n", seed)
 
 	mainScene.Reset()
-	mainScene.SetDrawingSettings(maze.H, maze.W)
-}
-
-func SendMazeToClient(server connectionServer, h, w int, walls []models.Wall) {
-	maze := MazeDTO{h, w, walls}
-
-	msg, err := json.Marshal(maze)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	err = server.WriteMapMessage(msg)
-
-	if err != nil {
-		log.Fatal(err)
-	}
+	mainScene.SetDrawingSettings(h, w)
 }
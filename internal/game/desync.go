@@ -0,0 +1,76 @@
+package game
+
+import (
+	"log"
+
+	"myebiten/internal/protocol"
+	"myebiten/internal/sim"
+	wsClient "myebiten/internal/websocket/client"
+)
+
+// desyncCheck compares the state hashes the server puts in snapshots with the world of the client
+// at the tick of the snapshot, it catches tanks, bullets and items that are alive, dead or somewhere
+// else here than on the server. How the client predicts its own tanks is checked by prediction.verify.
+// Only the first divergence is reported: its tick is logged, the server is asked for the snapshot
+// of that tick and once that arrives the entities that differ are logged.
+type desyncCheck struct {
+	found bool
+	// reported tells whether the server was asked for the snapshot
+	reported bool
+	// world is the world of the client at the divergent tick
+	world  protocol.Snapshot
+	server protocol.Snapshot
+}
+
+// check hashes world once it holds the tick of a snapshot carrying a state hash and keeps the first divergent one.
+func (check *desyncCheck) check(world *sim.World, snapshot *protocol.Snapshot) {
+	if check.found || snapshot.StateHash == 0 {
+		return
+	}
+
+	hash := protocol.WorldHash(world)
+	if hash == snapshot.StateHash {
+		return
+	}
+
+	check.found = true
+	protocol.CaptureSnapshot(world, &check.world)
+	check.world.Sequence = snapshot.Sequence
+	log.Printf("desync at tick %d: the world here hashes to %016x, the server has %016x in snapshot %d\n",
+		snapshot.Tick, hash, snapshot.StateHash, snapshot.Sequence)
+}
+
+// report asks the server for the divergent snapshot once. The server answers players only,
+// spectators just log the tick.
+func (check *desyncCheck) report(client connectionClient) {
+	if !check.found || check.reported {
+		return
+	}
+	check.reported = true
+	if client.GetPlayerID() == wsClient.SPECTATOR_ID {
+		return
+	}
+
+	report := protocol.ControlMessage{Kind: protocol.CONTROL_DESYNC, Value: check.world.Sequence}
+	if err := client.WriteMessage(protocol.AppendControl(nil, &report)); err != nil {
+		log.Println(err)
+	}
+}
+
+// compare logs how the world of the server the snapshot dump holds differs from the world here.
+func (check *desyncCheck) compare(message []byte) {
+	if err := protocol.DecodeSnapshotDump(message, &check.server); err != nil {
+		log.Println(err)
+		return
+	}
+	if !check.found || check.server.Sequence != check.world.Sequence {
+		log.Printf("server dumped snapshot %d, no desync was reported for it\n", check.server.Sequence)
+		return
+	}
+
+	lines := protocol.DiffSnapshots(&check.server, &check.world)
+	log.Printf("desync at tick %d, %d differences from the world of the server:\n", check.world.Tick, len(lines))
+	for _, line := range lines {
+		log.Println("  " + line)
+	}
+}
@@ -1,11 +1,19 @@
 package game
 
 import (
+	"fmt"
 	"image"
 	"image/color"
 	"log"
-
-	"myebiten/internal/models"
+	"time"
+
+	"myebiten/internal/controls"
+	"myebiten/internal/host"
+	"myebiten/internal/interpolation"
+	"myebiten/internal/netcond"
+	"myebiten/internal/replay"
+	"myebiten/internal/sim"
+	"myebiten/internal/ui"
 	"myebiten/internal/websocket/client"
 	"myebiten/internal/websocket/server"
 
@@ -16,9 +24,8 @@ import (
 const (
 	DEFAULT_PLAYERS_COUNT = 2
 	MAX_PLAYERS_COUNT     = 10
-
-	STATE_GAME_ENDING_TIMER_SECONDS = 1
-	ITEM_SPAWN_INTERVAL             = 4
+	// every player at one keyboard needs a layout of its own in the key bindings
+	MAX_LOCAL_PLAYERS = 4
 )
 
 var (
@@ -29,12 +36,6 @@ var (
 	SCREEN_SIZE_HEIGHT = 1420
 )
 
-const (
-	STATE_MAZE_CREATING = iota
-	STATE_GAME_RUNNING
-	STATE_GAME_ENDING
-)
-
 const (
 	MENU_SCENE_ID  = 1
 	LOBBY_SCENE_ID = 2
@@ -47,11 +48,11 @@ const (
 	MAZE_AREA_ID         = "maze_area"
 	UI_AREA1_ID          = "ui_area_1"
 	SCORE_AREA_ID        = "score_area"
+	STATUS_AREA_ID       = "status_area"
 )
 
 var noChars = true // zaglushka
 
-var wallsToCheck []*models.Wall = make([]*models.Wall, 12)
 var (
 	COLOR_BLACK = color.RGBA{0x0f, 0x0f, 0x0f, 0xff}
 )
@@ -61,50 +62,225 @@ type Game struct {
 	client       *client.Client
 	connMode     string
 	playersCount int
+	config       Config
+	recorder     *replay.Recorder
+
+	scenes      map[int]ui.Scene `json:"-"`
+	activeScene ui.Scene         `json:"-"`
+}
 
-	scenes      map[int]models.Scene `json:"-"`
-	activeScene models.Scene         `json:"-"`
+// Config is what the game is started with, main fills it from the command line flags.
+type Config struct {
+	ConnectionMode string
+	ServerPort     string
+	Address        string
+	PlayersCount   int
+	PlayerID       int
+	// LocalPlayers play at this keyboard in a network match, each with its own keys.
+	// The host seats them in the first slots, a client in the slots from PlayerID on.
+	LocalPlayers int
+	Seed         int64
+	// servers and offline matches step the world TickRate times per second,
+	// servers send SnapshotRate snapshots per second. Clients take the tick rate of the server.
+	TickRate     int
+	SnapshotRate int
+	// servers and offline matches are recorded to the replay file RecordPath when it is set
+	RecordPath string
+	// ReplayPath is the replay file played in replay mode
+	ReplayPath string
+	// Bindings are the keyboard layouts of the local players, the rebind screen saves them to BindingsPath.
+	// Without a BindingsPath changes last until the game closes.
+	Bindings     controls.Bindings
+	BindingsPath string
+
+	// Password gates claiming a slot on a server, a client gets its slots back with Tokens after a restart,
+	// one per local player
+	Password string
+	Tokens   []string
+	// Spectate joins the server only to watch the match
+	Spectate bool
+	// NetConditions simulate a bad network on the connections of a server or a client
+	NetConditions netcond.Config
+
+	// how far in the past clients show remote entities and how long they may guess past the newest snapshot
+	InterpolationDelay time.Duration
+	ExtrapolationLimit time.Duration
+
+	// servers announce ServerName on DiscoveryPort, clients with Browse pick a server from the announcements
+	ServerName    string
+	DiscoveryPort int
+	Browse        bool
 }
 
-func CreateGame(connectionMode, serverPort, address string, playersCount, playerID int) *Game {
-	playersCount = normalizePlayersCount(playersCount)
-	if connectionMode == CONNECTION_MODE_CLIENT {
-		var err error
-		playersCount, err = client.GetPlayersCount(address)
+func CreateGame(config Config) *Game {
+	if config.Bindings == nil {
+		config.Bindings = controls.DefaultBindings()
+	}
+	game := &Game{
+		connMode: config.ConnectionMode,
+		config:   config,
+		scenes:   make(map[int]ui.Scene, 3),
+	}
+	game.scenes[MENU_SCENE_ID] = &MenuScene{}
+	game.scenes[LOBBY_SCENE_ID] = &LobbyScene{}
+
+	switch config.ConnectionMode {
+	case CONNECTION_MODE_CLIENT:
+		if config.Browse {
+			menuScene, err := CreateMenuScene(config.DiscoveryPort, game.joinServer)
+			if err != nil {
+				log.Fatal(err)
+			}
+			game.scenes[MENU_SCENE_ID] = menuScene
+			game.SetActiveScene(MENU_SCENE_ID)
+			return game
+		}
+
+		if err := game.joinServer(config.Address); err != nil {
+			log.Fatal(err)
+		}
+	case CONNECTION_MODE_SERVER:
+		mainScene := game.createMainScene(NormalizePlayersCount(config.PlayersCount), config.TickRate)
+		localPlayers := min(NormalizeLocalPlayers(config.LocalPlayers), game.playersCount)
+		game.server = server.New(config.ServerPort, game.playersCount, localPlayers, config.Password, config.TickRate, config.NetConditions)
+		mainScene.host = host.New(mainScene.world, game.server, localPlayers, config.SnapshotRate)
+		mainScene.host.SetRecorder(game.startRecording(mainScene.world))
+		mainScene.devices = controls.NewDevices(config.Bindings, localPlayers)
+		if _, err := mainScene.host.StartAnnouncing(config.ServerName, config.ServerPort, config.DiscoveryPort); err != nil {
+			// the match works without it, clients just have to know the address
+			log.Println(err)
+		}
+
+		game.scenes[LOBBY_SCENE_ID] = CreateLobbyScene(game.playersCount, mainScene.host, func() {
+			game.SetActiveScene(MAIN_SCENE_ID)
+		})
+		game.SetActiveScene(LOBBY_SCENE_ID)
+	case CONNECTION_MODE_REPLAY:
+		player, err := replay.Load(config.ReplayPath)
 		if err != nil {
 			log.Fatal(err)
 		}
-		playersCount = normalizePlayersCount(playersCount)
+		// the replay was recorded with a valid players count and tick rate, they are taken as they are
+		mainScene := game.createMainScene(player.Header().PlayersCount, player.Header().TickRate)
+		mainScene.replay = newReplayViewer(player)
+		mainScene.camera = newCamera()
+		game.SetActiveScene(MAIN_SCENE_ID)
+	default:
+		mainScene := game.createMainScene(NormalizePlayersCount(config.PlayersCount), config.TickRate)
+		mainScene.recorder = game.startRecording(mainScene.world)
+		mainScene.devices = controls.NewDevices(config.Bindings, game.playersCount)
+		game.SetActiveScene(MAIN_SCENE_ID)
 	}
 
-	game := Game{playersCount: playersCount}
+	return game
+}
 
-	menuScene := &LobbyScene{}
-	lobbyScene := &LobbyScene{}
-	mainScene := CreateMainScene(playersCount)
+// joinServer connects to the server at address and shows its match,
+// the server tells the players count when we connect.
+func (g *Game) joinServer(address string) error {
+	if g.config.Spectate {
+		gameClient, err := client.NewSpectator(address, g.config.Password, g.config.NetConditions)
+		if err != nil {
+			return err
+		}
 
-	mainScene.getConnectionMode = game.getConnectionMode
-	mainScene.getGameClient = game.getClient
-	mainScene.getGameServer = game.getServer
+		g.client = gameClient
+		mainScene := g.createMainScene(NormalizePlayersCount(gameClient.PlayersCount()), gameClient.TickRate())
+		mainScene.camera = newCamera()
+		g.SetActiveScene(MAIN_SCENE_ID)
+		return nil
+	}
 
-	game.scenes = make(map[int]models.Scene, 3)
+	clients, err := g.connectLocalPlayers(address)
+	if err != nil {
+		return err
+	}
 
-	game.scenes[MENU_SCENE_ID] = menuScene
-	game.scenes[LOBBY_SCENE_ID] = lobbyScene
-	game.scenes[MAIN_SCENE_ID] = mainScene
+	g.client = clients[0]
+	mainScene := g.createMainScene(NormalizePlayersCount(g.client.PlayersCount()), g.client.TickRate())
+	seatClients := make([]connectionClient, len(clients))
+	for i, seatClient := range clients {
+		seatClients[i] = seatClient
+	}
+	mainScene.seats = newLocalSeats(seatClients)
+	mainScene.devices = controls.NewDevices(g.config.Bindings, len(seatClients))
+	g.SetActiveScene(MAIN_SCENE_ID)
+	return nil
+}
 
-	switch connectionMode {
-	case CONNECTION_MODE_SERVER:
-		game.server = server.New(serverPort, playersCount)
-	case CONNECTION_MODE_CLIENT:
-		game.client = client.New(address, normalizePlayerID(playerID, playersCount))
-	default:
+// connectLocalPlayers opens a connection for every player at this keyboard, they take the slots from PlayerID on.
+// When a slot can't be taken the connections already open are closed and their tokens kept,
+// so joining again gets the same slots back.
+func (g *Game) connectLocalPlayers(address string) ([]*client.Client, error) {
+	localPlayers := NormalizeLocalPlayers(g.config.LocalPlayers)
+	clients := make([]*client.Client, 0, localPlayers)
+	for i := range localPlayers {
+		token := ""
+		if i < len(g.config.Tokens) {
+			token = g.config.Tokens[i]
+		}
+
+		seatClient, err := client.New(address, g.config.PlayerID+i, token, g.config.Password, g.config.NetConditions)
+		if err != nil {
+			for j, opened := range clients {
+				opened.Close()
+				for len(g.config.Tokens) <= j {
+					g.config.Tokens = append(g.config.Tokens, "")
+				}
+				g.config.Tokens[j] = opened.Token()
+			}
+			return nil, fmt.Errorf("player %d: %w", g.config.PlayerID+i, err)
+		}
+		clients = append(clients, seatClient)
+	}
+
+	return clients, nil
+}
+
+func (g *Game) createMainScene(playersCount, tickRate int) *MainScene {
+	g.playersCount = playersCount
+
+	seed := g.config.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	log.Printf("match seed %d\n", seed)
+
+	mainScene := CreateMainScene(playersCount, seed, tickRate)
+	mainScene.interpolation = interpolation.NewBuffer(g.config.InterpolationDelay, g.config.ExtrapolationLimit, tickRate)
+
+	mainScene.rebind.bindings = g.config.Bindings
+	mainScene.rebind.path = g.config.BindingsPath
+	mainScene.getConnectionMode = g.getConnectionMode
+	mainScene.getGameClient = g.getClient
+
+	g.scenes[MAIN_SCENE_ID] = mainScene
+	return mainScene
+}
+
+// startRecording records the match of world when the game was asked to, it returns nil otherwise.
+func (g *Game) startRecording(world *sim.World) *replay.Recorder {
+	if g.config.RecordPath == "" {
+		return nil
 	}
-	game.connMode = connectionMode
 
-	game.SetActiveScene(MAIN_SCENE_ID)
+	recorder, err := replay.Create(g.config.RecordPath, world)
+	if err != nil {
+		log.Fatal(err)
+	}
+	g.recorder = recorder
+	return recorder
+}
 
-	return &game
+// Close finishes the replay being recorded, main calls it once the window is closed.
+func (g *Game) Close() {
+	if g.recorder == nil {
+		return
+	}
+
+	if err := g.recorder.Close(g.scenes[MAIN_SCENE_ID].(*MainScene).world); err != nil {
+		log.Println(err)
+	}
 }
 
 func (g *Game) Layout(outsideWidth, outsideHeight int) (screenWidth, screenHeight int) {
@@ -113,7 +289,7 @@ func (g *Game) Layout(outsideWidth, outsideHeight int) (screenWidth, screenHeigh
 
 func (g *Game) Update() error {
 	// Zaglushka
-	if noChars {
+	if _, ok := g.scenes[MAIN_SCENE_ID]; noChars && ok {
 		for id := 0; id < g.playersCount; id++ {
 			g.CreateCharacter(id)
 		}
@@ -133,10 +309,6 @@ func (g *Game) getConnectionMode() string {
 	return g.connMode
 }
 
-func (g *Game) getServer() *server.Server {
-	return g.server
-}
-
 func (g *Game) getClient() *client.Client {
 	return g.client
 }
@@ -149,7 +321,11 @@ func (g *Game) SetActiveScene(sceneID int) {
 	g.activeScene = g.scenes[sceneID]
 }
 
-func normalizePlayersCount(playersCount int) int {
+func NormalizeLocalPlayers(localPlayers int) int {
+	return min(max(localPlayers, 1), MAX_LOCAL_PLAYERS)
+}
+
+func NormalizePlayersCount(playersCount int) int {
 	if playersCount < DEFAULT_PLAYERS_COUNT {
 		return DEFAULT_PLAYERS_COUNT
 	}
@@ -158,13 +334,3 @@ func normalizePlayersCount(playersCount int) int {
 	}
 	return playersCount
 }
-
-func normalizePlayerID(playerID, playersCount int) int {
-	if playerID <= 0 {
-		return 1
-	}
-	if playerID >= playersCount {
-		return playersCount - 1
-	}
-	return playerID
-}
@@ -4,10 +4,9 @@ import (
 	"bytes"
 	"image"
 	"log"
-	"math/rand"
 
-	"myebiten/internal/models"
 	"myebiten/internal/models/item"
+	"myebiten/internal/ui"
 	images "myebiten/resources"
 
 	"github.com/hajimehoshi/ebiten/v2"
@@ -24,7 +23,7 @@ var itemSpriteBytes = [][]byte{
 
 type itemSprite struct {
 	itemType item.ItemType
-	sprite   *models.ImageSprite
+	sprite   *ui.ImageSprite
 }
 
 var itemSprites []itemSprite
@@ -42,7 +41,7 @@ func loadItemSprites() []itemSprite {
 		resized := resize.Resize(itemIconSize, 0, img, resize.Lanczos3)
 		sprite := itemSprite{
 			itemType: item.ItemType(idx),
-			sprite:   &models.ImageSprite{Image: ebiten.NewImageFromImage(resized)},
+			sprite:   &ui.ImageSprite{Image: ebiten.NewImageFromImage(resized)},
 		}
 		sprites = append(sprites, sprite)
 	}
@@ -50,7 +49,7 @@ func loadItemSprites() []itemSprite {
 	return sprites
 }
 
-func getItemSprite(itemType item.ItemType) *models.ImageSprite {
+func getItemSprite(itemType item.ItemType) *ui.ImageSprite {
 	if len(itemSprites) == 0 {
 		itemSprites = loadItemSprites()
 	}
@@ -63,17 +62,3 @@ func getItemSprite(itemType item.ItemType) *models.ImageSprite {
 
 	return nil
 }
-
-func getRandomItemSprite() (item.ItemType, *models.ImageSprite) {
-	if len(itemSprites) == 0 {
-		itemSprites = loadItemSprites()
-	}
-
-	selected := itemSprites[rand.Intn(len(itemSprites))]
-
-	//TODO: REMOVE THIS LINES TO SPAWN OTHER ITEM TYPES
-	selected.itemType = item.TypeMinigun
-	selected.sprite = getItemSprite(item.TypeMinigun)
-
-	return selected.itemType, selected.sprite
-}
@@ -1,19 +1,128 @@
 package game
 
 import (
+	"fmt"
+
+	"myebiten/internal/host"
 	"myebiten/internal/models"
+	"myebiten/internal/ui"
 
 	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
 )
 
+const MIN_PLAYERS_TO_START = host.MIN_PLAYERS_TO_START
+
+// LobbyScene is where the host waits for clients and starts the match with whoever came.
 type LobbyScene struct {
-	models.SceneUI
+	ui.SceneUI
+
+	connected      []bool
+	fillWithBots   bool
+	slotTexts      []ui.UIText
+	hintText       ui.UIText
+	spectatorsText ui.UIText
+
+	host       *host.Host
+	startMatch func()
 }
 
-func (menuScene *LobbyScene) Update() error {
-	return nil
+func CreateLobbyScene(playersCount int, matchHost *host.Host, startMatch func()) *LobbyScene {
+	lobbyScene := &LobbyScene{
+		SceneUI:        ui.CreateSceneUI(ebiten.NewImage(SCREEN_SIZE_WIDTH, SCREEN_SIZE_HEIGHT), float64(SCREEN_SIZE_HEIGHT), float64(SCREEN_SIZE_WIDTH)),
+		connected:      make([]bool, playersCount),
+		slotTexts:      make([]ui.UIText, playersCount),
+		hintText:       ui.CreateUIText("", REGULAR_FONT),
+		spectatorsText: ui.CreateUIText("", REGULAR_FONT),
+		host:           matchHost,
+		startMatch:     startMatch,
+	}
+
+	rootArea := lobbyScene.GetRootArea()
+	lineHeight := rootArea.Height / 20
+	for i := range lobbyScene.slotTexts {
+		lobbyScene.slotTexts[i] = ui.CreateUIText("", REGULAR_FONT)
+		lobbyScene.slotTexts[i].SetColor(playerColor(i))
+		addTextLine(&lobbyScene.SceneUI, &lobbyScene.slotTexts[i], fmt.Sprintf("lobby_slot_%d", i), float64(i+2)*lineHeight)
+	}
+	addTextLine(&lobbyScene.SceneUI, &lobbyScene.hintText, "lobby_hint", float64(playersCount+3)*lineHeight)
+	addTextLine(&lobbyScene.SceneUI, &lobbyScene.spectatorsText, "lobby_spectators", float64(playersCount+4)*lineHeight)
+
+	return lobbyScene
+}
+
+// addTextLine puts text on its own line y pixels from the top of the scene.
+func addTextLine(scene *ui.SceneUI, text *ui.UIText, areaID string, y float64) {
+	rootArea := scene.GetRootArea()
+	area := rootArea.NewArea(
+		rootArea.Height/20,
+		rootArea.Width,
+		ui.DrawingSettings{
+			Offset: models.Vector2D{X: 0.1 * rootArea.Width, Y: y},
+			Scale:  1.0,
+		})
+	scene.AddDrawingArea(areaID, area)
+
+	text.SetActive(true)
+	scene.AddObject(text, areaID)
 }
 
-func (menuScene *LobbyScene) Draw() *ebiten.Image {
+func (lobbyScene *LobbyScene) Update() error {
+	if lobbyScene.host == nil {
+		return nil
+	}
+
+	present := lobbyScene.host.ConnectedSlots(lobbyScene.connected)
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyB) {
+		lobbyScene.fillWithBots = !lobbyScene.fillWithBots
+	}
+
+	for i := range lobbyScene.slotTexts {
+		lobbyScene.slotTexts[i].SetText(lobbyScene.slotText(i))
+	}
+	lobbyScene.spectatorsText.SetText(spectatorsText(lobbyScene.host.SpectatorsCount()))
+
+	if present < MIN_PLAYERS_TO_START {
+		lobbyScene.hintText.SetText(fmt.Sprintf("waiting for players, at least %d are needed", MIN_PLAYERS_TO_START))
+		return nil
+	}
+
+	lobbyScene.hintText.SetText(fmt.Sprintf("ENTER to start with %d players, B to toggle bots in empty slots", present))
+	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
+		lobbyScene.host.SetupSlots(lobbyScene.connected, lobbyScene.fillWithBots)
+		lobbyScene.startMatch()
+	}
+
 	return nil
 }
+
+func (lobbyScene *LobbyScene) slotText(i int) string {
+	switch {
+	case i < lobbyScene.host.LocalPlayers():
+		return fmt.Sprintf("player %d: host", i)
+	case lobbyScene.connected[i]:
+		return fmt.Sprintf("player %d: connected", i)
+	case lobbyScene.fillWithBots:
+		return fmt.Sprintf("player %d: waiting, bot if nobody comes", i)
+	default:
+		return fmt.Sprintf("player %d: waiting, empty if nobody comes", i)
+	}
+}
+
+// spectatorsText tells the host how many people watch the match, nothing when nobody does.
+func spectatorsText(count int) string {
+	if count == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("%d spectators watching", count)
+}
+
+func (lobbyScene *LobbyScene) Draw() *ebiten.Image {
+	if lobbyScene.host == nil {
+		return nil
+	}
+
+	return lobbyScene.SceneUI.Draw()
+}
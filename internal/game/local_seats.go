@@ -0,0 +1,78 @@
+package game
+
+import (
+	"myebiten/internal/models"
+	"myebiten/internal/protocol"
+)
+
+// localSeat is a player at this keyboard in a network match. Every seat has a connection and a slot
+// of its own, so to the server it is an ordinary client. The connection of the first seat brings
+// the snapshots the match is drawn from, they reconcile the predicted tanks of all seats.
+type localSeat struct {
+	client     connectionClient
+	prediction prediction
+	// where the tank was drawn before the last snapshot moved it, reconcile smooths from there
+	shownPosition models.Vector2D
+	shownRotation float64
+	// acked tells whether the last snapshot carried an input ack for the seat
+	acked bool
+
+	// the other seats only ack what their connection received, nothing decodes it
+	snapshotAck uint64
+	messages    [][]byte
+	inputBuffer []byte
+}
+
+// newLocalSeats seats the players of clients in order, seat i plays on the devices of local player i.
+func newLocalSeats(clients []connectionClient) []*localSeat {
+	seats := make([]*localSeat, len(clients))
+	for i, seatClient := range clients {
+		seats[i] = &localSeat{client: seatClient}
+	}
+
+	return seats
+}
+
+func (seat *localSeat) playerID() int {
+	return seat.client.GetPlayerID()
+}
+
+// drain empties the connection of a seat other than the first, the first one receives the same messages.
+// The newest snapshot is acked so the server keeps sending deltas.
+func (seat *localSeat) drain() {
+	seat.messages = seat.client.ReadMessages(seat.messages[:0])
+	for _, message := range seat.messages {
+		if sequence, err := protocol.SnapshotSequence(message); err == nil {
+			seat.snapshotAck = sequence
+		}
+	}
+	clear(seat.messages)
+}
+
+// sendInputs sends input once for every tick due, the server simulates one input per tick.
+func (seat *localSeat) sendInputs(input models.Input, ticks int, snapshotAck uint64) error {
+	for range ticks {
+		message := protocol.InputMessage{
+			Input:       input,
+			Sequence:    seat.prediction.nextInput(input),
+			SnapshotAck: snapshotAck,
+		}
+		seat.inputBuffer = protocol.AppendInput(seat.inputBuffer[:0], &message)
+		if err := seat.client.WriteMessage(seat.inputBuffer); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isLocalSeat tells whether the tank of playerID is predicted here.
+func (mainScene *MainScene) isLocalSeat(playerID int) bool {
+	for _, seat := range mainScene.seats {
+		if seat.playerID() == playerID {
+			return true
+		}
+	}
+
+	return false
+}
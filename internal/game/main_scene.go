@@ -6,16 +6,19 @@ import (
 	"image"
 	"image/color"
 	"log"
-	"math"
-	"math/rand"
 	"time"
 
+	"myebiten/internal/controls"
+	"myebiten/internal/host"
+	"myebiten/internal/interpolation"
 	"myebiten/internal/models"
 	"myebiten/internal/models/character"
 	"myebiten/internal/models/item"
-	"myebiten/internal/weapons"
+	"myebiten/internal/protocol"
+	"myebiten/internal/replay"
+	"myebiten/internal/sim"
+	"myebiten/internal/ui"
 	wsClient "myebiten/internal/websocket/client"
-	wsServer "myebiten/internal/websocket/server"
 	images "myebiten/resources"
 
 	"github.com/hajimehoshi/ebiten/v2"
@@ -23,65 +26,99 @@ import (
 )
 
 type MainScene struct {
-	models.SceneUI `json:"-"`
-
-	stateEndingTimer *time.Timer
-	itemSpawnTicker  *time.Ticker
-
-	PlayersCount int
-	state        int
-	leftAlive    int
-
-	Maze             [][]MazeNode
-	Bullets          []*models.Bullet
-	Items            []*item.Item
-	Walls            []models.Wall
-	Characters       []*character.Character
-	defaultWeapons   []character.Weapon
-	CharactersScores []uint
-
-	ScoreUITexts []models.UIText
-	pauseMenu    models.UIPanel `json:"-"`
+	ui.SceneUI
+
+	world *sim.World
+	// clock steps the world at its tick rate, frames come at the rate of the display
+	clock     *sim.Clock
+	lastFrame time.Time
+	host      *host.Host
+	// recorder records offline matches, the host records the others
+	recorder *replay.Recorder
+	// replay plays a recorded match instead of stepping world
+	replay      *replayViewer
+	localInputs []models.Input
+	// seats are the players at this keyboard in a network match, their tanks are predicted
+	seats []*localSeat
+	// devices are the keyboard layouts and gamepads of the players at this machine
+	devices *controls.Devices
+
+	snapshot        protocol.Snapshot
+	snapshotHistory protocol.SnapshotHistory
+	snapshotAck     uint64
+	desync          desyncCheck
+	messages        [][]byte
+
+	// clients draw remote entities from the interpolated renderSnapshot
+	interpolation  *interpolation.Buffer
+	renderSnapshot protocol.Snapshot
+	// only spectators move the camera, players always see the whole maze
+	camera *camera
+
+	characterViews []*characterView
+	bulletViews    []*bulletView
+	itemViews      []*itemView
+
+	ScoreUITexts []ui.UIText
+	StatusUIText *ui.UIText
+	chat         *chat
+	netStats     *statsOverlay
+	rebind       *rebindScreen
+	pauseMenu    ui.UIPanel
 
 	getConnectionMode func() string
 	getGameClient     func() *wsClient.Client
-	getGameServer     func() *wsServer.Server
 }
 
-func CreateMainScene(playersCount int) *MainScene {
-	bullets := make([]*models.Bullet, weapons.DEFAULT_GUN_BULLETS_COUNT*playersCount+weapons.MINIGUN_BULLETS_COUNT*playersCount)
-	for i := range bullets {
-		bullets[i] = models.CreateBullet(weapons.DEFAULT_GUN_BULLET_RADIUS)
+func CreateMainScene(playersCount int, seed int64, tickRate int) *MainScene {
+	world := sim.NewWorld(playersCount, seed, tickRate)
+
+	bulletViews := make([]*bulletView, len(world.Bullets))
+	for i, bullet := range world.Bullets {
+		bulletViews[i] = &bulletView{Bullet: bullet}
 	}
 
-	UIScores := make([]models.UIText, playersCount)
+	UIScores := make([]ui.UIText, playersCount)
 	for i := range UIScores {
-		UIScores[i] = models.CreateUIText(scoreText(0), REGULAR_FONT)
+		UIScores[i] = ui.CreateUIText(scoreText(0), REGULAR_FONT)
 		UIScores[i].SetColor(playerColor(i))
 	}
 
-	mainSceneUI := buildMainSceneUI(UIScores)
+	statusText := ui.CreateUIText("", REGULAR_FONT)
+
+	mainSceneUI := buildMainSceneUI(UIScores, &statusText)
+	chat := newChat()
+	chat.addTo(&mainSceneUI)
+	netStats := newStatsOverlay(playersCount)
+	netStats.addTo(&mainSceneUI)
+	rebind := newRebindScreen()
+	rebind.addTo(&mainSceneUI)
+
 	return &MainScene{
-		SceneUI:          mainSceneUI,
-		state:            STATE_MAZE_CREATING,
-		ScoreUITexts:     UIScores,
-		Bullets:          bullets,
-		CharactersScores: make([]uint, playersCount),
-		PlayersCount:     playersCount,
+		SceneUI:      mainSceneUI,
+		world:        world,
+		clock:        sim.NewClock(tickRate),
+		localInputs:  make([]models.Input, playersCount),
+		bulletViews:  bulletViews,
+		ScoreUITexts: UIScores,
+		StatusUIText: &statusText,
+		chat:         chat,
+		netStats:     netStats,
+		rebind:       rebind,
 	}
 }
 
-func buildMainSceneUI(scores []models.UIText) models.SceneUI {
+func buildMainSceneUI(scores []ui.UIText, status *ui.UIText) ui.SceneUI {
 	ebitenImage := ebiten.NewImage(SCREEN_SIZE_WIDTH, SCREEN_SIZE_HEIGHT)
 
-	scene := models.CreateSceneUI(ebitenImage, float64(SCREEN_SIZE_HEIGHT), float64(SCREEN_SIZE_WIDTH))
+	scene := ui.CreateSceneUI(ebitenImage, float64(SCREEN_SIZE_HEIGHT), float64(SCREEN_SIZE_WIDTH))
 
 	rootArea := scene.GetRootArea()
 
 	mainArea := rootArea.NewArea(
 		rootArea.Height*0.8,
 		rootArea.Width,
-		models.DrawingSettings{
+		ui.DrawingSettings{
 			Offset: models.Vector2D{X: 0.0, Y: rootArea.Height / 10},
 			Scale:  1.0,
 		})
@@ -90,16 +127,27 @@ func buildMainSceneUI(scores []models.UIText) models.SceneUI {
 	UIArea1 := rootArea.NewArea(
 		rootArea.Height*0.1,
 		rootArea.Width,
-		models.DrawingSettings{
+		ui.DrawingSettings{
 			Offset: models.Vector2D{X: 0.0, Y: 0.0},
 			Scale:  1.0,
 		})
 	scene.AddDrawingArea(UI_AREA1_ID, UIArea1)
 
+	statusArea := UIArea1.NewArea(
+		UIArea1.Height,
+		UIArea1.Width,
+		ui.DrawingSettings{
+			Offset: models.Vector2D{X: 0.05 * UIArea1.Width, Y: 0.5 * UIArea1.Height},
+			Scale:  1.0,
+		})
+	scene.AddDrawingArea(STATUS_AREA_ID, statusArea)
+	status.SetActive(true)
+	scene.AddObject(status, STATUS_AREA_ID)
+
 	ScoreArea := rootArea.NewArea(
 		rootArea.Height*0.1,
 		rootArea.Width,
-		models.DrawingSettings{
+		ui.DrawingSettings{
 			Offset: models.Vector2D{X: 0.0, Y: rootArea.Height * 0.9},
 			Scale:  1.0,
 		})
@@ -110,7 +158,7 @@ func buildMainSceneUI(scores []models.UIText) models.SceneUI {
 		scoreArea := ScoreArea.NewArea(
 			0.99*ScoreArea.Height,
 			ScoreArea.Width/float64(len(scores)),
-			models.DrawingSettings{
+			ui.DrawingSettings{
 				Offset: models.Vector2D{
 					X: (float64(i) + 0.5) * ScoreArea.Width / float64(len(scores)),
 					Y: 0.5 * ScoreArea.Height,
@@ -127,22 +175,12 @@ func buildMainSceneUI(scores []models.UIText) models.SceneUI {
 	return scene
 }
 
-func (mainScene *MainScene) updateScores(id int) {
-	if id < 0 || id >= len(mainScene.CharactersScores) || id >= len(mainScene.ScoreUITexts) {
-		return
-	}
-
-	mainScene.CharactersScores[id]++
-	mainScene.ScoreUITexts[id].SetText(scoreText(mainScene.CharactersScores[id]))
-	mainScene.ScoreUITexts[id].SetColor(playerColor(id))
-}
-
 func (mainScene *MainScene) syncScoreUITexts() {
 	for i := range mainScene.ScoreUITexts {
-		if i >= len(mainScene.CharactersScores) {
+		if i >= len(mainScene.world.CharactersScores) {
 			break
 		}
-		mainScene.ScoreUITexts[i].SetText(scoreText(mainScene.CharactersScores[i]))
+		mainScene.ScoreUITexts[i].SetText(scoreText(mainScene.world.CharactersScores[i]))
 		mainScene.ScoreUITexts[i].SetColor(playerColor(i))
 	}
 }
@@ -155,220 +193,6 @@ func scoreAreaID(index int) string {
 	return fmt.Sprintf("%s_%d", SCORE_AREA_ID, index+1)
 }
 
-func (mainScene *MainScene) getClosestWalls(c *character.Character) []*models.Wall {
-	// yes, this is shit, I see it too, dw it will all change
-	i, j := getMazeCoordinates(c.Position)
-	k := 0
-	if mainScene.Maze[i][j].topWall != nil {
-		wallsToCheck[k] = mainScene.Maze[i][j].topWall
-		k++
-	}
-	if mainScene.Maze[i][j].bottomWall != nil {
-		wallsToCheck[k] = mainScene.Maze[i][j].bottomWall
-		k++
-	}
-	if mainScene.Maze[i][j].leftWall != nil {
-		wallsToCheck[k] = mainScene.Maze[i][j].leftWall
-		k++
-	}
-	if mainScene.Maze[i][j].rightWall != nil {
-		wallsToCheck[k] = mainScene.Maze[i][j].rightWall
-		k++
-	}
-
-	if mainScene.Maze[i-1][j].leftWall != nil {
-		wallsToCheck[k] = mainScene.Maze[i-1][j].leftWall
-		k++
-	}
-	if mainScene.Maze[i-1][j].rightWall != nil {
-		wallsToCheck[k] = mainScene.Maze[i-1][j].rightWall
-		k++
-	}
-
-	if mainScene.Maze[i+1][j].leftWall != nil {
-		wallsToCheck[k] = mainScene.Maze[i+1][j].leftWall
-		k++
-	}
-	if mainScene.Maze[i+1][j].rightWall != nil {
-		wallsToCheck[k] = mainScene.Maze[i+1][j].rightWall
-		k++
-	}
-
-	if mainScene.Maze[i][j-1].topWall != nil {
-		wallsToCheck[k] = mainScene.Maze[i][j-1].topWall
-		k++
-	}
-	if mainScene.Maze[i][j-1].bottomWall != nil {
-		wallsToCheck[k] = mainScene.Maze[i][j-1].bottomWall
-		k++
-	}
-
-	if mainScene.Maze[i][j+1].topWall != nil {
-		wallsToCheck[k] = mainScene.Maze[i][j+1].topWall
-		k++
-	}
-	if mainScene.Maze[i][j+1].bottomWall != nil {
-		wallsToCheck[k] = mainScene.Maze[i][j+1].bottomWall
-		k++
-	}
-
-	return wallsToCheck[:k]
-}
-
-func (mainScene *MainScene) DetectCharacterToWallCollision(c *character.Character) {
-	closestWalls := mainScene.getClosestWalls(c)
-	for _, w := range closestWalls {
-		isCollide := c.DetectWallCollision(*w)
-		if isCollide {
-			c.MoveBack()
-		}
-	}
-}
-
-func (mainScene *MainScene) DetectBulletToWallCollision(b *models.Bullet) {
-	wh := float64(WALL_HEIGHT)
-	ww := float64(WALL_WIDTH)
-
-	i, j := getMazeCoordinates(b.Position)
-	nodeCenter := getSceneCoordinates(i, j)
-
-	if i >= len(mainScene.Maze)-1 || i < 0 || j >= len(mainScene.Maze[0])-1 || j < 0 {
-		return
-	}
-
-	// Here top and bottom mean how these directions appear on the screen
-	// meaning, that distToTop actually measures the distance to the wall
-	// that is stored as MazeNode.bottomWall
-	distToTop := b.Position.Y - (nodeCenter.Y - wh/2 + ww)
-	distToRight := (nodeCenter.X + wh/2 - ww) - b.Position.X
-	distToLeft := b.Position.X - (nodeCenter.X - wh/2 + ww)
-	distToBottom := (nodeCenter.Y + wh/2 - ww) - b.Position.Y
-
-	minDist := min(distToBottom, distToLeft, distToRight, distToTop)
-
-	if minDist > b.R {
-		return
-	}
-
-	var horizontalReflection, verticalReflection bool = false, false
-
-	if minDist == distToBottom {
-		// again, because of mismatch between how directions are logically stored
-		// and how they are presented on screen bottom reflection requires MazeNode.topWall
-
-		// check if the top wall is present
-		horizontalReflection = !mainScene.Maze[i][j].up
-
-		// if close to the left check 3 corner walls, same if close to the right
-		// if at least one corner wall is present, perform reflection
-		verticalReflection = (distToLeft < b.R) && !(mainScene.Maze[i][j].up && mainScene.Maze[i+1][j].left && mainScene.Maze[i][j-1].up) ||
-			(distToRight < b.R) && !(mainScene.Maze[i][j].up && mainScene.Maze[i+1][j].right && mainScene.Maze[i][j+1].up)
-
-		// prioritize reflection of the main wall
-		verticalReflection = verticalReflection && !horizontalReflection
-	}
-
-	if minDist == distToTop {
-		// check comments in minDist == distToBottom block
-		horizontalReflection = !mainScene.Maze[i][j].down
-
-		verticalReflection = (distToLeft < b.R) && !(mainScene.Maze[i][j].down && mainScene.Maze[i-1][j].left && mainScene.Maze[i][j-1].down) ||
-			(distToRight < b.R) && !(mainScene.Maze[i][j].down && mainScene.Maze[i-1][j].right && mainScene.Maze[i][j+1].down)
-
-		verticalReflection = verticalReflection && !horizontalReflection
-	}
-
-	if minDist == distToLeft {
-		// check comments in minDist == distToBottom block
-		verticalReflection = !mainScene.Maze[i][j].left
-
-		horizontalReflection = (distToTop < b.R) && !(mainScene.Maze[i][j].down && mainScene.Maze[i-1][j].left && mainScene.Maze[i][j-1].down) ||
-			(distToBottom < b.R) && !(mainScene.Maze[i][j].up && mainScene.Maze[i+1][j].left && mainScene.Maze[i][j-1].up)
-
-		horizontalReflection = horizontalReflection && !verticalReflection
-	}
-
-	if minDist == distToRight {
-		// check comments in minDist == distToBottom block
-		verticalReflection = !mainScene.Maze[i][j].right
-
-		horizontalReflection = (distToTop < b.R) && !(mainScene.Maze[i][j].down && mainScene.Maze[i-1][j].right && mainScene.Maze[i][j+1].down) ||
-			(distToBottom < b.R) && !(mainScene.Maze[i][j].up && mainScene.Maze[i+1][j].right && mainScene.Maze[i][j+1].up)
-
-		horizontalReflection = horizontalReflection && !verticalReflection
-	}
-
-	if verticalReflection {
-		// cosine := math.Abs(b.Speed.X) / b.Speed.Length()
-		// l := minDist / cosine
-		// L := b.R / cosine
-		// t := (L - l) / b.Speed.Length()
-
-		// b.Position.X -= t * b.Speed.X
-		// b.Position.Y -= t * b.Speed.Y
-
-		b.Speed.X = -b.Speed.X
-
-	} else if horizontalReflection {
-		// cosine := math.Abs(b.Speed.Y) / b.Speed.Length()
-		// l := minDist / cosine
-		// L := b.R / cosine
-		// t := (L - l) / b.Speed.Length()
-
-		// b.Position.X -= t * b.Speed.X
-		// b.Position.Y -= t * b.Speed.Y
-
-		b.Speed.Y = -b.Speed.Y
-	}
-}
-
-func (mainScene *MainScene) SetupLevel() (int, int, []models.Wall) {
-	h := rand.Intn(MAX_BOARD_HEIGHT-MIN_BOARD_HEIGHT) + MIN_BOARD_HEIGHT
-	w := rand.Intn(MAX_BOARD_WIDTH-MIN_BOARD_WIDTH) + MIN_BOARD_WIDTH
-
-	walls := mainScene.CreateMaze(h, w)
-	mainScene.SetDrawingSettings(h, w)
-	mainScene.SetCharacters(h, w)
-
-	return h, w, walls
-}
-
-func (mainScene *MainScene) SetCharacters(h, w int) {
-	spawnPlaces := []models.Vector2D{}
-	for range mainScene.Characters {
-		i := rand.Intn(h) + 1
-		j := rand.Intn(w) + 1
-		spawnPlace := getSceneCoordinates(i, j)
-		spawnPlaces = append(spawnPlaces, spawnPlace)
-	}
-
-	i := 0
-	for _, char := range mainScene.Characters {
-		if !char.IsActive() {
-			continue
-		}
-
-		char.Position.X = spawnPlaces[i].X
-		char.Position.Y = spawnPlaces[i].Y
-
-		char.Rotation = math.Pi / 2
-
-		char.Speed.X = 0
-		char.Speed.Y = 0
-
-		i++
-	}
-}
-
-func (mainScene *MainScene) CreateMaze(h, w int) []models.Wall {
-	mainScene.Walls = make([]models.Wall, 0)
-
-	mainScene.Maze = createMaze(h, w)
-	mainScene.Walls = buildMaze(mainScene.Maze, mainScene.Walls)
-
-	return mainScene.Walls
-}
-
 func (mainScene *MainScene) SetDrawingSettings(h, w int) {
 	mainArea := mainScene.GetArea(MAIN_PLAYING_AREA_ID)
 	if mainArea == nil {
@@ -378,57 +202,48 @@ func (mainScene *MainScene) SetDrawingSettings(h, w int) {
 	areaHeight := mainArea.Height
 	areaWidth := mainArea.Width
 
-	mazeHeight := float64(h*(WALL_HEIGHT-WALL_WIDTH) + WALL_WIDTH)
-	mazeWidth := float64(w*(WALL_HEIGHT-WALL_WIDTH) + WALL_WIDTH)
+	mazeHeight := float64(h*(sim.WALL_HEIGHT-sim.WALL_WIDTH) + sim.WALL_WIDTH)
+	mazeWidth := float64(w*(sim.WALL_HEIGHT-sim.WALL_WIDTH) + sim.WALL_WIDTH)
 
 	scalingFactor := min(areaHeight/mazeHeight, areaWidth/mazeWidth)
 
 	mazeHeight *= scalingFactor
 	mazeWidth *= scalingFactor
 
-	newDrawingSettings := models.DrawingSettings{
+	newDrawingSettings := ui.DrawingSettings{
 		Offset: models.Vector2D{X: (areaWidth - mazeWidth) / 2, Y: (areaHeight - mazeHeight) / 2},
 		Scale:  scalingFactor,
 	}
 
 	mazeArea := mainArea.NewArea(mazeHeight, mazeWidth, newDrawingSettings)
 	mainScene.AddDrawingArea(MAZE_AREA_ID, mazeArea)
+	if mainScene.camera != nil {
+		mainScene.camera.reset(mazeArea, mainArea)
+	}
 
-	for _, bullet := range mainScene.Bullets {
+	for _, bullet := range mainScene.bulletViews {
 		mainScene.AddObject(bullet, MAZE_AREA_ID)
 	}
 
-	for _, item := range mainScene.Items {
+	for _, item := range mainScene.itemViews {
 		mainScene.AddObject(item, MAZE_AREA_ID)
 	}
 
-	for _, char := range mainScene.Characters {
+	for _, char := range mainScene.characterViews {
 		mainScene.AddObject(char, MAZE_AREA_ID)
 	}
 
-	for _, wall := range mainScene.Walls {
-		mainScene.AddObject(&wall, MAZE_AREA_ID)
+	for i := range mainScene.world.Walls {
+		mainScene.AddObject(&wallView{Wall: &mainScene.world.Walls[i]}, MAZE_AREA_ID)
 	}
 }
 
+// Reset drops everything drawn in the maze area, the world itself is reset by the sim.
 func (mainScene *MainScene) Reset() {
-	for _, bullet := range mainScene.Bullets {
-		bullet.SetActive(false)
-	}
-
-	for _, item := range mainScene.Items {
-		item.SetActive(false)
-	}
-	mainScene.Items = nil
-
-	for _, char := range mainScene.Characters {
-		char.SetActive(true)
-		char.Input.Reset()
-		char.SwitchToDefaultWeapon()
-	}
+	mainScene.itemViews = nil
 
 	// This needs to be remade, quick solution
-	mainScene.Objects = mainScene.Objects[:len(mainScene.ScoreUITexts)] //len(g.activeScene.Objects)-len(g.Walls)]
+	mainScene.Objects = mainScene.Objects[:mainScene.uiObjectsCount()] //len(g.activeScene.Objects)-len(g.Walls)]
 	am := mainScene.AreaIDs
 	for obj, id := range am {
 		if id == MAZE_AREA_ID {
@@ -439,19 +254,16 @@ func (mainScene *MainScene) Reset() {
 	mainArea.Children = nil
 }
 
-func (mainScene *MainScene) SpawnItem() {
-	if len(mainScene.Maze) < 3 || len(mainScene.Maze[0]) < 3 {
-		return
-	}
-
-	i := rand.Intn(len(mainScene.Maze)-2) + 1
-	j := rand.Intn(len(mainScene.Maze[0])-2) + 1
+// uiObjectsCount is how many objects buildMainSceneUI, the chat and the overlays add, they are kept by Reset.
+func (mainScene *MainScene) uiObjectsCount() int {
+	return len(mainScene.ScoreUITexts) + 1 + mainScene.chat.uiObjectsCount() + mainScene.netStats.uiObjectsCount() +
+		mainScene.rebind.uiObjectsCount()
+}
 
-	position := getSceneCoordinates(i, j)
-	itemType, sprite := getRandomItemSprite()
-	item := item.CreateItem(itemType, position, sprite)
-	mainScene.Items = append(mainScene.Items, item)
-	mainScene.AddObject(item, MAZE_AREA_ID)
+func (mainScene *MainScene) addItemView(newItem *item.Item) {
+	view := &itemView{Item: newItem}
+	mainScene.itemViews = append(mainScene.itemViews, view)
+	mainScene.AddObject(view, MAZE_AREA_ID)
 }
 
 func (mainScene *MainScene) CreateCharacter(id int) {
@@ -462,17 +274,13 @@ func (mainScene *MainScene) CreateCharacter(id int) {
 	resizedCharacterImage := resize.Resize(character.CHARACTER_WIDTH, 0, CHARACTER_IMAGE_TO_RESIZE, resize.Lanczos3)
 	charImage := ebiten.NewImageFromImage(resizedCharacterImage)
 
-	cs := controlSettingsForPlayer(id)
-
-	clip := models.CreatePool(mainScene.Bullets[id*weapons.DEFAULT_GUN_BULLETS_COUNT : (id+1)*weapons.DEFAULT_GUN_BULLETS_COUNT])
-	defaultWeapon := weapons.NewDefaultWeapon(clip)
-
-	mainScene.defaultWeapons = append(mainScene.defaultWeapons, defaultWeapon)
-
-	char := character.CreateCharacter(id, charImage, defaultWeapon, cs, playerColor(id))
-	char.SetActive(true)
-	mainScene.Characters = append(mainScene.Characters, &char)
-	mainScene.AddObject(&char, MAZE_AREA_ID)
+	view := &characterView{
+		Character:    mainScene.world.Characters[id],
+		sprite:       ui.ImageSprite{Image: charImage},
+		markerSprite: ui.CircleSprite{R: float64(character.CHARACTER_WIDTH) / 6, Color: playerColor(id)},
+	}
+	mainScene.characterViews = append(mainScene.characterViews, view)
+	mainScene.AddObject(view, MAZE_AREA_ID)
 }
 
 func playerColor(id int) color.RGBA {
@@ -492,58 +300,9 @@ func playerColor(id int) color.RGBA {
 	return colors[id%len(colors)]
 }
 
-func controlSettingsForPlayer(id int) models.ControlSettings {
-	controlSettings := []models.ControlSettings{
-		{
-			RotateRightButton:  ebiten.KeyD,
-			RotateLeftButton:   ebiten.KeyA,
-			MoveForwardButton:  ebiten.KeyW,
-			MoveBackwardButton: ebiten.KeyS,
-			ShootButton:        ebiten.KeySpace,
-		},
-		{
-			RotateRightButton:  ebiten.KeyArrowRight,
-			RotateLeftButton:   ebiten.KeyArrowLeft,
-			MoveForwardButton:  ebiten.KeyArrowUp,
-			MoveBackwardButton: ebiten.KeyArrowDown,
-			ShootButton:        ebiten.KeySlash,
-		},
-		{
-			RotateRightButton:  ebiten.KeyL,
-			RotateLeftButton:   ebiten.KeyJ,
-			MoveForwardButton:  ebiten.KeyI,
-			MoveBackwardButton: ebiten.KeyK,
-			ShootButton:        ebiten.KeyO,
-		},
-		{
-			RotateRightButton:  ebiten.KeyNumpad6,
-			RotateLeftButton:   ebiten.KeyNumpad4,
-			MoveForwardButton:  ebiten.KeyNumpad8,
-			MoveBackwardButton: ebiten.KeyNumpad5,
-			ShootButton:        ebiten.KeyNumpad0,
-		},
-	}
-
-	if id < len(controlSettings) {
-		return controlSettings[id]
-	}
-
-	return controlSettings[id%len(controlSettings)]
-}
-
-func clientControlSettings() models.ControlSettings {
-	return models.ControlSettings{
-		RotateRightButton:  ebiten.KeyD,
-		RotateLeftButton:   ebiten.KeyA,
-		MoveForwardButton:  ebiten.KeyW,
-		MoveBackwardButton: ebiten.KeyS,
-		ShootButton:        ebiten.KeySpace,
-	}
-}
-
 // debug function
 func (mainScene *MainScene) SanityCheck() {
-	if len(mainScene.Objects) != len(mainScene.Bullets)+len(mainScene.Items)+len(mainScene.Characters)+len(mainScene.Walls)+len(mainScene.ScoreUITexts) {
+	if len(mainScene.Objects) != len(mainScene.bulletViews)+len(mainScene.itemViews)+len(mainScene.characterViews)+len(mainScene.world.Walls)+mainScene.uiObjectsCount() {
 		log.Println("discrepancy between the expected number of objects on the scene and actual number")
 	}
 
@@ -1,181 +1,215 @@
 package game
 
 import (
-	"encoding/json"
 	"errors"
 	"log"
 	"time"
 
 	"myebiten/internal/models"
-	"myebiten/internal/models/character"
+	"myebiten/internal/protocol"
+	"myebiten/internal/sim"
+	wsClient "myebiten/internal/websocket/client"
 )
 
+// Update runs once per frame, the world is stepped as many ticks as are due since the last frame.
 func (mainScene *MainScene) Update() error {
-	connectionMode := mainScene.getConnectionMode()
-	client := mainScene.getGameClient()
-	server := mainScene.getGameServer()
+	mainScene.updateNetStats()
+	if !mainScene.chat.open {
+		mainScene.rebind.update(mainScene.devices)
+	}
 
-	if connectionMode == CONNECTION_MODE_CLIENT {
-		return mainScene.updateClientFrame(client)
+	if mainScene.replay != nil {
+		return mainScene.updateReplayFrame()
+	}
+	if mainScene.getConnectionMode() == CONNECTION_MODE_CLIENT {
+		return mainScene.updateClientFrame(mainScene.getGameClient())
 	}
 
-	if err := mainScene.updateState(connectionMode, server); err != nil {
-		return err
+	if mainScene.host != nil {
+		mainScene.StatusUIText.SetText(spectatorsText(mainScene.host.SpectatorsCount()))
 	}
 
-	mainScene.updateCharacters(connectionMode, server)
-	mainScene.updateBullets()
+	inputs := mainScene.collectInputs()
 
-	if connectionMode == CONNECTION_MODE_SERVER {
-		mainScene.syncToClient(server)
+	for range mainScene.clock.Due(time.Now()) {
+		var events []sim.Event
+		if mainScene.host != nil {
+			events = mainScene.host.Step(inputs)
+			for _, message := range mainScene.host.Chat() {
+				mainScene.chat.add(message)
+			}
+		} else {
+			events = mainScene.world.Step(inputs)
+			if mainScene.recorder != nil {
+				mainScene.recorder.Record(mainScene.world, inputs, events)
+			}
+		}
+		mainScene.handleEvents(events)
 	}
 
 	return nil
 }
 
-func (mainScene *MainScene) updateClientFrame(client connectionClient) error {
-	playerID := client.GetPlayerID()
-	if playerID < 0 || playerID >= len(mainScene.Characters) {
-		return errors.New("client player id is outside characters list")
+// frameTime returns how long the previous frame took, effects not bound to ticks follow it.
+func (mainScene *MainScene) frameTime(now time.Time) time.Duration {
+	elapsed := time.Duration(0)
+	if !mainScene.lastFrame.IsZero() {
+		elapsed = min(now.Sub(mainScene.lastFrame), sim.MAX_CATCH_UP)
 	}
+	mainScene.lastFrame = now
 
-	char := mainScene.Characters[playerID]
-	char.Input.ControlSettings = clientControlSettings()
+	return elapsed
+}
 
-	char.Input.Update()
+// updateClientFrame plays the seats at this keyboard, client is the connection of the first one.
+func (mainScene *MainScene) updateClientFrame(client connectionClient) error {
+	if client.GetPlayerID() == wsClient.SPECTATOR_ID {
+		return mainScene.updateSpectatorFrame(client)
+	}
+	for _, seat := range mainScene.seats {
+		if seat.playerID() < 0 || seat.playerID() >= len(mainScene.localInputs) {
+			return errors.New("client player id is outside characters list")
+		}
+	}
 
-	msg, err := json.Marshal(char.Input)
-	if err != nil {
-		return err
+	if !mainScene.updateConnectionStatus(client) {
+		// the tank is not predicted while nobody simulates it, the server sends a new maze when we are back
+		return nil
+	}
+	if len(mainScene.world.Maze) > 0 {
+		mainScene.StatusUIText.SetText("")
 	}
 
-	if err := client.WriteMessage(msg); err != nil {
-		return err
+	if text, ok := mainScene.updateChat(); ok {
+		chatMessage := protocol.ChatMessage{Sender: client.GetPlayerID(), Text: text}
+		if err := client.WriteMessage(protocol.AppendChat(nil, &chatMessage)); err != nil {
+			return err
+		}
+	}
+	mainScene.devices.Update()
+	for i, seat := range mainScene.seats {
+		input := &mainScene.localInputs[seat.playerID()]
+		if mainScene.keyboardTaken() {
+			// typed keys must not drive the tanks
+			input.Reset()
+		} else {
+			mainScene.devices.Read(i, input)
+		}
 	}
 
-	mainScene.UpdateMazeFromClient(client)
-	mainScene.UpdateGameFromServer(client)
-	return nil
-}
+	now := time.Now()
+	ticks := mainScene.clock.Due(now)
+	for i, seat := range mainScene.seats {
+		snapshotAck := mainScene.snapshotAck
+		if i > 0 {
+			seat.drain()
+			snapshotAck = seat.snapshotAck
+		}
+		if err := seat.sendInputs(mainScene.localInputs[seat.playerID()], ticks, snapshotAck); err != nil {
+			return err
+		}
+	}
 
-func (mainScene *MainScene) updateState(connectionMode string, server connectionServer) error {
-	switch mainScene.state {
-	case STATE_MAZE_CREATING:
-		mainScene.startNewRound(connectionMode, server)
-	case STATE_GAME_RUNNING:
-		mainScene.updateRunningState()
-	case STATE_GAME_ENDING:
-		mainScene.updateEndingState()
-	default:
-		return errors.New("invalid state")
+	if !mainScene.UpdateFromServer(client) {
+		// a new snapshot already replayed these inputs
+		for range ticks {
+			for _, seat := range mainScene.seats {
+				mainScene.world.PredictCharacter(seat.playerID(), mainScene.localInputs[seat.playerID()])
+			}
+		}
 	}
+	mainScene.applyInterpolatedSnapshot()
 
+	elapsed := mainScene.frameTime(now)
+	for _, seat := range mainScene.seats {
+		seat.prediction.decay(elapsed)
+		if playerID := seat.playerID(); playerID < len(mainScene.characterViews) {
+			mainScene.characterViews[playerID].offset = seat.prediction.offset
+			mainScene.characterViews[playerID].rotationOffset = seat.prediction.rotationOffset
+		}
+	}
 	return nil
 }
 
-func (mainScene *MainScene) startNewRound(connectionMode string, server connectionServer) {
-	mainScene.Reset()
-	mainScene.itemSpawnTicker = time.NewTicker(ITEM_SPAWN_INTERVAL * time.Second)
-
-	h, w, walls := mainScene.SetupLevel()
-	if connectionMode != CONNECTION_MODE_OFFLINE {
-		SendMazeToClient(server, h, w, walls)
+// updateSpectatorFrame shows the match as the server sends it, moving only the camera.
+func (mainScene *MainScene) updateSpectatorFrame(client connectionClient) error {
+	if !mainScene.updateConnectionStatus(client) {
+		return nil
 	}
 
-	mainScene.leftAlive = len(mainScene.Characters)
-	mainScene.state = STATE_GAME_RUNNING
-	mainScene.SanityCheck()
-}
+	mainScene.UpdateFromServer(client)
+	mainScene.applyInterpolatedSnapshot()
 
-func (mainScene *MainScene) updateRunningState() {
-	select {
-	case <-mainScene.itemSpawnTicker.C:
-		mainScene.SpawnItem()
-	default:
-		if mainScene.leftAlive <= 1 {
-			mainScene.stateEndingTimer = time.NewTimer(STATE_GAME_ENDING_TIMER_SECONDS * time.Second)
-			mainScene.state = STATE_GAME_ENDING
-		}
+	if len(mainScene.world.Maze) > 0 {
+		mainScene.camera.update(mainScene.world, mainScene.frameTime(time.Now()))
+		mainScene.camera.apply(mainScene.GetArea(MAZE_AREA_ID))
+		mainScene.StatusUIText.SetText(mainScene.camera.statusText())
 	}
+	return nil
 }
 
-func (mainScene *MainScene) updateEndingState() {
-	select {
-	case <-mainScene.stateEndingTimer.C:
-		for _, char := range mainScene.Characters {
-			if char.IsActive() {
-				mainScene.updateScores(char.ID)
-				break
-			}
-		}
-		mainScene.state = STATE_MAZE_CREATING
-	default:
+// updateConnectionStatus shows what the client is waiting for and reports whether it is connected.
+func (mainScene *MainScene) updateConnectionStatus(client connectionClient) bool {
+	if !client.Connected() {
+		mainScene.StatusUIText.SetText("reconnecting...")
+		return false
 	}
+	if len(mainScene.world.Maze) == 0 {
+		mainScene.StatusUIText.SetText("waiting for the host to start the match")
+	}
+
+	return true
 }
 
-func (mainScene *MainScene) updateCharacters(connectionMode string, server connectionServer) {
-	for i, char := range mainScene.Characters {
-		if !char.IsActive() {
-			continue
-		}
+// collectInputs reads the keyboards and gamepads of the players sitting at this machine,
+// the host brings the inputs of everybody else.
+// The host player chats as player 0, while typing or rebinding keys the local tanks stand still.
+func (mainScene *MainScene) collectInputs() []models.Input {
+	inputs := mainScene.localInputs
+	if mainScene.host != nil {
+		inputs = inputs[:mainScene.host.LocalPlayers()]
 
-		if connectionMode == CONNECTION_MODE_SERVER && i > 0 {
-			char.Input = server.GetInput(i)
-		} else {
-			char.Input.Update()
+		if text, ok := mainScene.updateChat(); ok {
+			mainScene.host.SendChat(0, text)
 		}
-
-		char.ProcessInput()
-		char.Move()
-		mainScene.DetectCharacterToWallCollision(char)
-		mainScene.collectItems(char, i)
 	}
-}
 
-func (mainScene *MainScene) updateBullets() {
-	for _, bullet := range mainScene.Bullets {
-		if !bullet.IsActive() {
+	mainScene.devices.Update()
+	for i := range inputs {
+		if mainScene.keyboardTaken() {
+			inputs[i].Reset()
 			continue
 		}
-
-		bullet.Move()
-		mainScene.DetectBulletToWallCollision(bullet)
-		mainScene.detectBulletHitsCharacters(bullet)
+		mainScene.devices.Read(i, &inputs[i])
 	}
-}
 
-func (mainScene *MainScene) detectBulletHitsCharacters(bullet *models.Bullet) {
-	for _, char := range mainScene.Characters {
-		if !char.IsActive() {
-			continue
-		}
+	return inputs
+}
 
-		if char.DetectBulletToCharacterCollision(bullet) {
-			bullet.SetActive(false)
-			char.SetActive(false)
-			mainScene.leftAlive--
+func (mainScene *MainScene) handleEvents(events []sim.Event) {
+	for _, event := range events {
+		switch event.Type {
+		case sim.EVENT_ROUND_STARTED:
+			mainScene.startNewRound()
+		case sim.EVENT_ITEM_SPAWNED:
+			mainScene.addItemView(event.Item)
+		case sim.EVENT_ROUND_ENDED:
+			mainScene.syncScoreUITexts()
 		}
 	}
 }
 
-func (mainScene *MainScene) collectItems(char *character.Character, charIndex int) {
-	for _, item := range mainScene.Items {
-		if !item.DetectCharacterCollision(char) {
-			continue
-		}
+func (mainScene *MainScene) startNewRound() {
+	world := mainScene.world
 
-		item.SetActive(false)
-		mainScene.applyItemEffect(item, char, charIndex)
+	mainScene.Reset()
+	for i := range mainScene.localInputs {
+		mainScene.localInputs[i].Reset()
 	}
-}
 
-func (mainScene *MainScene) syncToClient(server connectionServer) {
-	msg, err := json.Marshal(mainScene)
-	if err != nil {
-		log.Fatal(err)
-	}
+	log.Printf("round seed %d\n", world.Seed)
 
-	if err := server.WriteThingsMessage(msg); err != nil {
-		log.Fatal(err)
-	}
+	mainScene.SetDrawingSettings(world.H, world.W)
+
+	mainScene.SanityCheck()
 }
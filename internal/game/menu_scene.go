@@ -1,19 +1,134 @@
 package game
 
 import (
-	"myebiten/internal/models"
+	"fmt"
+	"strconv"
+
+	"myebiten/internal/discovery"
+	"myebiten/internal/protocol"
+	"myebiten/internal/ui"
 
 	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
 )
 
+const MENU_SERVER_LINES = 10
+
+// MenuScene is the server browser, it lists servers announcing themselves on the local network.
 type MenuScene struct {
-	models.SceneUI
+	ui.SceneUI
+
+	listener    *discovery.Listener
+	servers     []discovery.Server
+	selected    int
+	serverTexts []ui.UIText
+	hintText    ui.UIText
+	// why joining the selected server failed, cleared when another one is selected
+	joinError string
+
+	join func(address string) error
+}
+
+func CreateMenuScene(discoveryPort int, join func(address string) error) (*MenuScene, error) {
+	listener, err := discovery.Listen(":" + strconv.Itoa(discoveryPort))
+	if err != nil {
+		return nil, err
+	}
+
+	menuScene := &MenuScene{
+		SceneUI:     ui.CreateSceneUI(ebiten.NewImage(SCREEN_SIZE_WIDTH, SCREEN_SIZE_HEIGHT), float64(SCREEN_SIZE_HEIGHT), float64(SCREEN_SIZE_WIDTH)),
+		listener:    listener,
+		serverTexts: make([]ui.UIText, MENU_SERVER_LINES),
+		hintText:    ui.CreateUIText("", REGULAR_FONT),
+		join:        join,
+	}
+
+	lineHeight := menuScene.GetRootArea().Height / 20
+	for i := range menuScene.serverTexts {
+		menuScene.serverTexts[i] = ui.CreateUIText("", REGULAR_FONT)
+		addTextLine(&menuScene.SceneUI, &menuScene.serverTexts[i], fmt.Sprintf("menu_server_%d", i), float64(i+2)*lineHeight)
+	}
+	addTextLine(&menuScene.SceneUI, &menuScene.hintText, "menu_hint", float64(MENU_SERVER_LINES+3)*lineHeight)
+
+	return menuScene, nil
 }
 
 func (menuScene *MenuScene) Update() error {
+	if menuScene.listener == nil {
+		return nil
+	}
+
+	menuScene.servers = menuScene.listener.Servers()
+	if inpututil.IsKeyJustPressed(ebiten.KeyArrowDown) {
+		menuScene.selected++
+		menuScene.joinError = ""
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyArrowUp) {
+		menuScene.selected--
+		menuScene.joinError = ""
+	}
+	menuScene.selected = max(0, min(menuScene.selected, len(menuScene.servers)-1))
+
+	for i := range menuScene.serverTexts {
+		menuScene.serverTexts[i].SetText(menuScene.serverText(i))
+	}
+
+	switch {
+	case len(menuScene.servers) == 0:
+		menuScene.hintText.SetText("looking for servers on the local network...")
+		return nil
+	case menuScene.joinError != "":
+		menuScene.hintText.SetText(menuScene.joinError)
+	default:
+		menuScene.hintText.SetText("UP / DOWN to choose a server, ENTER to join")
+	}
+
+	if !inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
+		return nil
+	}
+
+	server := menuScene.servers[menuScene.selected]
+	if server.ProtocolVersion != protocol.VERSION {
+		menuScene.joinError = fmt.Sprintf("%s speaks protocol version %d, we speak %d", server.Name, server.ProtocolVersion, protocol.VERSION)
+		return nil
+	}
+
+	if err := menuScene.join(server.Address); err != nil {
+		menuScene.joinError = err.Error()
+		return nil
+	}
+
+	menuScene.listener.Close()
+	menuScene.listener = nil
 	return nil
 }
 
+func (menuScene *MenuScene) serverText(i int) string {
+	if i >= len(menuScene.servers) {
+		return ""
+	}
+
+	server := menuScene.servers[i]
+	cursor := "  "
+	if i == menuScene.selected {
+		cursor = "> "
+	}
+
+	text := fmt.Sprintf("%s%s  %s  players %d/%d  maze %d-%d x %d-%d",
+		cursor, server.Name, server.Address,
+		server.PlayersConnected, server.PlayersCount,
+		server.MinMazeHeight, server.MaxMazeHeight, server.MinMazeWidth, server.MaxMazeWidth)
+	if server.ProtocolVersion != protocol.VERSION {
+		text += fmt.Sprintf("  incompatible version %d", server.ProtocolVersion)
+	}
+
+	return text
+}
+
 func (menuScene *MenuScene) Draw() *ebiten.Image {
-	return nil
+	if menuScene.join == nil {
+		return nil
+	}
+
+	return menuScene.SceneUI.Draw()
 }
@@ -0,0 +1,136 @@
+package game
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"myebiten/internal/models"
+	"myebiten/internal/models/character"
+	"myebiten/internal/protocol"
+	"myebiten/internal/sim"
+)
+
+const (
+	// errors bigger than this are respawns or teleports and are not smoothed
+	PREDICTION_SNAP_DISTANCE = 100.0
+	// the remaining prediction error shrinks e times every PREDICTION_CORRECTION_TIME
+	PREDICTION_CORRECTION_TIME = 30 * time.Millisecond
+)
+
+type pendingInput struct {
+	sequence uint64
+	input    models.Input
+}
+
+// prediction moves the local tank right away instead of waiting for the server.
+// Inputs stay pending until a snapshot acks them, then the tank is put where
+// the server says and the unacked inputs are replayed on top.
+type prediction struct {
+	inputSequence uint64
+	pending       []pendingInput
+
+	// offset is drawn on top of the predicted tank to hide corrections
+	offset         models.Vector2D
+	rotationOffset float64
+
+	// base is the server state of the tank in the last snapshot, verify replays the next one from it
+	base     protocol.EntityState
+	baseAck  uint64
+	baseTick uint64
+	// only the first divergence is logged
+	diverged bool
+}
+
+// nextInput numbers input and keeps it until the server acks it.
+func (p *prediction) nextInput(input models.Input) uint64 {
+	p.inputSequence++
+	p.pending = append(p.pending, pendingInput{sequence: p.inputSequence, input: input})
+	return p.inputSequence
+}
+
+// reconcile is called after the server state of the tank was applied to world.
+// shownPosition and shownRotation are what was on screen before that.
+func (p *prediction) reconcile(world *sim.World, playerID int, inputAck uint64, shownPosition models.Vector2D, shownRotation float64) {
+	acked := 0
+	for acked < len(p.pending) && p.pending[acked].sequence <= inputAck {
+		acked++
+	}
+	p.pending = append(p.pending[:0], p.pending[acked:]...)
+
+	for _, pending := range p.pending {
+		world.PredictCharacter(playerID, pending.input)
+	}
+
+	if playerID < 0 || playerID >= len(world.Characters) {
+		return
+	}
+
+	char := world.Characters[playerID]
+	p.offset = models.Vector2D{X: shownPosition.X - char.Position.X, Y: shownPosition.Y - char.Position.Y}
+	p.rotationOffset = math.Remainder(shownRotation-char.Rotation, 2*math.Pi)
+	if p.offset.Length() > PREDICTION_SNAP_DISTANCE {
+		p.offset = models.Vector2D{}
+		p.rotationOffset = 0
+	}
+}
+
+// verify replays the inputs a snapshot acks on the state of the previous snapshot and compares the tank
+// with the state of the server, a client simulating the tank unlike the server ends up elsewhere.
+// Snapshots where the server didn't simulate exactly one new input per tick, lost or repeated inputs,
+// can't be replayed and are skipped. It returns the first divergence, world is set by the caller right after.
+func (p *prediction) verify(world *sim.World, playerID int, state protocol.EntityState, inputAck, tick uint64) (string, bool) {
+	base, baseAck, baseTick := p.base, p.baseAck, p.baseTick
+	p.base, p.baseAck, p.baseTick = state, inputAck, tick
+	if p.diverged || !base.Active || !state.Active || inputAck <= baseAck || tick <= baseTick || tick-baseTick != inputAck-baseAck {
+		return "", false
+	}
+	if playerID < 0 || playerID >= len(world.Characters) {
+		return "", false
+	}
+
+	char := world.Characters[playerID]
+	copyCharacter(char, base)
+	replayed := uint64(0)
+	for _, pending := range p.pending {
+		if pending.sequence > baseAck && pending.sequence <= inputAck {
+			world.PredictCharacter(playerID, pending.input)
+			replayed++
+		}
+	}
+	if replayed != inputAck-baseAck {
+		return "", false
+	}
+
+	// snapshots round the base, so a wall may stop the replayed tank a tick earlier or later than on the server,
+	// rotations only differ by the rounding
+	maxDistance := 1.5*models.PerTick(character.CHARACTER_SPEED, world.TickRate) + 1.0/protocol.POSITION_SCALE
+	maxRotation := models.PerTick(character.CHARACTER_ROTATION_SPEED, world.TickRate) / 2
+	distance := models.Vector2D{X: char.Position.X - state.Position.X, Y: char.Position.Y - state.Position.Y}.Length()
+	rotation := math.Abs(math.Remainder(char.Rotation-state.Rotation, 2*math.Pi))
+	if distance <= maxDistance && rotation <= maxRotation || distance > PREDICTION_SNAP_DISTANCE {
+		// bigger jumps are respawns of a new round whose maze hasn't arrived yet
+		return "", false
+	}
+
+	p.diverged = true
+	return fmt.Sprintf("replaying inputs %d-%d from tick %d moved the tank to (%.2f, %.2f) rotation %.4f, the server has (%.2f, %.2f) rotation %.4f at tick %d",
+		baseAck+1, inputAck, baseTick, char.Position.X, char.Position.Y, char.Rotation,
+		state.Position.X, state.Position.Y, state.Rotation, tick), true
+}
+
+// decay shrinks the correction by how long the frame took so the tank slides to its real place.
+func (p *prediction) decay(elapsed time.Duration) {
+	kept := math.Exp(-elapsed.Seconds() / PREDICTION_CORRECTION_TIME.Seconds())
+	p.offset.X *= kept
+	p.offset.Y *= kept
+	p.rotationOffset *= kept
+}
+
+func (p *prediction) reset() {
+	p.pending = p.pending[:0]
+	// a new maze puts the tank somewhere else, there is nothing to replay from
+	p.base = protocol.EntityState{}
+	p.offset = models.Vector2D{}
+	p.rotationOffset = 0
+}
@@ -0,0 +1,183 @@
+package game
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"myebiten/internal/controls"
+	"myebiten/internal/models"
+	"myebiten/internal/ui"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+const REBIND_AREA_ID = "rebind_area"
+
+// rebindScreen shows the keys of the players at this machine over the playing area, F2 toggles it.
+// Arrows pick an action, ENTER waits for the key to bind to it. Keys another action has are refused,
+// every change is saved to the bindings file if there is one. While it is open the local tanks stand still.
+type rebindScreen struct {
+	open      bool
+	capturing bool
+	player    int
+	action    int
+	// message tells why the last key was refused or the bindings couldn't be saved
+	message string
+	// unsavedShown is set once the players were told that without a path changes aren't saved
+	unsavedShown bool
+
+	bindings controls.Bindings
+	path     string
+	keys     []ebiten.Key
+
+	lines []ui.UIText
+}
+
+func newRebindScreen() *rebindScreen {
+	screen := &rebindScreen{lines: make([]ui.UIText, MAX_LOCAL_PLAYERS+2)}
+	for i := range screen.lines {
+		screen.lines[i] = ui.CreateUIText("", REGULAR_FONT)
+	}
+
+	return screen
+}
+
+func (screen *rebindScreen) addTo(scene *ui.SceneUI) {
+	mainArea := scene.GetArea(MAIN_PLAYING_AREA_ID)
+	lineHeight := scene.GetRootArea().Height / 40
+	for i := range screen.lines {
+		areaID := fmt.Sprintf("%s_%d", REBIND_AREA_ID, i)
+		area := scene.GetRootArea().NewArea(
+			lineHeight,
+			mainArea.Width,
+			ui.DrawingSettings{
+				Offset: models.Vector2D{X: 0.3 * mainArea.Width, Y: mainArea.Offset.Y + mainArea.Height/3 + float64(i)*lineHeight},
+				Scale:  1.0,
+			})
+		scene.AddDrawingArea(areaID, area)
+		scene.AddObject(&screen.lines[i], areaID)
+	}
+}
+
+// uiObjectsCount is how many objects addTo adds.
+func (screen *rebindScreen) uiObjectsCount() int {
+	return len(screen.lines)
+}
+
+// update reads the keyboard for the screen, devices play with the bindings once they changed.
+// Without players at this machine there is nothing to rebind.
+func (screen *rebindScreen) update(devices *controls.Devices) {
+	if devices == nil {
+		return
+	}
+	players := min(devices.Players(), len(screen.bindings))
+
+	switch {
+	case screen.capturing:
+		screen.capture(devices)
+	case inpututil.IsKeyJustPressed(ebiten.KeyF2):
+		screen.open = !screen.open
+		screen.message = ""
+	case !screen.open:
+	case inpututil.IsKeyJustPressed(ebiten.KeyEscape):
+		screen.open = false
+	case inpututil.IsKeyJustPressed(ebiten.KeyEnter):
+		screen.capturing = true
+		screen.message = ""
+	case inpututil.IsKeyJustPressed(ebiten.KeyArrowUp):
+		screen.player = (screen.player + players - 1) % players
+	case inpututil.IsKeyJustPressed(ebiten.KeyArrowDown):
+		screen.player = (screen.player + 1) % players
+	case inpututil.IsKeyJustPressed(ebiten.KeyArrowLeft):
+		screen.action = (screen.action + len(controls.ACTIONS) - 1) % len(controls.ACTIONS)
+	case inpututil.IsKeyJustPressed(ebiten.KeyArrowRight):
+		screen.action = (screen.action + 1) % len(controls.ACTIONS)
+	}
+
+	screen.player = min(screen.player, players-1)
+	screen.syncTexts(players)
+}
+
+// capture binds the next key pressed to the selected action, ESC gives up.
+func (screen *rebindScreen) capture(devices *controls.Devices) {
+	screen.keys = inpututil.AppendJustPressedKeys(screen.keys[:0])
+	if len(screen.keys) == 0 {
+		return
+	}
+
+	key := screen.keys[0]
+	screen.capturing = false
+	if key == ebiten.KeyEscape {
+		return
+	}
+	if err := screen.bindings.CheckKey(screen.player, screen.action, key); err != nil {
+		screen.message = err.Error() + ", pick another key"
+		return
+	}
+
+	screen.bindings[screen.player].SetKey(screen.action, key)
+	devices.SetBindings(screen.bindings)
+	if screen.path == "" {
+		if !screen.unsavedShown {
+			screen.unsavedShown = true
+			screen.message = "no bindings file, changes last until the game closes"
+		}
+		return
+	}
+	if err := controls.SaveBindings(screen.path, screen.bindings); err != nil {
+		log.Println(err)
+		screen.message = "not saved: " + err.Error()
+	}
+}
+
+func (screen *rebindScreen) syncTexts(players int) {
+	for i := range screen.lines {
+		screen.lines[i].SetActive(screen.open && i < players+2)
+	}
+	if !screen.open {
+		return
+	}
+
+	for player := range players {
+		screen.lines[player].SetText(screen.layoutText(player))
+	}
+
+	hint := "ARROWS to choose, ENTER to rebind, F2 or ESC to close"
+	if screen.capturing {
+		hint = fmt.Sprintf("press the key for %s of player %d, ESC to keep %s",
+			controls.ACTIONS[screen.action], screen.player, screen.bindings[screen.player].Key(screen.action))
+	}
+	screen.lines[players].SetText(hint)
+	screen.lines[players+1].SetText(screen.message)
+}
+
+// layoutText lists the keys of player, the selected action is bracketed.
+func (screen *rebindScreen) layoutText(player int) string {
+	var text strings.Builder
+	fmt.Fprintf(&text, "player %d:", player)
+	for action, name := range controls.ACTIONS {
+		key := screen.bindings[player].Key(action).String()
+		if player == screen.player && action == screen.action {
+			key = "[" + key + "]"
+		}
+		fmt.Fprintf(&text, "  %s %s", strings.ReplaceAll(name, "_", " "), key)
+	}
+
+	return text.String()
+}
+
+// updateChat updates the chat unless the rebind screen has the keyboard, see chat.update.
+func (mainScene *MainScene) updateChat() (string, bool) {
+	if mainScene.rebind.open {
+		return "", false
+	}
+
+	return mainScene.chat.update()
+}
+
+// keyboardTaken tells whether the chat or the rebind screen gets the keys instead of the tanks.
+func (mainScene *MainScene) keyboardTaken() bool {
+	return mainScene.chat.open || mainScene.rebind.open
+}
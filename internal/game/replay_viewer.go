@@ -0,0 +1,155 @@
+package game
+
+import (
+	"fmt"
+	"time"
+
+	"myebiten/internal/protocol"
+	"myebiten/internal/replay"
+	"myebiten/internal/sim"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+var REPLAY_SPEEDS = []float64{0.25, 0.5, 1, 2, 4, 8}
+
+// REPLAY_NORMAL_SPEED is the index of 1x in REPLAY_SPEEDS
+const REPLAY_NORMAL_SPEED = 2
+
+// replayViewer plays a recorded match in the main scene. The match is re-simulated by the replay player,
+// the scene shows its world like a spectator sees a server: through snapshots and the camera.
+// SPACE pauses, [ and ] change the speed, . steps one tick while paused,
+// R seeks to the start of the round, PAGE UP and PAGE DOWN to the previous and next round, HOME to the first one.
+type replayViewer struct {
+	player *replay.Player
+	paused bool
+	speed  int
+	// the part of a tick earlier frames were owed
+	pendingTicks float64
+	snapshot     protocol.Snapshot
+}
+
+func newReplayViewer(player *replay.Player) *replayViewer {
+	return &replayViewer{player: player, speed: REPLAY_NORMAL_SPEED}
+}
+
+// ticksDue reads the playback keys and returns how many ticks to play this frame.
+func (viewer *replayViewer) ticksDue(elapsed time.Duration) int {
+	if inpututil.IsKeyJustPressed(ebiten.KeySpace) {
+		viewer.paused = !viewer.paused
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyBracketLeft) {
+		viewer.speed = max(viewer.speed-1, 0)
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyBracketRight) {
+		viewer.speed = min(viewer.speed+1, len(REPLAY_SPEEDS)-1)
+	}
+
+	if viewer.paused {
+		viewer.pendingTicks = 0
+		if inpututil.IsKeyJustPressed(ebiten.KeyPeriod) {
+			return 1
+		}
+		return 0
+	}
+
+	viewer.pendingTicks += elapsed.Seconds() * REPLAY_SPEEDS[viewer.speed] * float64(viewer.player.Header().TickRate)
+	ticks := int(viewer.pendingTicks)
+	viewer.pendingTicks -= float64(ticks)
+	return ticks
+}
+
+// seekTarget reads the seek keys and returns the index of the round to go to.
+func (viewer *replayViewer) seekTarget() (int, bool) {
+	current := max(viewer.player.RoundIndex(), 0)
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyR):
+		return current, true
+	case inpututil.IsKeyJustPressed(ebiten.KeyPageUp):
+		return max(current-1, 0), true
+	case inpututil.IsKeyJustPressed(ebiten.KeyPageDown):
+		return min(current+1, len(viewer.player.RoundStarts())-1), true
+	case inpututil.IsKeyJustPressed(ebiten.KeyHome):
+		return 0, true
+	}
+
+	return 0, false
+}
+
+func (viewer *replayViewer) statusText(camera *camera) string {
+	player := viewer.player
+	state := fmt.Sprintf("%gx", REPLAY_SPEEDS[viewer.speed])
+	if viewer.paused {
+		state = "paused"
+	}
+	if player.Ended() {
+		state = "ended"
+	}
+
+	text := fmt.Sprintf("replay %s, tick %d of %d, round %d of %d", state, player.World.Tick, player.EndTick(),
+		player.RoundIndex()+1, len(player.RoundStarts()))
+	if camera.follow {
+		text += fmt.Sprintf(", following player %d", camera.followedID)
+	}
+	if desync, ok := player.Desync(); ok {
+		text += fmt.Sprintf(", DESYNC at tick %d", desync.Tick)
+	}
+
+	return text
+}
+
+// updateReplayFrame plays the ticks due this frame and shows where the match got to.
+func (mainScene *MainScene) updateReplayFrame() error {
+	viewer := mainScene.replay
+	elapsed := mainScene.frameTime(time.Now())
+
+	if round, ok := viewer.seekTarget(); ok {
+		viewer.player.Seek(viewer.player.RoundStarts()[round])
+		// the tick starting the round builds its maze
+		mainScene.handleReplayEvents(viewer.player.Step())
+	}
+	for range viewer.ticksDue(elapsed) {
+		mainScene.handleReplayEvents(viewer.player.Step())
+	}
+	mainScene.showReplayWorld()
+
+	if len(mainScene.world.Maze) > 0 {
+		mainScene.camera.update(mainScene.world, elapsed)
+		mainScene.camera.apply(mainScene.GetArea(MAZE_AREA_ID))
+	}
+	mainScene.StatusUIText.SetText(viewer.statusText(mainScene.camera))
+	return nil
+}
+
+func (mainScene *MainScene) handleReplayEvents(events []sim.Event) {
+	for _, event := range events {
+		if event.Type != sim.EVENT_ROUND_STARTED {
+			continue
+		}
+
+		world := mainScene.world
+		h, w, _ := world.BuildLevel(mainScene.replay.player.World.Seed)
+		world.Reset()
+		mainScene.Reset()
+		mainScene.SetDrawingSettings(h, w)
+	}
+}
+
+// showReplayWorld copies the re-simulated world into the one the scene draws.
+func (mainScene *MainScene) showReplayWorld() {
+	snapshot := &mainScene.replay.snapshot
+	protocol.CaptureSnapshot(mainScene.replay.player.World, snapshot)
+
+	world := mainScene.world
+	world.Tick = snapshot.Tick
+	copy(world.CharactersScores, snapshot.Scores)
+	mainScene.syncScoreUITexts()
+	for i, state := range snapshot.Characters {
+		if i < len(world.Characters) {
+			copyCharacter(world.Characters[i], state)
+		}
+	}
+	copyBullets(world.Bullets, snapshot.Bullets)
+	world.Items = mainScene.copyItems(snapshot.Items)
+}
@@ -0,0 +1,127 @@
+package game
+
+import (
+	"fmt"
+	"time"
+
+	"myebiten/internal/models"
+	"myebiten/internal/netstats"
+	"myebiten/internal/ui"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+const STATS_AREA_ID = "stats_area"
+
+// statsOverlay shows the network stats over the top left corner of the playing area, F3 toggles it.
+// Hosts see a line per remote player, clients see their own connections.
+type statsOverlay struct {
+	visible bool
+	lines   []ui.UIText
+	texts   []string
+}
+
+func newStatsOverlay(playersCount int) *statsOverlay {
+	overlay := &statsOverlay{lines: make([]ui.UIText, max(playersCount, 2+MAX_LOCAL_PLAYERS))}
+	for i := range overlay.lines {
+		overlay.lines[i] = ui.CreateUIText("", REGULAR_FONT)
+	}
+
+	return overlay
+}
+
+func (overlay *statsOverlay) addTo(scene *ui.SceneUI) {
+	mainArea := scene.GetArea(MAIN_PLAYING_AREA_ID)
+	lineHeight := scene.GetRootArea().Height / 40
+	for i := range overlay.lines {
+		areaID := fmt.Sprintf("%s_%d", STATS_AREA_ID, i)
+		area := scene.GetRootArea().NewArea(
+			lineHeight,
+			mainArea.Width,
+			ui.DrawingSettings{
+				Offset: models.Vector2D{X: 0.02 * mainArea.Width, Y: mainArea.Offset.Y + float64(i+1)*lineHeight},
+				Scale:  1.0,
+			})
+		scene.AddDrawingArea(areaID, area)
+		scene.AddObject(&overlay.lines[i], areaID)
+	}
+}
+
+// uiObjectsCount is how many objects addTo adds.
+func (overlay *statsOverlay) uiObjectsCount() int {
+	return len(overlay.lines)
+}
+
+func (overlay *statsOverlay) show(texts []string) {
+	for i := range overlay.lines {
+		line := &overlay.lines[i]
+		line.SetActive(overlay.visible && i < len(texts))
+		if i < len(texts) {
+			line.SetText(texts[i])
+		}
+	}
+}
+
+// updateNetStats toggles the overlay and fills it, offline there is no network to show.
+func (mainScene *MainScene) updateNetStats() {
+	overlay := mainScene.netStats
+	if inpututil.IsKeyJustPressed(ebiten.KeyF3) {
+		overlay.visible = !overlay.visible
+	}
+
+	texts := overlay.texts[:0]
+	if overlay.visible {
+		switch {
+		case mainScene.host != nil:
+			texts = mainScene.hostStatsTexts(texts)
+		case mainScene.getConnectionMode() == CONNECTION_MODE_CLIENT:
+			texts = mainScene.clientStatsTexts(texts)
+		}
+	}
+	overlay.texts = texts
+	overlay.show(texts)
+}
+
+func (mainScene *MainScene) hostStatsTexts(texts []string) []string {
+	matchHost := mainScene.host
+	for playerID := matchHost.LocalPlayers(); playerID < mainScene.world.PlayersCount; playerID++ {
+		switch {
+		case matchHost.IsBot(playerID):
+			texts = append(texts, fmt.Sprintf("player %d: bot", playerID))
+		case matchHost.IsConnected(playerID):
+			texts = append(texts, fmt.Sprintf("player %d: %s", playerID, statsText(matchHost.PlayerStats(playerID))))
+		default:
+			texts = append(texts, fmt.Sprintf("player %d: not connected", playerID))
+		}
+	}
+
+	return texts
+}
+
+// clientStatsTexts describes our connection and how old the snapshots we render are,
+// then the connections of the other players at this keyboard.
+func (mainScene *MainScene) clientStatsTexts(texts []string) []string {
+	stats := mainScene.getGameClient().Counters().Stats()
+	age := mainScene.interpolation.Age(time.Now(), &mainScene.renderSnapshot) + stats.RTT/2
+
+	texts = append(texts,
+		statsText(stats),
+		fmt.Sprintf("rendering snapshots %s old", age.Round(time.Millisecond)),
+		fmt.Sprintf("snapshots dropped %d, late %d", stats.DroppedSnapshots, stats.LateSnapshots),
+	)
+	for i, seat := range mainScene.seats {
+		if i > 0 {
+			texts = append(texts, fmt.Sprintf("player %d: %s", seat.playerID(), statsText(seat.client.Counters().Stats())))
+		}
+	}
+
+	return texts
+}
+
+func statsText(stats netstats.Stats) string {
+	return fmt.Sprintf("rtt %s, in %.0f msg/s %.1f kB/s, out %.0f msg/s %.1f kB/s",
+		stats.RTT.Round(time.Millisecond),
+		stats.MessagesInPerSecond, stats.BytesInPerSecond/1000,
+		stats.MessagesOutPerSecond, stats.BytesOutPerSecond/1000)
+}
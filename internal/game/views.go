@@ -0,0 +1,59 @@
+package game
+
+import (
+	"myebiten/internal/models"
+	"myebiten/internal/models/character"
+	"myebiten/internal/models/item"
+	"myebiten/internal/ui"
+)
+
+// Views draw the state of sim entities on the scene, the sim itself never touches ebiten.
+
+type characterView struct {
+	*character.Character
+	sprite       ui.ImageSprite
+	markerSprite ui.CircleSprite
+
+	// offsets hide prediction corrections of the local tank
+	offset         models.Vector2D
+	rotationOffset float64
+}
+
+func (v *characterView) Draw(drawingArea *ui.DrawingArea) {
+	x := v.Position.X + v.offset.X
+	y := v.Position.Y + v.offset.Y
+
+	v.sprite.Draw(x, y, v.Rotation+v.rotationOffset, drawingArea)
+	v.markerSprite.Draw(x, y, drawingArea)
+}
+
+type bulletView struct {
+	*models.Bullet
+}
+
+func (v *bulletView) Draw(drawingArea *ui.DrawingArea) {
+	ui.CircleSprite{R: v.R}.Draw(v.Position.X, v.Position.Y, drawingArea)
+}
+
+type wallView struct {
+	*models.Wall
+}
+
+func (v *wallView) Draw(drawingArea *ui.DrawingArea) {
+	sprite := ui.RectangleSprite{W: v.Hitbox.W, H: v.Hitbox.H}
+	sprite.Draw(v.Position.X, v.Position.Y, v.Rotation, drawingArea)
+}
+
+type itemView struct {
+	*item.Item
+}
+
+func (v *itemView) Draw(drawingArea *ui.DrawingArea) {
+	if drawingArea == nil {
+		return
+	}
+
+	if sprite := getItemSprite(v.Type); sprite != nil {
+		sprite.Draw(v.Position.X, v.Position.Y, 0.0, drawingArea)
+	}
+}
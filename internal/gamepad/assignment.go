@@ -0,0 +1,126 @@
+package gamepad
+
+import "myebiten/internal/models"
+
+// Change is a gamepad joining a player or leaving it because it was unplugged.
+type Change struct {
+	Player  int
+	Gamepad ID
+	Name    string
+	Joined  bool
+}
+
+// Assignment binds gamepads to the players at one machine. Players start without a gamepad,
+// a button pressed on a free gamepad binds it to the first player without one and unplugging it
+// frees the player again. It only sees the states it is given, so any made up states drive it.
+type Assignment struct {
+	// gamepads[player] is the gamepad of player while bound[player] is set
+	gamepads []ID
+	bound    []bool
+	// armed is false from joining until every button is up, the button pressed to join doesn't shoot
+	armed []bool
+	// unplugged players stop once, whatever the gamepad held must not keep driving the tank
+	unplugged []bool
+	// held are the gamepads with a button down last frame, holding a button joins only once
+	held map[ID]bool
+}
+
+func NewAssignment(players int) *Assignment {
+	return &Assignment{
+		gamepads:  make([]ID, players),
+		bound:     make([]bool, players),
+		armed:     make([]bool, players),
+		unplugged: make([]bool, players),
+		held:      map[ID]bool{},
+	}
+}
+
+// Update follows the gamepads connected this frame and appends what changed to dst.
+func (assignment *Assignment) Update(gamepads []State, dst []Change) []Change {
+	for player, bound := range assignment.bound {
+		if !bound {
+			continue
+		}
+
+		id := assignment.gamepads[player]
+		state := find(gamepads, id)
+		if state == nil {
+			assignment.bound[player] = false
+			assignment.unplugged[player] = true
+			dst = append(dst, Change{Player: player, Gamepad: id})
+			continue
+		}
+		if !state.AnyButton {
+			assignment.armed[player] = true
+		}
+	}
+
+	for id := range assignment.held {
+		if find(gamepads, id) == nil {
+			delete(assignment.held, id)
+		}
+	}
+
+	for i := range gamepads {
+		state := &gamepads[i]
+		pressed := state.AnyButton && !assignment.held[state.ID]
+		assignment.held[state.ID] = state.AnyButton
+		if !pressed || assignment.Player(state.ID) >= 0 {
+			continue
+		}
+
+		player := assignment.firstFree()
+		if player < 0 {
+			continue
+		}
+		assignment.gamepads[player] = state.ID
+		assignment.bound[player] = true
+		assignment.armed[player] = false
+		assignment.unplugged[player] = false
+		dst = append(dst, Change{Player: player, Gamepad: state.ID, Name: state.Name, Joined: true})
+	}
+
+	return dst
+}
+
+// Player returns the player the gamepad id is bound to, -1 when it is free.
+func (assignment *Assignment) Player(id ID) int {
+	for player, bound := range assignment.bound {
+		if bound && assignment.gamepads[player] == id {
+			return player
+		}
+	}
+
+	return -1
+}
+
+func (assignment *Assignment) firstFree() int {
+	for player, bound := range assignment.bound {
+		if !bound {
+			return player
+		}
+	}
+
+	return -1
+}
+
+// Map applies the gamepad of player to in and reports whether the player has one,
+// players without a gamepad play on their keyboard layout.
+func (assignment *Assignment) Map(player int, gamepads []State, in *models.Input) bool {
+	if player < 0 || player >= len(assignment.bound) {
+		return false
+	}
+	if assignment.unplugged[player] {
+		assignment.unplugged[player] = false
+		in.Reset()
+	}
+	if !assignment.bound[player] {
+		return false
+	}
+
+	in.Reset()
+	if state := find(gamepads, assignment.gamepads[player]); state != nil && assignment.armed[player] {
+		Map(state, in)
+	}
+	return true
+}
@@ -0,0 +1,132 @@
+package gamepad
+
+import (
+	"testing"
+
+	"myebiten/internal/models"
+)
+
+func TestButtonJoinsFirstFreePlayer(t *testing.T) {
+	assignment := NewAssignment(3)
+	gamepads := []State{{ID: 7}, {ID: 9}}
+
+	if changes := assignment.Update(gamepads, nil); len(changes) != 0 {
+		t.Fatalf("idle gamepads joined: %+v", changes)
+	}
+
+	gamepads[1].AnyButton = true
+	changes := assignment.Update(gamepads, nil)
+	if len(changes) != 1 || changes[0] != (Change{Player: 0, Gamepad: 9, Joined: true}) {
+		t.Fatalf("got %+v, want gamepad 9 joining player 0", changes)
+	}
+
+	// holding the button joins only once
+	if changes := assignment.Update(gamepads, nil); len(changes) != 0 {
+		t.Fatalf("held button joined again: %+v", changes)
+	}
+
+	gamepads[0].AnyButton = true
+	changes = assignment.Update(gamepads, nil)
+	if len(changes) != 1 || changes[0].Player != 1 || changes[0].Gamepad != 7 {
+		t.Fatalf("got %+v, want gamepad 7 joining player 1", changes)
+	}
+	if assignment.Player(9) != 0 || assignment.Player(7) != 1 || assignment.Player(8) != -1 {
+		t.Fatalf("gamepads 9, 7 and 8 belong to players %d, %d and %d", assignment.Player(9), assignment.Player(7), assignment.Player(8))
+	}
+}
+
+func TestJoinPressDoesNotShoot(t *testing.T) {
+	assignment := NewAssignment(1)
+	gamepads := []State{{ID: 1, AnyButton: true, ShootButton: true}}
+	assignment.Update(gamepads, nil)
+
+	in := models.Input{MoveForward: true}
+	if !assignment.Map(0, gamepads, &in) {
+		t.Fatal("player 0 has no gamepad")
+	}
+	if in != (models.Input{}) {
+		t.Fatalf("join press gave %+v, want nothing", in)
+	}
+
+	// still held
+	assignment.Update(gamepads, nil)
+	assignment.Map(0, gamepads, &in)
+	if in.Shoot {
+		t.Fatal("held join press shot")
+	}
+
+	gamepads[0] = State{ID: 1}
+	assignment.Update(gamepads, nil)
+	gamepads[0] = State{ID: 1, AnyButton: true, ShootButton: true}
+	assignment.Update(gamepads, nil)
+	assignment.Map(0, gamepads, &in)
+	if !in.Shoot {
+		t.Fatal("a press after releasing the join button didn't shoot")
+	}
+}
+
+func TestUnpluggedPlayerGetsKeyboardBack(t *testing.T) {
+	assignment := NewAssignment(2)
+	gamepads := []State{{ID: 3, AnyButton: true}}
+	assignment.Update(gamepads, nil)
+	gamepads[0] = State{ID: 3, StickY: -1}
+	assignment.Update(gamepads, nil)
+
+	var in models.Input
+	assignment.Map(0, gamepads, &in)
+	if !in.MoveForward {
+		t.Fatal("stick up didn't move forward")
+	}
+
+	changes := assignment.Update(nil, nil)
+	if len(changes) != 1 || changes[0] != (Change{Player: 0, Gamepad: 3}) {
+		t.Fatalf("got %+v, want gamepad 3 leaving player 0", changes)
+	}
+	if assignment.Map(0, nil, &in) {
+		t.Fatal("player 0 still plays with the unplugged gamepad")
+	}
+	if in != (models.Input{}) {
+		t.Fatalf("unplugging left %+v driving the tank", in)
+	}
+
+	// later the keyboard drives alone
+	in.RotateLeft = true
+	if assignment.Map(0, nil, &in) || !in.RotateLeft {
+		t.Fatal("the keyboard input was touched")
+	}
+
+	// plugged in again it has to join again, with whatever id it gets
+	gamepads = []State{{ID: 4, AnyButton: true}}
+	changes = assignment.Update(gamepads, nil)
+	if len(changes) != 1 || changes[0].Player != 0 || changes[0].Gamepad != 4 {
+		t.Fatalf("got %+v, want gamepad 4 joining player 0", changes)
+	}
+}
+
+func TestMap(t *testing.T) {
+	cases := []struct {
+		name  string
+		state State
+		want  models.Input
+	}{
+		{"at rest", State{}, models.Input{}},
+		{"stick inside the dead zone", State{StickX: DEAD_ZONE, StickY: -DEAD_ZONE}, models.Input{}},
+		{"stick right", State{StickX: DEAD_ZONE + 0.01}, models.Input{RotateRight: true}},
+		{"stick left", State{StickX: -0.9}, models.Input{RotateLeft: true}},
+		{"stick up", State{StickY: -0.9}, models.Input{MoveForward: true}},
+		{"stick down", State{StickY: 0.9}, models.Input{MoveBackward: true}},
+		{"diagonal", State{StickX: 0.7, StickY: -0.7}, models.Input{RotateRight: true, MoveForward: true}},
+		{"d-pad", State{DPadLeft: true, DPadDown: true}, models.Input{RotateLeft: true, MoveBackward: true}},
+		{"trigger at the threshold", State{Trigger: TRIGGER_THRESHOLD}, models.Input{}},
+		{"trigger pulled", State{Trigger: TRIGGER_THRESHOLD + 0.01}, models.Input{Shoot: true}},
+		{"shoot button", State{ShootButton: true}, models.Input{Shoot: true}},
+	}
+
+	for _, c := range cases {
+		in := models.Input{MoveForward: true, Shoot: true}
+		Map(&c.state, &in)
+		if in != c.want {
+			t.Errorf("%s: got %+v, want %+v", c.name, in, c.want)
+		}
+	}
+}
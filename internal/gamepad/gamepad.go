@@ -0,0 +1,53 @@
+package gamepad
+
+import "myebiten/internal/models"
+
+const (
+	// stick values closer to the center than DEAD_ZONE are a stick at rest
+	DEAD_ZONE = 0.35
+	// triggers shoot once pulled further than TRIGGER_THRESHOLD
+	TRIGGER_THRESHOLD = 0.5
+)
+
+type ID int
+
+// State is a gamepad as it was read this frame, controls reads it from ebiten.
+// The stick goes from -1 to 1 with up negative like on the screen, the trigger from 0 to 1.
+type State struct {
+	ID   ID
+	Name string
+
+	StickX  float64
+	StickY  float64
+	Trigger float64
+
+	DPadUp    bool
+	DPadDown  bool
+	DPadLeft  bool
+	DPadRight bool
+	// ShootButton is the button under the right thumb
+	ShootButton bool
+	// AnyButton is held while any button is down, pressing one joins a free gamepad to a player
+	AnyButton bool
+}
+
+// Map drives a tank with state: the stick or d-pad sideways rotates, up and down move, the trigger or
+// the shoot button shoots.
+func Map(state *State, in *models.Input) {
+	in.RotateRight = state.StickX > DEAD_ZONE || state.DPadRight
+	in.RotateLeft = state.StickX < -DEAD_ZONE || state.DPadLeft
+	in.MoveForward = state.StickY < -DEAD_ZONE || state.DPadUp
+	in.MoveBackward = state.StickY > DEAD_ZONE || state.DPadDown
+	in.Shoot = state.Trigger > TRIGGER_THRESHOLD || state.ShootButton
+}
+
+// find returns the state of the gamepad id, nil when it is not connected.
+func find(gamepads []State, id ID) *State {
+	for i := range gamepads {
+		if gamepads[i].ID == id {
+			return &gamepads[i]
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package host
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"myebiten/internal/netcond"
+	"myebiten/internal/replay"
+	"myebiten/internal/sim"
+	"myebiten/internal/websocket/server"
+)
+
+// MIN_PLAYERS_TO_START is the fewest players a match makes sense with, one tank alone wins every round.
+const MIN_PLAYERS_TO_START = 2
+
+// DedicatedConfig is what a dedicated server is started with.
+type DedicatedConfig struct {
+	Name          string
+	Port          string
+	DiscoveryPort int
+	PlayersCount  int
+	Seed          int64
+	// the world is stepped TickRate times per second, clients get SnapshotRate snapshots per second
+	TickRate     int
+	SnapshotRate int
+	// clients need it to claim a slot, empty lets anyone in
+	Password      string
+	NetConditions netcond.Config
+	// the match starts once this many players are connected, at least MIN_PLAYERS_TO_START and at most PlayersCount
+	MinPlayers   int
+	FillWithBots bool
+	// RecordPath is the replay file the match is recorded to, empty records nothing
+	RecordPath string
+}
+
+// RunDedicated hosts a match without a window and without a local player, every slot is remote.
+// It waits until MinPlayers clients connected and then steps the world on a fixed tick
+// until it is interrupted, a recorded match is finished on the way out.
+func RunDedicated(config DedicatedConfig) {
+	seed := config.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	log.Printf("match seed %d\n", seed)
+
+	log.Printf("ticking %d times per second, sending %d snapshots per second\n", config.TickRate, config.SnapshotRate)
+
+	gameServer := server.New(config.Port, config.PlayersCount, 0, config.Password, config.TickRate, config.NetConditions)
+	matchHost := New(sim.NewWorld(config.PlayersCount, seed, config.TickRate), gameServer, 0, config.SnapshotRate)
+	if _, err := matchHost.StartAnnouncing(config.Name, config.Port, config.DiscoveryPort); err != nil {
+		// the match works without it, clients just have to know the address
+		log.Println(err)
+	}
+
+	connected := make([]bool, config.PlayersCount)
+	waitForPlayers(matchHost, connected, max(MIN_PLAYERS_TO_START, min(config.MinPlayers, config.PlayersCount)))
+	matchHost.SetupSlots(connected, config.FillWithBots)
+	log.Println("match started")
+
+	var recorder *replay.Recorder
+	if config.RecordPath != "" {
+		var err error
+		if recorder, err = replay.Create(config.RecordPath, matchHost.World); err != nil {
+			log.Fatal(err)
+		}
+		matchHost.SetRecorder(recorder)
+	}
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt, syscall.SIGTERM)
+
+	tick := time.Second / time.Duration(config.TickRate)
+	next := time.Now()
+	for {
+		select {
+		case <-interrupted:
+			if recorder != nil {
+				if err := recorder.Close(matchHost.World); err != nil {
+					log.Println(err)
+				}
+			}
+			log.Println("server stopped")
+			return
+		default:
+		}
+
+		for _, event := range matchHost.Step(nil) {
+			logEvent(matchHost.World, event)
+			if event.Type == sim.EVENT_ROUND_ENDED {
+				if violations := gameServer.Violations(); len(violations) > 0 {
+					log.Printf("rule violations so far %v\n", violations)
+				}
+				logStats(matchHost)
+			}
+		}
+		for _, message := range matchHost.Chat() {
+			log.Printf("chat player %d: %s\n", message.Sender, message.Text)
+		}
+
+		next = next.Add(tick)
+		if wait := time.Until(next); wait > 0 {
+			time.Sleep(wait)
+		} else if wait < -time.Second {
+			// far behind, probably the machine was suspended, don't rush through the missed ticks
+			next = time.Now()
+		}
+	}
+}
+
+func waitForPlayers(matchHost *Host, connected []bool, minPlayers int) {
+	present := -1
+	for {
+		count := matchHost.ConnectedSlots(connected)
+		if count != present {
+			present = count
+			log.Printf("%d of %d players connected, the match starts with %d\n", present, len(connected), minPlayers)
+		}
+
+		if present >= minPlayers {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func logStats(matchHost *Host) {
+	for playerID := range matchHost.World.PlayersCount {
+		if !matchHost.IsConnected(playerID) {
+			continue
+		}
+
+		stats := matchHost.PlayerStats(playerID)
+		log.Printf("player %d rtt %s, in %.0f msg/s %.0f B/s, out %.0f msg/s %.0f B/s\n", playerID, stats.RTT.Round(time.Millisecond),
+			stats.MessagesInPerSecond, stats.BytesInPerSecond, stats.MessagesOutPerSecond, stats.BytesOutPerSecond)
+	}
+}
+
+func logEvent(world *sim.World, event sim.Event) {
+	switch event.Type {
+	case sim.EVENT_ROUND_STARTED:
+		log.Printf("round seed %d\n", world.Seed)
+	case sim.EVENT_ROUND_ENDED:
+		log.Printf("round won by player %d, scores %v\n", event.CharacterID, world.CharactersScores)
+	}
+}
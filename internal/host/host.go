@@ -0,0 +1,324 @@
+package host
+
+import (
+	"log"
+
+	"myebiten/internal/bot"
+	"myebiten/internal/discovery"
+	"myebiten/internal/models"
+	"myebiten/internal/netstats"
+	"myebiten/internal/protocol"
+	"myebiten/internal/replay"
+	"myebiten/internal/sim"
+)
+
+// DEFAULT_SNAPSHOT_RATE is how many snapshots per second clients get unless the server is told otherwise.
+const DEFAULT_SNAPSHOT_RATE = 60
+
+// STATE_HASH_INTERVAL is how many seconds apart snapshots carry a state hash for clients to check
+const STATE_HASH_INTERVAL = 0.5
+
+// Server is the part of the websocket server the host talks to.
+type Server interface {
+	GetInput(playerID int) (models.Input, uint64)
+	GetSnapshotAck(playerID int) uint64
+	WriteMessage(playerID int, message []byte) error
+	BroadcastMessage(message []byte) error
+	TakeJoinedPlayers(dst []int) []int
+	IsConnected(playerID int) bool
+
+	TakeJoinedSpectators(dst []int) []int
+	WriteSpectatorMessage(spectatorID int, message []byte) error
+	BroadcastToSpectators(message []byte) error
+	SpectatorsCount() int
+
+	TakeChat(dst []protocol.ChatMessage) []protocol.ChatMessage
+	TakeDesyncReports(dst []protocol.DesyncReport) []protocol.DesyncReport
+	PlayerStats(playerID int) netstats.Stats
+}
+
+// Host runs the authoritative match. Every tick it gathers inputs of local players,
+// remote players and bots and steps the world, snapshotRate times per second it sends every client its snapshot.
+// It draws nothing, the server window and the dedicated server both drive it.
+type Host struct {
+	World *sim.World
+
+	snapshotRate int
+
+	server Server
+	// the first localPlayers slots are played on the host machine, 0 on a dedicated server
+	localPlayers int
+	bots         []*bot.Bot
+	inputs       []models.Input
+	inputAcks    []uint64
+
+	snapshot         protocol.Snapshot
+	snapshotHistory  protocol.SnapshotHistory
+	snapshotSequence uint64
+	snapshotBuffer   []byte
+	joinedPlayers    []int
+	joinedSpectators []int
+	// the first tick whose snapshot carries a state hash again
+	nextStateHash uint64
+	desyncReports []protocol.DesyncReport
+
+	// chat lines of local players waiting for the next Step and the lines relayed by the last one
+	localChat  []protocol.ChatMessage
+	chat       []protocol.ChatMessage
+	chatBuffer []byte
+
+	// recorder writes every tick to a replay file when the match is recorded
+	recorder *replay.Recorder
+}
+
+// New hosts the match of world, snapshotRate is capped at the tick rate of the world.
+func New(world *sim.World, server Server, localPlayers, snapshotRate int) *Host {
+	return &Host{
+		World:        world,
+		snapshotRate: min(max(snapshotRate, 1), world.TickRate),
+		server:       server,
+		localPlayers: localPlayers,
+		bots:         make([]*bot.Bot, world.PlayersCount),
+		inputs:       make([]models.Input, world.PlayersCount),
+		inputAcks:    make([]uint64, world.PlayersCount),
+	}
+}
+
+// SetRecorder records the match from the next Step on, see replay.Create.
+func (host *Host) SetRecorder(recorder *replay.Recorder) {
+	host.recorder = recorder
+}
+
+func (host *Host) LocalPlayers() int {
+	return host.localPlayers
+}
+
+func (host *Host) SpectatorsCount() int {
+	return host.server.SpectatorsCount()
+}
+
+// PlayerStats describes the connection of a remote player.
+func (host *Host) PlayerStats(playerID int) netstats.Stats {
+	return host.server.PlayerStats(playerID)
+}
+
+func (host *Host) IsConnected(playerID int) bool {
+	return host.server.IsConnected(playerID)
+}
+
+// IsBot tells whether a bot plays the slot.
+func (host *Host) IsBot(playerID int) bool {
+	return playerID >= 0 && playerID < len(host.bots) && host.bots[playerID] != nil
+}
+
+// SetupSlots decides who plays the match once it is started.
+// Slots nobody connected to are given to bots or sit out until a player takes them.
+func (host *Host) SetupSlots(connected []bool, fillWithBots bool) {
+	for i := range host.World.Seated {
+		host.World.Seated[i] = connected[i] || fillWithBots
+		if !connected[i] && fillWithBots {
+			host.bots[i] = bot.New(i)
+		}
+	}
+}
+
+// ConnectedSlots fills connected with the slots that are played, local ones always are.
+// It returns how many there are.
+func (host *Host) ConnectedSlots(connected []bool) int {
+	count := 0
+	for i := range connected {
+		connected[i] = i < host.localPlayers || host.server.IsConnected(i)
+		if connected[i] {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Step advances the match by one tick, localInputs holds the inputs of the local players.
+// The returned events are only valid until the next call.
+func (host *Host) Step(localInputs []models.Input) []sim.Event {
+	host.seatJoinedPlayers()
+	host.collectInputs(localInputs)
+
+	events := host.World.Step(host.inputs)
+	if host.recorder != nil {
+		host.recorder.Record(host.World, host.inputs, events)
+	}
+	for _, event := range events {
+		if event.Type == sim.EVENT_ROUND_STARTED {
+			host.sendMaze()
+		}
+	}
+
+	host.catchUpJoinedPlayers()
+	host.relayChat()
+	host.answerDesyncReports()
+	if host.snapshotDue() {
+		host.syncToClients()
+	}
+
+	return events
+}
+
+// seatJoinedPlayers lets players that connected mid-match into their slots,
+// a player taking over from a bot drives its tank right away, an empty slot joins from the next round.
+func (host *Host) seatJoinedPlayers() {
+	for i := host.localPlayers; i < len(host.World.Seated); i++ {
+		if !host.server.IsConnected(i) {
+			continue
+		}
+
+		host.bots[i] = nil
+		host.World.Seated[i] = true
+	}
+}
+
+func (host *Host) collectInputs(localInputs []models.Input) {
+	for i := range host.inputs {
+		switch {
+		case i < host.localPlayers:
+			if i < len(localInputs) {
+				host.inputs[i] = localInputs[i]
+			}
+		case host.bots[i] != nil:
+			host.inputs[i] = host.bots[i].Input(host.World)
+		default:
+			host.inputs[i], host.inputAcks[i] = host.server.GetInput(i)
+		}
+	}
+}
+
+func (host *Host) sendMaze() {
+	if err := host.server.BroadcastMessage(protocol.AppendMaze(nil, host.World.Seed)); err != nil {
+		log.Println(err)
+	}
+}
+
+// catchUpJoinedPlayers sends the current maze to players and spectators that just connected,
+// their first snapshot after it is a full one.
+func (host *Host) catchUpJoinedPlayers() {
+	host.joinedPlayers = host.server.TakeJoinedPlayers(host.joinedPlayers[:0])
+	for _, playerID := range host.joinedPlayers {
+		if err := host.server.WriteMessage(playerID, protocol.AppendMaze(nil, host.World.Seed)); err != nil {
+			log.Println(err)
+		}
+	}
+
+	host.joinedSpectators = host.server.TakeJoinedSpectators(host.joinedSpectators[:0])
+	for _, spectatorID := range host.joinedSpectators {
+		if err := host.server.WriteSpectatorMessage(spectatorID, protocol.AppendMaze(nil, host.World.Seed)); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// SendChat says text as the local player sender with the next Step.
+func (host *Host) SendChat(sender int, text string) {
+	text = protocol.CleanChatText(text)
+	if text == "" || len(text) > protocol.MAX_CHAT_TEXT {
+		return
+	}
+
+	host.localChat = append(host.localChat, protocol.ChatMessage{Sender: sender, Text: text})
+}
+
+// Chat returns the chat lines the last Step relayed, they are only valid until the next call.
+func (host *Host) Chat() []protocol.ChatMessage {
+	return host.chat
+}
+
+// relayChat sends the lines said since the last tick to every player and spectator.
+func (host *Host) relayChat() {
+	host.chat = append(host.chat[:0], host.localChat...)
+	host.localChat = host.localChat[:0]
+	host.chat = host.server.TakeChat(host.chat)
+
+	for i := range host.chat {
+		host.chatBuffer = protocol.AppendChat(host.chatBuffer[:0], &host.chat[i])
+		if err := host.server.BroadcastMessage(host.chatBuffer); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// snapshotDue spreads the snapshots of a second evenly over its ticks.
+func (host *Host) snapshotDue() bool {
+	tick, tickRate, snapshotRate := host.World.Tick, uint64(host.World.TickRate), uint64(host.snapshotRate)
+	return tick*snapshotRate/tickRate != (tick-1)*snapshotRate/tickRate
+}
+
+// syncToClients sends every client a delta against the last snapshot it acked,
+// spectators ack nothing and get full snapshots.
+func (host *Host) syncToClients() {
+	snapshot := &host.snapshot
+	protocol.CaptureSnapshot(host.World, snapshot)
+	snapshot.InputAcks = append(snapshot.InputAcks[:0], host.inputAcks...)
+	host.snapshotSequence++
+	snapshot.Sequence = host.snapshotSequence
+	snapshot.StateHash = 0
+	if host.World.Tick >= host.nextStateHash {
+		snapshot.StateHash = protocol.WorldHash(host.World)
+		host.nextStateHash = host.World.Tick + uint64(max(models.Ticks(STATE_HASH_INTERVAL, host.World.TickRate), 1))
+	}
+	host.snapshotHistory.Put(snapshot)
+
+	for playerID := host.localPlayers; playerID < host.World.PlayersCount; playerID++ {
+		base := host.snapshotHistory.Get(host.server.GetSnapshotAck(playerID))
+		host.snapshotBuffer = protocol.AppendSnapshotMessage(host.snapshotBuffer[:0], snapshot, base)
+
+		if err := host.server.WriteMessage(playerID, host.snapshotBuffer); err != nil {
+			log.Println(err)
+		}
+	}
+
+	if host.server.SpectatorsCount() == 0 {
+		return
+	}
+	host.snapshotBuffer = protocol.AppendSnapshot(host.snapshotBuffer[:0], snapshot)
+	if err := host.server.BroadcastToSpectators(host.snapshotBuffer); err != nil {
+		log.Println(err)
+	}
+}
+
+// answerDesyncReports logs the desyncs players reported and sends them the snapshot of the tick
+// their world differed at, their clients log how it differs from their world.
+func (host *Host) answerDesyncReports() {
+	host.desyncReports = host.server.TakeDesyncReports(host.desyncReports[:0])
+	for _, report := range host.desyncReports {
+		snapshot := host.snapshotHistory.Get(report.Sequence)
+		if snapshot == nil {
+			log.Printf("player %d reports a desync in snapshot %d which is no longer kept\n", report.PlayerID, report.Sequence)
+			continue
+		}
+
+		log.Printf("player %d reports a desync at tick %d, sending it snapshot %d\n", report.PlayerID, snapshot.Tick, report.Sequence)
+		host.snapshotBuffer = protocol.AppendSnapshotDump(host.snapshotBuffer[:0], snapshot)
+		if err := host.server.WriteMessage(report.PlayerID, host.snapshotBuffer); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// Announcement tells the local network about the match, see discovery.Announcer.
+func (host *Host) Announcement(name, port string) discovery.Announcement {
+	return discovery.Announcement{
+		Name:             name,
+		Port:             port,
+		ProtocolVersion:  protocol.VERSION,
+		PlayersConnected: host.ConnectedSlots(make([]bool, host.World.PlayersCount)),
+		PlayersCount:     host.World.PlayersCount,
+		MinMazeHeight:    sim.MIN_BOARD_HEIGHT,
+		MaxMazeHeight:    sim.MAX_BOARD_HEIGHT - 1,
+		MinMazeWidth:     sim.MIN_BOARD_WIDTH,
+		MaxMazeWidth:     sim.MAX_BOARD_WIDTH - 1,
+	}
+}
+
+// StartAnnouncing announces the match on the local network every discovery.ANNOUNCE_INTERVAL.
+func (host *Host) StartAnnouncing(name, port string, discoveryPort int) (*discovery.Announcer, error) {
+	return discovery.StartAnnouncer(discovery.BroadcastAddress(discoveryPort), discovery.ANNOUNCE_INTERVAL, func() discovery.Announcement {
+		return host.Announcement(name, port)
+	})
+}
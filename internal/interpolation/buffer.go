@@ -0,0 +1,184 @@
+package interpolation
+
+import (
+	"math"
+	"time"
+
+	"myebiten/internal/models"
+	"myebiten/internal/protocol"
+)
+
+const (
+	DEFAULT_DELAY               = 50 * time.Millisecond
+	DEFAULT_EXTRAPOLATION_LIMIT = 50 * time.Millisecond
+
+	BUFFER_SIZE = 64
+	// entities moving further than this between two snapshots were respawned, not moved
+	TELEPORT_DISTANCE = 100.0
+	// how fast the estimated server clock follows snapshots that arrive late
+	CLOCK_DRIFT_RATE = 0.01
+)
+
+type entry struct {
+	serverTime time.Duration
+	snapshot   protocol.Snapshot
+}
+
+// Buffer keeps the last snapshots stamped with the server time they were taken at
+// and samples the world as it was Delay ago, so remote entities move smoothly
+// whatever the frame rate and the network jitter are.
+// Past the newest snapshot entities are extrapolated for at most ExtrapolationLimit.
+// TickRate is the rate of the server simulation, it turns snapshot ticks into server time.
+type Buffer struct {
+	Delay              time.Duration
+	ExtrapolationLimit time.Duration
+	TickRate           int
+
+	entries [BUFFER_SIZE]entry
+	count   int
+	newest  int
+
+	epoch       time.Time
+	clockOffset time.Duration
+}
+
+func NewBuffer(delay, extrapolationLimit time.Duration, tickRate int) *Buffer {
+	return &Buffer{
+		Delay:              delay,
+		ExtrapolationLimit: extrapolationLimit,
+		TickRate:           tickRate,
+	}
+}
+
+// Push stores a copy of snapshot. Snapshots older than the newest one are dropped.
+func (b *Buffer) Push(snapshot *protocol.Snapshot, receivedAt time.Time) {
+	serverTime := b.tickTime(snapshot.Tick)
+	if b.count > 0 && serverTime <= b.entries[b.newest].serverTime {
+		return
+	}
+
+	if b.count == 0 {
+		b.epoch = receivedAt
+		b.clockOffset = serverTime
+	}
+
+	// snapshots arriving early move the clock right away, late ones only nudge it
+	offset := serverTime - receivedAt.Sub(b.epoch)
+	if offset > b.clockOffset {
+		b.clockOffset = offset
+	} else {
+		b.clockOffset += time.Duration(float64(offset-b.clockOffset) * CLOCK_DRIFT_RATE)
+	}
+
+	b.newest = (b.newest + 1) % BUFFER_SIZE
+	if b.count < BUFFER_SIZE {
+		b.count++
+	}
+
+	stored := &b.entries[b.newest]
+	stored.serverTime = serverTime
+	protocol.CopySnapshot(&stored.snapshot, snapshot)
+}
+
+func (b *Buffer) Reset() {
+	b.count = 0
+}
+
+// RenderTime is the server time that is shown at now.
+func (b *Buffer) RenderTime(now time.Time) time.Duration {
+	return now.Sub(b.epoch) + b.clockOffset - b.Delay
+}
+
+// Age is how far the sampled snapshot is behind the newest server time known at now,
+// the snapshots are older still by the time they travelled to us.
+func (b *Buffer) Age(now time.Time, sampled *protocol.Snapshot) time.Duration {
+	return b.RenderTime(now) + b.Delay - b.tickTime(sampled.Tick)
+}
+
+// Sample writes the state of the world at the render time into out.
+// It returns false while the buffer is empty.
+func (b *Buffer) Sample(now time.Time, out *protocol.Snapshot) bool {
+	if b.count == 0 {
+		return false
+	}
+
+	renderTime := b.RenderTime(now)
+
+	oldest := b.at(b.count - 1)
+	if b.count == 1 || renderTime <= oldest.serverTime {
+		protocol.CopySnapshot(out, &oldest.snapshot)
+		return true
+	}
+
+	from, to := b.at(1), b.at(0)
+	for i := 1; i < b.count; i++ {
+		if b.at(i).serverTime <= renderTime {
+			from, to = b.at(i), b.at(i-1)
+			break
+		}
+	}
+
+	if renderTime > to.serverTime {
+		renderTime = min(renderTime, to.serverTime+b.ExtrapolationLimit)
+	}
+
+	t := float64(renderTime-from.serverTime) / float64(to.serverTime-from.serverTime)
+	lerpSnapshot(out, &from.snapshot, &to.snapshot, t)
+	return true
+}
+
+// at returns the i-th newest entry.
+func (b *Buffer) at(i int) *entry {
+	return &b.entries[(b.newest-i+BUFFER_SIZE)%BUFFER_SIZE]
+}
+
+func (b *Buffer) tickTime(tick uint64) time.Duration {
+	return time.Duration(tick) * time.Second / time.Duration(b.TickRate)
+}
+
+// lerpSnapshot blends from and to, t is 0 at from, 1 at to and above 1 when extrapolating.
+// Counters and items, which don't move, are taken from the older snapshot until it is passed.
+func lerpSnapshot(out, from, to *protocol.Snapshot, t float64) {
+	discrete := from
+	if t >= 1 {
+		discrete = to
+	}
+	protocol.CopySnapshot(out, discrete)
+	out.Tick = from.Tick + uint64(math.Round(t*float64(to.Tick-from.Tick)))
+	// a blend is no state the server hashed
+	out.StateHash = 0
+
+	out.Characters = append(out.Characters[:0], to.Characters...)
+	for i := range min(len(from.Characters), len(to.Characters)) {
+		out.Characters[i] = lerpEntity(from.Characters[i], to.Characters[i], t)
+	}
+
+	out.Bullets = append(out.Bullets[:0], to.Bullets...)
+	for i := range min(len(from.Bullets), len(to.Bullets)) {
+		out.Bullets[i].EntityState = lerpEntity(from.Bullets[i].EntityState, to.Bullets[i].EntityState, t)
+		out.Bullets[i].R = pick(from.Bullets[i].R, to.Bullets[i].R, t)
+	}
+}
+
+func lerpEntity(from, to protocol.EntityState, t float64) protocol.EntityState {
+	if !from.Active || !to.Active || models.SquareDistance(from.Position, to.Position) > TELEPORT_DISTANCE*TELEPORT_DISTANCE {
+		return pick(from, to, t)
+	}
+
+	return protocol.EntityState{
+		Active: true,
+		Position: models.Vector2D{
+			X: from.Position.X + (to.Position.X-from.Position.X)*t,
+			Y: from.Position.Y + (to.Position.Y-from.Position.Y)*t,
+		},
+		Rotation: from.Rotation + math.Remainder(to.Rotation-from.Rotation, 2*math.Pi)*t,
+	}
+}
+
+func pick[T any](from, to T, t float64) T {
+	if t < 1 {
+		return from
+	}
+
+	return to
+}
@@ -2,17 +2,12 @@ package models
 
 type Bullet struct {
 	GameObject
-	Sprite CircleSprite
-	R      float64
-}
-
-func (b *Bullet) Draw(drawingArea *DrawingArea) {
-	b.Sprite.Draw(b.Position.X, b.Position.Y, drawingArea)
+	R   float64
+	TTL int
 }
 
 func CreateBullet(r int) *Bullet {
 	return &Bullet{
-		Sprite: CircleSprite{R: float64(r)},
-		R:      float64(r),
+		R: float64(r),
 	}
 }
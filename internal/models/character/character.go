@@ -1,23 +1,24 @@
 package character
 
 import (
-	"image/color"
 	"math"
 
 	"myebiten/internal/models"
 	"myebiten/internal/weapons"
-
-	"github.com/hajimehoshi/ebiten/v2"
 )
 
 const (
-	CHARACTER_ROTATION_SPEED = 0.01
-	CHARACTER_SPEED          = 0.9
-	CHARACTER_WIDTH          = 60
+	// radians per second
+	CHARACTER_ROTATION_SPEED = 3.0
+	// pixels per second, backwards the character drives at 5/6 of it
+	CHARACTER_SPEED = 270.0
+	CHARACTER_WIDTH = 60
 )
 
 type Weapon interface {
 	Shoot(origin models.Vector2D, rotation float64)
+	// Update advances cooldowns, warmups and bursts by one simulation tick.
+	Update()
 }
 
 type shootingStateWeapon interface {
@@ -27,17 +28,11 @@ type shootingStateWeapon interface {
 type Character struct {
 	models.GameObject
 	hitbox                     models.RectangleHitbox
-	sprite                     models.ImageSprite
-	markerSprite               models.CircleSprite
 	Input                      models.Input
 	weapon                     Weapon
 	defaultWeapon              Weapon
 	defaultWeaponSwitchPending bool
-}
-
-func (c *Character) Draw(drawingArea *models.DrawingArea) {
-	c.sprite.Draw(c.Position.X, c.Position.Y, c.Rotation, drawingArea)
-	c.markerSprite.Draw(c.Position.X, c.Position.Y, drawingArea)
+	tickRate                   int
 }
 
 func (c *Character) SetWeapon(weapon Weapon) {
@@ -54,39 +49,59 @@ func (c *Character) SetWeapon(weapon Weapon) {
 
 func (c *Character) ProcessInput() {
 	c.switchToDefaultWeaponIfReady()
+	c.ProcessMovement()
+
+	if c.Input.Shoot {
+		sin, cos := math.Sincos(c.Rotation)
+		origin := models.Vector2D{
+			X: c.Position.X + cos*(float64(CHARACTER_WIDTH)/2+weapons.DEFAULT_GUN_BULLET_RADIUS),
+			Y: c.Position.Y + sin*(float64(CHARACTER_WIDTH)/2+weapons.DEFAULT_GUN_BULLET_RADIUS),
+		}
+
+		c.weapon.Shoot(origin, c.Rotation)
+		c.switchToDefaultWeaponAfterShot()
+	}
 
+	c.updateWeapons()
+}
+
+// ProcessMovement turns the character and sets its speed from the input without shooting,
+// clients use it alone to predict their own tank.
+func (c *Character) ProcessMovement() {
 	c.Speed.X = 0.0
 	c.Speed.Y = 0.0
 
+	rotationSpeed := models.PerTick(CHARACTER_ROTATION_SPEED, c.tickRate)
+	speed := models.PerTick(CHARACTER_SPEED, c.tickRate)
+
 	if c.Input.RotateRight {
-		c.Rotation += CHARACTER_ROTATION_SPEED
+		c.Rotation += rotationSpeed
 	}
 
 	if c.Input.RotateLeft {
-		c.Rotation -= CHARACTER_ROTATION_SPEED
+		c.Rotation -= rotationSpeed
 	}
 
 	if c.Input.MoveForward {
 		sin, cos := math.Sincos(c.Rotation)
-		c.Speed.X = cos * CHARACTER_SPEED
-		c.Speed.Y = sin * CHARACTER_SPEED
+		c.Speed.X = cos * speed
+		c.Speed.Y = sin * speed
 	}
 
 	if c.Input.MoveBackward {
 		sin, cos := math.Sincos(c.Rotation)
-		c.Speed.X = -cos * CHARACTER_SPEED * 5 / 6
-		c.Speed.Y = -sin * CHARACTER_SPEED * 5 / 6
+		c.Speed.X = -cos * speed * 5 / 6
+		c.Speed.Y = -sin * speed * 5 / 6
 	}
+}
 
-	if c.Input.Shoot {
-		sin, cos := math.Sincos(c.Rotation)
-		origin := models.Vector2D{
-			X: c.Position.X + cos*(float64(CHARACTER_WIDTH)/2+weapons.DEFAULT_GUN_BULLET_RADIUS),
-			Y: c.Position.Y + sin*(float64(CHARACTER_WIDTH)/2+weapons.DEFAULT_GUN_BULLET_RADIUS),
-		}
+func (c *Character) updateWeapons() {
+	if c.weapon != nil {
+		c.weapon.Update()
+	}
 
-		c.weapon.Shoot(origin, c.Rotation)
-		c.switchToDefaultWeaponAfterShot()
+	if c.defaultWeapon != nil && c.defaultWeapon != c.weapon {
+		c.defaultWeapon.Update()
 	}
 }
 
@@ -188,18 +203,15 @@ func (c *Character) DetectBulletToCharacterCollision(b *models.Bullet) (isCollis
 	return distanceSq <= b.R*b.R
 }
 
-func CreateCharacter(id int, charImage *ebiten.Image, weapon Weapon, controlSettings models.ControlSettings, markerColor color.RGBA) Character {
+// CreateCharacter creates a character moving at the speeds of a world stepped tickRate times per second.
+func CreateCharacter(id int, weapon Weapon, tickRate int) Character {
 	return Character{
 		GameObject: models.GameObject{ID: id},
+		tickRate:   tickRate,
 
 		hitbox:        models.RectangleHitbox{H: float64(CHARACTER_WIDTH), W: float64(CHARACTER_WIDTH)},
-		sprite:        models.ImageSprite{Image: charImage},
-		markerSprite:  models.CircleSprite{R: float64(CHARACTER_WIDTH) / 6, Color: markerColor},
 		weapon:        weapon,
 		defaultWeapon: weapon,
-		Input: models.Input{
-			ControlSettings: controlSettings,
-		},
 	}
 }
 
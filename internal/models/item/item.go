@@ -17,16 +17,7 @@ const (
 
 type Item struct {
 	models.GameObject
-	Type       ItemType
-	IconSprite models.ImageSprite `json:"-"`
-}
-
-func (item *Item) Draw(drawingArea *models.DrawingArea) {
-	if drawingArea == nil {
-		return
-	}
-
-	item.IconSprite.Draw(item.Position.X, item.Position.Y, 0.0, drawingArea)
+	Type ItemType
 }
 
 func (item *Item) DetectCharacterCollision(char *character.Character) bool {
@@ -38,18 +29,12 @@ func (item *Item) DetectCharacterCollision(char *character.Character) bool {
 	return models.SquareDistance(item.Position, char.Position) <= pickupRadius*pickupRadius
 }
 
-func CreateItem(itemType ItemType, position models.Vector2D, iconImage *models.ImageSprite) *Item {
-	item := &Item{
+func CreateItem(itemType ItemType, position models.Vector2D) *Item {
+	return &Item{
 		GameObject: models.GameObject{
 			Position: position,
 			Active:   true,
 		},
 		Type: itemType,
 	}
-
-	if iconImage != nil {
-		item.IconSprite = *iconImage
-	}
-
-	return item
 }
@@ -1,13 +1,33 @@
 package models
 
 import (
-	"image/color"
 	"math"
+)
 
-	"github.com/hajimehoshi/ebiten/v2"
-	"github.com/hajimehoshi/ebiten/v2/vector"
+// The simulation is stepped TickRate times per second, the server picks the rate and tells it to clients.
+// Speeds are given per second and timers in seconds, so the game plays the same at any rate.
+const (
+	DEFAULT_TICK_RATE = 300
+	// below it bullets jump over walls
+	MIN_TICK_RATE = 60
+	MAX_TICK_RATE = 1000
 )
 
+// Ticks is how many ticks at tickRate last seconds, rounded to the nearest one.
+func Ticks(seconds float64, tickRate int) int {
+	return int(math.Round(seconds * float64(tickRate)))
+}
+
+// PerTick is the part of a per second amount that falls on one tick at tickRate.
+func PerTick(perSecond float64, tickRate int) float64 {
+	return perSecond / float64(tickRate)
+}
+
+// NormalizeTickRate keeps tickRate within MIN_TICK_RATE and MAX_TICK_RATE.
+func NormalizeTickRate(tickRate int) int {
+	return min(max(tickRate, MIN_TICK_RATE), MAX_TICK_RATE)
+}
+
 type Vector2D struct {
 	X, Y float64
 }
@@ -42,86 +62,6 @@ func (gameObject *GameObject) MoveBack() {
 	gameObject.Position.Y -= gameObject.Speed.Y
 }
 
-type RectangleSprite struct {
-	W, H float64
-}
-
-func (rectangleSprite RectangleSprite) Draw(centerX, centerY, rotation float64, drawingArea *DrawingArea) {
-	width, height := rectangleSprite.W, rectangleSprite.H
-
-	if rotation == 0.0 {
-		width, height = height, width
-	}
-	drawFilledRect(drawingArea, centerX, centerY, width, height, color.Black)
-}
-
-type CircleSprite struct {
-	R     float64
-	Color color.RGBA
-}
-
-func (circleSprite CircleSprite) Draw(centerX, centerY float64, drawingArea *DrawingArea) {
-	sc := drawingArea.Scale
-	offX := drawingArea.Offset.X
-	offY := drawingArea.Offset.Y
-
-	x := float32(centerX)*float32(sc) + float32(offX)
-	y := float32(centerY)*float32(sc) + float32(offY)
-	r := float32(circleSprite.R) * float32(sc)
-
-	image := drawingArea.BoardImage
-
-	fillColor := circleSprite.Color
-	if fillColor.A == 0 {
-		fillColor = color.RGBA{0x00, 0x00, 0x00, 0xff}
-	}
-
-	vector.DrawFilledCircle(image, x, y, r, fillColor, false)
-}
-
-type ImageSprite struct {
-	*ebiten.Image
-}
-
-func (imageSprite ImageSprite) Draw(centerX, centerY, rotation float64, drawingArea *DrawingArea) {
-	if drawingArea == nil || imageSprite.Image == nil {
-		return
-	}
-	op := &ebiten.DrawImageOptions{}
-
-	w := imageSprite.Image.Bounds().Max.X - imageSprite.Image.Bounds().Min.X
-	h := imageSprite.Image.Bounds().Max.Y - imageSprite.Image.Bounds().Min.Y
-
-	sc := drawingArea.Scale
-	offX := drawingArea.Offset.X
-	offY := drawingArea.Offset.Y
-
-	op.GeoM.Reset()
-	op.GeoM.Translate(-float64(w)/2, -float64(h)/2)
-	op.GeoM.Rotate(rotation)
-	op.GeoM.Scale(sc, sc)
-	op.GeoM.Translate(centerX*sc+offX, centerY*sc+offY)
-
-	image := drawingArea.BoardImage
-
-	image.DrawImage(imageSprite.Image, op)
-}
-
-func drawFilledRect(drawingArea *DrawingArea, centerX, centerY, width, height float64, fillColor color.Color) {
-	topLeftCorner := Vector2D{X: centerX - width/2, Y: centerY - height/2}
-
-	sc := drawingArea.Scale
-	offX := drawingArea.Offset.X
-	offY := drawingArea.Offset.Y
-
-	x := float32(topLeftCorner.X)*float32(sc) + float32(offX)
-	y := float32(topLeftCorner.Y)*float32(sc) + float32(offY)
-	w := float32(width) * float32(sc)
-	h := float32(height) * float32(sc)
-
-	vector.DrawFilledRect(drawingArea.BoardImage, x, y, w, h, fillColor, false)
-}
-
 type RectangleHitbox struct {
 	H, W float64
 }
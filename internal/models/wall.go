@@ -5,11 +5,6 @@ import "math"
 type Wall struct {
 	GameObject
 	Hitbox RectangleHitbox `json:"-"`
-	Sprite RectangleSprite `json:"-"`
-}
-
-func (w *Wall) Draw(drawingArea *DrawingArea) {
-	w.Sprite.Draw(w.Position.X, w.Position.Y, w.Rotation, drawingArea)
 }
 
 func (w *Wall) GetCorners() []Vector2D {
@@ -40,6 +35,5 @@ func CreateWall(center Vector2D, w, h float64, vertical bool) Wall {
 			Rotation: rotation,
 		},
 		Hitbox: RectangleHitbox{H: h, W: w},
-		Sprite: RectangleSprite{H: h, W: w},
 	}
 }
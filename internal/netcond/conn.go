@@ -0,0 +1,118 @@
+package netcond
+
+import (
+	"net"
+	"sync"
+)
+
+// Transport is the part of a websocket connection the server and the client use.
+type Transport interface {
+	ReadMessage() (messageType int, data []byte, err error)
+	WriteMessage(messageType int, data []byte) error
+	Close() error
+}
+
+// Wrap sends both directions of transport through links with the conditions of config,
+// droppable tells which messages the game copes with losing. Without conditions transport is returned as it is.
+// Reading starts right away, so a read limit has to be set on transport before.
+func Wrap(transport Transport, config Config, droppable func([]byte) bool) Transport {
+	if !config.Enabled() {
+		return transport
+	}
+
+	c := &conn{
+		transport: transport,
+		droppable: droppable,
+		out:       NewLink(config),
+		in:        NewLink(config),
+		incoming:  make(chan received),
+		done:      make(chan struct{}),
+	}
+	go c.receive()
+
+	return c
+}
+
+type received struct {
+	messageType int
+	data        []byte
+	err         error
+}
+
+type conn struct {
+	transport Transport
+	droppable func([]byte) bool
+	out       *Link
+	in        *Link
+	incoming  chan received
+
+	mutex sync.Mutex
+	// writes happen on the link goroutine, their failure is reported by the next WriteMessage
+	writeErr  error
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// receive passes what arrives through the incoming link, the error ending the connection
+// comes after the messages before it.
+func (c *conn) receive() {
+	for {
+		messageType, data, err := c.transport.ReadMessage()
+		message := received{messageType: messageType, data: data, err: err}
+		if err != nil {
+			c.in.Send(0, false, func() { c.push(message) })
+			return
+		}
+
+		c.in.Send(len(data), c.droppable(data), func() { c.push(message) })
+	}
+}
+
+func (c *conn) push(message received) {
+	select {
+	case c.incoming <- message:
+	case <-c.done:
+	}
+}
+
+func (c *conn) ReadMessage() (int, []byte, error) {
+	select {
+	case message := <-c.incoming:
+		return message.messageType, message.data, message.err
+	case <-c.done:
+		return 0, nil, net.ErrClosed
+	}
+}
+
+// WriteMessage queues a copy of data, callers may reuse it right away.
+func (c *conn) WriteMessage(messageType int, data []byte) error {
+	c.mutex.Lock()
+	err := c.writeErr
+	c.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	message := append([]byte(nil), data...)
+	c.out.Send(len(message), c.droppable(message), func() {
+		if err := c.transport.WriteMessage(messageType, message); err != nil {
+			c.mutex.Lock()
+			c.writeErr = err
+			c.mutex.Unlock()
+		}
+	})
+
+	return nil
+}
+
+func (c *conn) Close() error {
+	err := net.ErrClosed
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.out.Close()
+		c.in.Close()
+		err = c.transport.Close()
+	})
+
+	return err
+}
@@ -0,0 +1,183 @@
+package netcond
+
+import (
+	"container/heap"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// REORDER_HOLD is how much longer than the others a reordered message travels,
+// enough for the next few messages to overtake it.
+const REORDER_HOLD = 50 * time.Millisecond
+
+// Config describes a bad network, the zero value is a perfect one.
+type Config struct {
+	// every message travels Delay plus a random amount within ±Jitter
+	Delay  time.Duration
+	Jitter time.Duration
+	// chances from 0 to 1 that a droppable message is lost or overtaken by the following ones
+	Loss    float64
+	Reorder float64
+	// bytes per second the link carries, messages queue up behind it, 0 is unlimited
+	Bandwidth int
+}
+
+func (config Config) Enabled() bool {
+	return config.Delay > 0 || config.Jitter > 0 || config.Loss > 0 || config.Reorder > 0 || config.Bandwidth > 0
+}
+
+// Link is one direction of a conditioned connection. It calls the deliver function of every message
+// from its own goroutine once the message got through, in the order the conditions decided.
+type Link struct {
+	config Config
+
+	mutex  sync.Mutex
+	random *rand.Rand
+	queue  deliveries
+	sent   uint64
+	// when the link finishes transmitting what is queued, bandwidth makes messages wait for it
+	freeAt time.Time
+	// the latest delivery of a message kept in order, jitter alone must not reorder messages
+	orderedAt time.Time
+	// the latest delivery of any message, messages that can't be dropped wait for everything before them
+	lastAt time.Time
+
+	wake chan struct{}
+	done chan struct{}
+}
+
+func NewLink(config Config) *Link {
+	link := &Link{
+		config: config,
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	go link.run()
+
+	return link
+}
+
+// Send schedules deliver for a message of size bytes. Droppable messages may be lost or reordered,
+// the others only wait, they are never overtaken by what was sent after them.
+func (link *Link) Send(size int, droppable bool, deliver func()) {
+	link.mutex.Lock()
+	defer link.mutex.Unlock()
+
+	config := link.config
+	if droppable && link.random.Float64() < config.Loss {
+		return
+	}
+
+	now := time.Now()
+	start := now
+	if config.Bandwidth > 0 {
+		start = later(now, link.freeAt)
+		link.freeAt = start.Add(time.Duration(size) * time.Second / time.Duration(config.Bandwidth))
+		start = link.freeAt
+	}
+
+	at := start.Add(config.Delay)
+	if config.Jitter > 0 {
+		at = at.Add(time.Duration(link.random.Int63n(int64(2*config.Jitter))) - config.Jitter)
+	}
+	at = later(at, start)
+
+	switch {
+	case !droppable:
+		at = later(at, link.lastAt)
+		link.orderedAt = at
+	case link.random.Float64() < config.Reorder:
+		at = at.Add(REORDER_HOLD)
+	default:
+		at = later(at, link.orderedAt)
+		link.orderedAt = at
+	}
+	link.lastAt = later(link.lastAt, at)
+
+	link.sent++
+	heap.Push(&link.queue, delivery{at: at, sequence: link.sent, deliver: deliver})
+	select {
+	case link.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (link *Link) run() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		link.mutex.Lock()
+		wait := time.Hour
+		if len(link.queue) > 0 {
+			wait = time.Until(link.queue[0].at)
+		}
+		if wait <= 0 {
+			next := heap.Pop(&link.queue).(delivery)
+			link.mutex.Unlock()
+
+			next.deliver()
+			continue
+		}
+		link.mutex.Unlock()
+
+		timer.Reset(wait)
+		select {
+		case <-link.wake:
+		case <-timer.C:
+		case <-link.done:
+			return
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+	}
+}
+
+// Close drops the messages still on their way.
+func (link *Link) Close() {
+	close(link.done)
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+
+	return b
+}
+
+type delivery struct {
+	at       time.Time
+	sequence uint64
+	deliver  func()
+}
+
+// deliveries is a heap ordered by delivery time, messages due at the same time keep their order.
+type deliveries []delivery
+
+func (d deliveries) Len() int { return len(d) }
+
+func (d deliveries) Less(i, j int) bool {
+	if d[i].at.Equal(d[j].at) {
+		return d[i].sequence < d[j].sequence
+	}
+
+	return d[i].at.Before(d[j].at)
+}
+
+func (d deliveries) Swap(i, j int) { d[i], d[j] = d[j], d[i] }
+
+func (d *deliveries) Push(x any) { *d = append(*d, x.(delivery)) }
+
+func (d *deliveries) Pop() any {
+	old := *d
+	last := old[len(old)-1]
+	*d = old[:len(old)-1]
+	return last
+}
@@ -0,0 +1,167 @@
+package netstats
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// both ends ping each other this often
+	PING_INTERVAL = time.Second
+	// rates are counted over windows of this length
+	RATE_WINDOW = time.Second
+	// weight of a new round trip sample in the smoothed one, the same as TCP uses
+	RTT_SMOOTHING = 0.125
+)
+
+// MAX_RTT bounds believable round trip samples, a pong carrying a bogus time is ignored.
+const MAX_RTT = time.Minute
+
+var epoch = time.Now()
+
+// Stamp is the time a ping is sent at, the pong brings it back unchanged.
+func Stamp() uint64 {
+	return uint64(time.Since(epoch))
+}
+
+// Stats describe one connection as seen from this end.
+type Stats struct {
+	// RTT is the smoothed round trip time, 0 until the first pong arrives
+	RTT time.Duration
+
+	MessagesInPerSecond  float64
+	BytesInPerSecond     float64
+	MessagesOutPerSecond float64
+	BytesOutPerSecond    float64
+
+	// snapshots that never got applied because newer ones replaced them or they were lost,
+	// and snapshots that arrived after a newer one
+	DroppedSnapshots uint64
+	LateSnapshots    uint64
+}
+
+// Counters gather the stats of a connection, they are safe to use from several goroutines.
+type Counters struct {
+	mutex sync.Mutex
+
+	rtt time.Duration
+	in  rate
+	out rate
+
+	lastSnapshot     uint64
+	droppedSnapshots uint64
+	lateSnapshots    uint64
+}
+
+func (counters *Counters) Received(size int) {
+	counters.mutex.Lock()
+	counters.in.add(size, time.Now())
+	counters.mutex.Unlock()
+}
+
+func (counters *Counters) Sent(size int) {
+	counters.mutex.Lock()
+	counters.out.add(size, time.Now())
+	counters.mutex.Unlock()
+}
+
+// AddRTT smooths a new round trip sample into the RTT.
+func (counters *Counters) AddRTT(sample time.Duration) {
+	counters.mutex.Lock()
+	defer counters.mutex.Unlock()
+
+	if counters.rtt == 0 {
+		counters.rtt = sample
+		return
+	}
+	counters.rtt += time.Duration(float64(sample-counters.rtt) * RTT_SMOOTHING)
+}
+
+// AddPong takes the round trip of a ping from the stamp its pong brought back.
+func (counters *Counters) AddPong(stamp uint64) {
+	sample := time.Since(epoch) - time.Duration(stamp)
+	if sample < 0 || sample > MAX_RTT {
+		return
+	}
+
+	counters.AddRTT(sample)
+}
+
+// Snapshot counts the arrival of the snapshot with sequence, skipped sequences are dropped snapshots.
+// It returns false for a late snapshot which must not be applied.
+func (counters *Counters) Snapshot(sequence uint64) bool {
+	counters.mutex.Lock()
+	defer counters.mutex.Unlock()
+
+	if sequence <= counters.lastSnapshot {
+		counters.lateSnapshots++
+		return false
+	}
+
+	if counters.lastSnapshot != 0 {
+		counters.droppedSnapshots += sequence - counters.lastSnapshot - 1
+	}
+	counters.lastSnapshot = sequence
+	return true
+}
+
+// ResetSnapshots forgets the last snapshot sequence, a restarted server counts from the start again.
+func (counters *Counters) ResetSnapshots() {
+	counters.mutex.Lock()
+	counters.lastSnapshot = 0
+	counters.mutex.Unlock()
+}
+
+func (counters *Counters) Stats() Stats {
+	counters.mutex.Lock()
+	defer counters.mutex.Unlock()
+
+	now := time.Now()
+	inMessages, inBytes := counters.in.perSecond(now)
+	outMessages, outBytes := counters.out.perSecond(now)
+	return Stats{
+		RTT:                  counters.rtt,
+		MessagesInPerSecond:  inMessages,
+		BytesInPerSecond:     inBytes,
+		MessagesOutPerSecond: outMessages,
+		BytesOutPerSecond:    outBytes,
+		DroppedSnapshots:     counters.droppedSnapshots,
+		LateSnapshots:        counters.lateSnapshots,
+	}
+}
+
+// rate counts messages in the current window and reports the last complete one.
+type rate struct {
+	windowStart  time.Time
+	messages     uint64
+	bytes        uint64
+	lastMessages uint64
+	lastBytes    uint64
+}
+
+func (r *rate) add(size int, now time.Time) {
+	r.roll(now)
+	r.messages++
+	r.bytes += uint64(size)
+}
+
+func (r *rate) roll(now time.Time) {
+	elapsed := now.Sub(r.windowStart)
+	if elapsed < RATE_WINDOW {
+		return
+	}
+
+	r.lastMessages, r.lastBytes = r.messages, r.bytes
+	if elapsed >= 2*RATE_WINDOW {
+		// nothing happened during the last window
+		r.lastMessages, r.lastBytes = 0, 0
+	}
+	r.messages, r.bytes = 0, 0
+	r.windowStart = now
+}
+
+func (r *rate) perSecond(now time.Time) (float64, float64) {
+	r.roll(now)
+	seconds := RATE_WINDOW.Seconds()
+	return float64(r.lastMessages) / seconds, float64(r.lastBytes) / seconds
+}
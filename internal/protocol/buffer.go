@@ -0,0 +1,199 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+const (
+	// positions are sent as fixed point numbers with 1/16 px precision
+	POSITION_SCALE = 16
+	// rotations are mapped from [0, 2pi) onto the whole uint16 range
+	ROTATION_SCALE = (math.MaxUint16 + 1) / (2 * math.Pi)
+)
+
+func positionFixed(v float64) int32 {
+	return int32(math.Round(v * POSITION_SCALE))
+}
+
+func rotationFixed(rotation float64) uint16 {
+	rotation = math.Mod(rotation, 2*math.Pi)
+	if rotation < 0 {
+		rotation += 2 * math.Pi
+	}
+
+	return uint16(int(math.Round(rotation*ROTATION_SCALE)) & math.MaxUint16)
+}
+
+func appendPosition(dst []byte, v float64) []byte {
+	return binary.LittleEndian.AppendUint32(dst, uint32(positionFixed(v)))
+}
+
+func appendRotation(dst []byte, rotation float64) []byte {
+	return binary.LittleEndian.AppendUint16(dst, rotationFixed(rotation))
+}
+
+// appendString writes the length of s before its bytes.
+func appendString(dst []byte, s string) []byte {
+	dst = binary.AppendUvarint(dst, uint64(len(s)))
+	return append(dst, s...)
+}
+
+// appendMask writes one bit per flag, the length of flags is written before it.
+func appendMask(dst []byte, flags []bool) []byte {
+	dst = binary.AppendUvarint(dst, uint64(len(flags)))
+
+	var b byte
+	for i, flag := range flags {
+		if flag {
+			b |= 1 << (i % 8)
+		}
+		if i%8 == 7 {
+			dst = append(dst, b)
+			b = 0
+		}
+	}
+	if len(flags)%8 != 0 {
+		dst = append(dst, b)
+	}
+
+	return dst
+}
+
+// reader decodes the values written by the append functions.
+// The first error sticks and every following read returns zero values.
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) fail(format string, args ...any) {
+	if r.err == nil {
+		r.err = fmt.Errorf("%w: "+format, append([]any{ErrMalformed}, args...)...)
+	}
+	r.data = nil
+}
+
+// finish checks that the whole message was read.
+func (r *reader) finish() error {
+	if r.err == nil && len(r.data) != 0 {
+		r.fail("%d trailing bytes", len(r.data))
+	}
+
+	return r.err
+}
+
+func (r *reader) byte() byte {
+	if len(r.data) < 1 {
+		r.fail("unexpected end of data")
+		return 0
+	}
+
+	b := r.data[0]
+	r.data = r.data[1:]
+	return b
+}
+
+func (r *reader) uint64() uint64 {
+	if len(r.data) < 8 {
+		r.fail("unexpected end of data")
+		return 0
+	}
+
+	v := binary.LittleEndian.Uint64(r.data)
+	r.data = r.data[8:]
+	return v
+}
+
+func (r *reader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.fail("bad varint")
+		return 0
+	}
+
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *reader) varint() int64 {
+	v, n := binary.Varint(r.data)
+	if n <= 0 {
+		r.fail("bad varint")
+		return 0
+	}
+
+	r.data = r.data[n:]
+	return v
+}
+
+// count reads a length and checks it against limit so broken messages can't make us allocate a lot.
+func (r *reader) count(limit int) int {
+	n := r.uvarint()
+	if n > uint64(limit) {
+		r.fail("count %d is over the limit of %d", n, limit)
+		return 0
+	}
+
+	return int(n)
+}
+
+func (r *reader) position() float64 {
+	if len(r.data) < 4 {
+		r.fail("unexpected end of data")
+		return 0
+	}
+
+	v := int32(binary.LittleEndian.Uint32(r.data))
+	r.data = r.data[4:]
+	return float64(v) / POSITION_SCALE
+}
+
+func (r *reader) rotation() float64 {
+	if len(r.data) < 2 {
+		r.fail("unexpected end of data")
+		return 0
+	}
+
+	v := binary.LittleEndian.Uint16(r.data)
+	r.data = r.data[2:]
+	return float64(v) / ROTATION_SCALE
+}
+
+func (r *reader) string(limit int) string {
+	n := r.count(limit)
+	if len(r.data) < n {
+		r.fail("unexpected end of data")
+		return ""
+	}
+
+	s := string(r.data[:n])
+	r.data = r.data[n:]
+	return s
+}
+
+func (r *reader) mask(flags []bool, limit int) []bool {
+	n := r.count(limit)
+	flags = resize(flags, n)
+
+	var b byte
+	for i := range flags {
+		if i%8 == 0 {
+			b = r.byte()
+		}
+		flags[i] = b&(1<<(i%8)) != 0
+	}
+
+	return flags
+}
+
+func resize[T any](s []T, n int) []T {
+	if cap(s) < n {
+		return make([]T, n)
+	}
+
+	s = s[:n]
+	clear(s)
+	return s
+}
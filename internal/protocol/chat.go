@@ -0,0 +1,48 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"strings"
+	"unicode"
+)
+
+// MAX_CHAT_TEXT bounds a chat line in bytes, the server refuses longer ones.
+const MAX_CHAT_TEXT = 160
+
+// ChatMessage is a line of chat. Sender is the slot that wrote it,
+// clients may leave it as it is since the server sets it from the connection.
+type ChatMessage struct {
+	Sender int
+	Text   string
+}
+
+func AppendChat(dst []byte, message *ChatMessage) []byte {
+	dst = append(dst, VERSION, MESSAGE_CHAT)
+	dst = binary.AppendVarint(dst, int64(message.Sender))
+	return appendString(dst, message.Text)
+}
+
+func DecodeChat(data []byte, message *ChatMessage) error {
+	r := &reader{data: data}
+	if err := checkHeader(r, MESSAGE_CHAT); err != nil {
+		return err
+	}
+
+	message.Sender = int(r.varint())
+	message.Text = r.string(MAX_CHAT_TEXT)
+	return r.finish()
+}
+
+// CleanChatText drops control characters and broken UTF-8 which could mess up other players' screens,
+// and the surrounding spaces. An empty result is not worth sending.
+func CleanChatText(text string) string {
+	text = strings.ToValidUTF8(text, "")
+	text = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, text)
+
+	return strings.TrimSpace(text)
+}
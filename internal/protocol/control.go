@@ -0,0 +1,47 @@
+package protocol
+
+import "encoding/binary"
+
+const (
+	// CONTROL_WELCOME is the first message of every connection,
+	// Value is the players count and Text the session token of the slot.
+	CONTROL_WELCOME = iota + 1
+	// both ends ping each other, the pong carries back the Value of the ping
+	// which is the time the ping was sent at on the pinging side
+	CONTROL_PING
+	CONTROL_PONG
+	// CONTROL_TICK_RATE follows the welcome, Value is how many ticks per second the server simulates.
+	// Clients predict at this rate and send one input per tick.
+	CONTROL_TICK_RATE
+	// CONTROL_DESYNC is sent by a client once its world at the tick of a snapshot does not match the StateHash
+	// in it, Value is the sequence of the snapshot. The server answers with a MESSAGE_SNAPSHOT_DUMP of it.
+	CONTROL_DESYNC
+)
+
+const MAX_CONTROL_TEXT = 256
+
+// ControlMessage manages the connection itself rather than the game,
+// the meaning of Value and Text depends on Kind.
+type ControlMessage struct {
+	Kind  byte
+	Value uint64
+	Text  string
+}
+
+func AppendControl(dst []byte, message *ControlMessage) []byte {
+	dst = append(dst, VERSION, MESSAGE_CONTROL, message.Kind)
+	dst = binary.AppendUvarint(dst, message.Value)
+	return appendString(dst, message.Text)
+}
+
+func DecodeControl(data []byte, message *ControlMessage) error {
+	r := &reader{data: data}
+	if err := checkHeader(r, MESSAGE_CONTROL); err != nil {
+		return err
+	}
+
+	message.Kind = r.byte()
+	message.Value = r.uvarint()
+	message.Text = r.string(MAX_CONTROL_TEXT)
+	return r.finish()
+}
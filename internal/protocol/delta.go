@@ -0,0 +1,345 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"myebiten/internal/models/item"
+)
+
+// SNAPSHOT_HISTORY_SIZE is how many sent snapshots can still be used as a delta base.
+// Clients that acked an older snapshot get a full one.
+const SNAPSHOT_HISTORY_SIZE = 64
+
+// Every changed entity of a delta starts with a byte of these flags,
+// FIELD_ACTIVE holds the active flag itself, the rest tell which fields follow.
+const (
+	FIELD_ACTIVE = 1 << iota
+	FIELD_POSITION
+	FIELD_ROTATION
+	FIELD_EXTRA
+)
+
+// SnapshotHistory keeps the last snapshots by sequence, both ends of the connection
+// hold one: the server to encode deltas against acked snapshots, the client to decode them.
+type SnapshotHistory struct {
+	snapshots [SNAPSHOT_HISTORY_SIZE]Snapshot
+}
+
+func (history *SnapshotHistory) Put(snapshot *Snapshot) {
+	CopySnapshot(&history.snapshots[snapshot.Sequence%SNAPSHOT_HISTORY_SIZE], snapshot)
+}
+
+// Get returns the snapshot with sequence or nil when it was never stored or already overwritten.
+func (history *SnapshotHistory) Get(sequence uint64) *Snapshot {
+	if sequence == 0 {
+		return nil
+	}
+
+	stored := &history.snapshots[sequence%SNAPSHOT_HISTORY_SIZE]
+	if stored.Sequence != sequence {
+		return nil
+	}
+
+	return stored
+}
+
+// AppendSnapshotMessage encodes snapshot as a delta against base, or as a full snapshot when there is no base.
+func AppendSnapshotMessage(dst []byte, snapshot, base *Snapshot) []byte {
+	if base == nil {
+		return AppendSnapshot(dst, snapshot)
+	}
+
+	return AppendDeltaSnapshot(dst, base, snapshot)
+}
+
+// DecodeSnapshotMessage decodes a full or a delta snapshot, delta bases are looked up in history.
+// ErrMissingBase means the client should ask for a full snapshot.
+func DecodeSnapshotMessage(data []byte, history *SnapshotHistory, snapshot *Snapshot) error {
+	r := &reader{data: data}
+	kind, err := readHeader(r)
+	if err != nil {
+		return err
+	}
+
+	switch kind {
+	case MESSAGE_SNAPSHOT:
+		return readSnapshot(r, snapshot)
+	case MESSAGE_DELTA_SNAPSHOT:
+		return readDeltaSnapshot(r, history, snapshot)
+	default:
+		return fmt.Errorf("%w: got message type %d, expected a snapshot", ErrMalformed, kind)
+	}
+}
+
+// SnapshotSequence reads only the sequence of a full or a delta snapshot,
+// so a snapshot arriving after a newer one can be skipped without decoding it.
+func SnapshotSequence(data []byte) (uint64, error) {
+	r := &reader{data: data}
+	kind, err := readHeader(r)
+	if err != nil {
+		return 0, err
+	}
+	if kind != MESSAGE_SNAPSHOT && kind != MESSAGE_DELTA_SNAPSHOT {
+		return 0, fmt.Errorf("%w: got message type %d, expected a snapshot", ErrMalformed, kind)
+	}
+
+	sequence := r.uvarint()
+	return sequence, r.err
+}
+
+// AppendDeltaSnapshot encodes only the entities and fields of snapshot that differ from base.
+func AppendDeltaSnapshot(dst []byte, base, snapshot *Snapshot) []byte {
+	dst = append(dst, VERSION, MESSAGE_DELTA_SNAPSHOT)
+	dst = binary.AppendUvarint(dst, snapshot.Sequence)
+	dst = binary.AppendUvarint(dst, base.Sequence)
+	dst = binary.AppendUvarint(dst, snapshot.Tick)
+	dst = appendStateHash(dst, snapshot.StateHash)
+
+	dst = appendDeltaValues(dst, base.Scores, snapshot.Scores)
+	dst = appendDeltaValues(dst, base.InputAcks, snapshot.InputAcks)
+
+	dst = appendDeltaEntities(dst, base.Characters, snapshot.Characters, characterCodec{})
+	dst = appendDeltaEntities(dst, base.Bullets, snapshot.Bullets, bulletCodec{})
+	dst = appendDeltaEntities(dst, base.Items, snapshot.Items, itemCodec{})
+
+	return dst
+}
+
+func readDeltaSnapshot(r *reader, history *SnapshotHistory, snapshot *Snapshot) error {
+	sequence := r.uvarint()
+	baseSequence := r.uvarint()
+	tick := r.uvarint()
+	stateHash := readStateHash(r)
+	if r.err != nil {
+		return r.err
+	}
+
+	base := history.Get(baseSequence)
+	if base == nil {
+		return fmt.Errorf("%w: snapshot %d is based on %d", ErrMissingBase, sequence, baseSequence)
+	}
+
+	snapshot.Sequence = sequence
+	snapshot.Tick = tick
+	snapshot.StateHash = stateHash
+
+	snapshot.Scores = readDeltaValues(r, base.Scores, snapshot.Scores)
+	snapshot.InputAcks = readDeltaValues(r, base.InputAcks, snapshot.InputAcks)
+
+	snapshot.Characters = readDeltaEntities(r, base.Characters, snapshot.Characters, MAX_CHARACTERS, characterCodec{})
+	snapshot.Bullets = readDeltaEntities(r, base.Bullets, snapshot.Bullets, MAX_BULLETS, bulletCodec{})
+	snapshot.Items = readDeltaEntities(r, base.Items, snapshot.Items, MAX_ITEMS, itemCodec{})
+
+	return r.finish()
+}
+
+func appendDeltaValues[T uint | uint64](dst []byte, base, values []T) []byte {
+	changed := make([]bool, len(values))
+	for i, value := range values {
+		changed[i] = i >= len(base) || base[i] != value
+	}
+
+	dst = appendMask(dst, changed)
+	for i, value := range values {
+		if changed[i] {
+			dst = binary.AppendUvarint(dst, uint64(value))
+		}
+	}
+
+	return dst
+}
+
+func readDeltaValues[T uint | uint64](r *reader, base, values []T) []T {
+	var changed []bool
+	changed = r.mask(changed, MAX_CHARACTERS)
+
+	values = resize(values, len(changed))
+	copy(values, base)
+	for i := range changed {
+		if changed[i] {
+			values[i] = T(r.uvarint())
+		}
+	}
+
+	return values
+}
+
+// entityCodec knows how to compare and encode the fields of one kind of entity.
+type entityCodec[T any] interface {
+	active(entity T) bool
+	// changedFields compares quantized values, so changes too small to be sent are ignored
+	changedFields(base, entity T) byte
+	appendFields(dst []byte, entity T, fields byte) []byte
+	readFields(r *reader, entity *T, fields byte)
+}
+
+func appendDeltaEntities[T any](dst []byte, base, entities []T, codec entityCodec[T]) []byte {
+	var zero T
+
+	fields := make([]byte, len(entities))
+	changed := make([]bool, len(entities))
+	for i, entity := range entities {
+		baseEntity := zero
+		if i < len(base) {
+			baseEntity = base[i]
+		}
+
+		isActive := codec.active(entity)
+		if !isActive && !codec.active(baseEntity) {
+			continue
+		}
+
+		if isActive {
+			fields[i] = FIELD_ACTIVE | codec.changedFields(baseEntity, entity)
+		}
+		changed[i] = fields[i] != FIELD_ACTIVE || !codec.active(baseEntity)
+	}
+
+	dst = appendMask(dst, changed)
+	for i, entity := range entities {
+		if changed[i] {
+			dst = append(dst, fields[i])
+			dst = codec.appendFields(dst, entity, fields[i])
+		}
+	}
+
+	return dst
+}
+
+func readDeltaEntities[T any](r *reader, base, entities []T, limit int, codec entityCodec[T]) []T {
+	var changed []bool
+	changed = r.mask(changed, limit)
+
+	entities = resize(entities, len(changed))
+	copy(entities, base)
+
+	var zero T
+	for i := range changed {
+		if !changed[i] {
+			continue
+		}
+
+		fields := r.byte()
+		if fields&FIELD_ACTIVE == 0 {
+			entities[i] = zero
+			continue
+		}
+
+		codec.readFields(r, &entities[i], fields)
+	}
+
+	return entities
+}
+
+func changedEntityFields(base, entity EntityState) byte {
+	var fields byte
+	if positionFixed(base.Position.X) != positionFixed(entity.Position.X) ||
+		positionFixed(base.Position.Y) != positionFixed(entity.Position.Y) {
+		fields |= FIELD_POSITION
+	}
+	if rotationFixed(base.Rotation) != rotationFixed(entity.Rotation) {
+		fields |= FIELD_ROTATION
+	}
+
+	return fields
+}
+
+func appendEntityFields(dst []byte, entity EntityState, fields byte) []byte {
+	if fields&FIELD_POSITION != 0 {
+		dst = appendPosition(dst, entity.Position.X)
+		dst = appendPosition(dst, entity.Position.Y)
+	}
+	if fields&FIELD_ROTATION != 0 {
+		dst = appendRotation(dst, entity.Rotation)
+	}
+
+	return dst
+}
+
+func readEntityFields(r *reader, entity *EntityState, fields byte) {
+	entity.Active = true
+	if fields&FIELD_POSITION != 0 {
+		entity.Position.X = r.position()
+		entity.Position.Y = r.position()
+	}
+	if fields&FIELD_ROTATION != 0 {
+		entity.Rotation = r.rotation()
+	}
+}
+
+type characterCodec struct{}
+
+func (characterCodec) active(entity EntityState) bool { return entity.Active }
+
+func (characterCodec) changedFields(base, entity EntityState) byte {
+	return changedEntityFields(base, entity)
+}
+
+func (characterCodec) appendFields(dst []byte, entity EntityState, fields byte) []byte {
+	return appendEntityFields(dst, entity, fields)
+}
+
+func (characterCodec) readFields(r *reader, entity *EntityState, fields byte) {
+	readEntityFields(r, entity, fields)
+}
+
+// bullets don't send rotation, FIELD_EXTRA is their radius
+type bulletCodec struct{}
+
+func (bulletCodec) active(bullet BulletState) bool { return bullet.Active }
+
+func (bulletCodec) changedFields(base, bullet BulletState) byte {
+	fields := changedEntityFields(base.EntityState, bullet.EntityState) &^ FIELD_ROTATION
+	if positionFixed(base.R) != positionFixed(bullet.R) {
+		fields |= FIELD_EXTRA
+	}
+
+	return fields
+}
+
+func (bulletCodec) appendFields(dst []byte, bullet BulletState, fields byte) []byte {
+	dst = appendEntityFields(dst, bullet.EntityState, fields)
+	if fields&FIELD_EXTRA != 0 {
+		dst = appendPosition(dst, bullet.R)
+	}
+
+	return dst
+}
+
+func (bulletCodec) readFields(r *reader, bullet *BulletState, fields byte) {
+	readEntityFields(r, &bullet.EntityState, fields)
+	if fields&FIELD_EXTRA != 0 {
+		bullet.R = r.position()
+	}
+}
+
+// items don't send rotation, FIELD_EXTRA is their type
+type itemCodec struct{}
+
+func (itemCodec) active(snapshotItem ItemState) bool { return snapshotItem.Active }
+
+func (itemCodec) changedFields(base, snapshotItem ItemState) byte {
+	fields := changedEntityFields(base.EntityState, snapshotItem.EntityState) &^ FIELD_ROTATION
+	if base.Type != snapshotItem.Type {
+		fields |= FIELD_EXTRA
+	}
+
+	return fields
+}
+
+func (itemCodec) appendFields(dst []byte, snapshotItem ItemState, fields byte) []byte {
+	dst = appendEntityFields(dst, snapshotItem.EntityState, fields)
+	if fields&FIELD_EXTRA != 0 {
+		dst = append(dst, byte(snapshotItem.Type))
+	}
+
+	return dst
+}
+
+func (itemCodec) readFields(r *reader, snapshotItem *ItemState, fields byte) {
+	readEntityFields(r, &snapshotItem.EntityState, fields)
+	if fields&FIELD_EXTRA != 0 {
+		snapshotItem.Type = item.ItemType(r.byte())
+	}
+}
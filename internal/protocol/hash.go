@@ -0,0 +1,142 @@
+package protocol
+
+import (
+	"fmt"
+
+	"myebiten/internal/models"
+	"myebiten/internal/sim"
+)
+
+// MAX_DIFF_LINES bounds a DiffSnapshots dump, a round full of bullets would flood the log
+const MAX_DIFF_LINES = 32
+
+// DesyncReport is a CONTROL_DESYNC the server received, Sequence is the snapshot the player got wrong.
+type DesyncReport struct {
+	PlayerID int
+	Sequence uint64
+}
+
+// WorldHash hashes the state of a round at the precision snapshots carry it: the tick, the scores and
+// the characters, bullets and items. The server hashes its world every few ticks, a client hashes the world
+// it built from the snapshot of that tick, so they differ once the client has a tank, bullet or item
+// alive, dead or somewhere else than the server has it.
+func WorldHash(world *sim.World) uint64 {
+	hash := sim.NewHash()
+	hash.Add(world.Tick)
+	hash.Add(uint64(len(world.CharactersScores)))
+	for _, score := range world.CharactersScores {
+		hash.Add(uint64(score))
+	}
+
+	hash.Add(uint64(len(world.Characters)))
+	for _, char := range world.Characters {
+		addObject(&hash, &char.GameObject)
+		if char.IsActive() {
+			hash.Add(uint64(rotationFixed(char.Rotation)))
+		}
+	}
+	hash.Add(uint64(len(world.Bullets)))
+	for _, bullet := range world.Bullets {
+		addObject(&hash, &bullet.GameObject)
+		if bullet.IsActive() {
+			hash.Add(uint64(uint32(positionFixed(bullet.R))))
+		}
+	}
+	hash.Add(uint64(len(world.Items)))
+	for _, worldItem := range world.Items {
+		// clients leave the slots of items they never saw nil
+		if worldItem == nil {
+			hash.AddBool(false)
+			continue
+		}
+		addObject(&hash, &worldItem.GameObject)
+		if worldItem.IsActive() {
+			hash.Add(uint64(worldItem.Type))
+		}
+	}
+
+	return uint64(hash)
+}
+
+// addObject hashes the quantized position, the only precision the wire keeps.
+func addObject(hash *sim.Hash, object *models.GameObject) {
+	hash.AddBool(object.IsActive())
+	if object.IsActive() {
+		hash.Add(uint64(uint32(positionFixed(object.Position.X))))
+		hash.Add(uint64(uint32(positionFixed(object.Position.Y))))
+	}
+}
+
+// DiffSnapshots describes every score and entity that differs between the world of the server
+// and the world of a client at a tick, one line each and at most MAX_DIFF_LINES.
+func DiffSnapshots(server, client *Snapshot) []string {
+	var lines []string
+	add := func(format string, args ...any) {
+		if len(lines) < MAX_DIFF_LINES {
+			lines = append(lines, fmt.Sprintf(format, args...))
+		}
+	}
+
+	if server.Tick != client.Tick {
+		add("tick: server %d, client %d", server.Tick, client.Tick)
+	}
+	for i := range max(len(server.Scores), len(client.Scores)) {
+		serverScore, clientScore := at(server.Scores, i), at(client.Scores, i)
+		if serverScore != clientScore {
+			add("score %d: server %d, client %d", i, serverScore, clientScore)
+		}
+	}
+
+	for i := range max(len(server.Characters), len(client.Characters)) {
+		serverChar, clientChar := at(server.Characters, i), at(client.Characters, i)
+		if entityFixed(serverChar) != entityFixed(clientChar) || rotationFixed(serverChar.Rotation) != rotationFixed(clientChar.Rotation) {
+			add("character %d: server %s, client %s", i, describeEntity(serverChar, true), describeEntity(clientChar, true))
+		}
+	}
+	for i := range max(len(server.Bullets), len(client.Bullets)) {
+		serverBullet, clientBullet := at(server.Bullets, i), at(client.Bullets, i)
+		if entityFixed(serverBullet.EntityState) != entityFixed(clientBullet.EntityState) || positionFixed(serverBullet.R) != positionFixed(clientBullet.R) {
+			add("bullet %d: server %s r %.2f, client %s r %.2f", i,
+				describeEntity(serverBullet.EntityState, false), serverBullet.R, describeEntity(clientBullet.EntityState, false), clientBullet.R)
+		}
+	}
+	for i := range max(len(server.Items), len(client.Items)) {
+		serverItem, clientItem := at(server.Items, i), at(client.Items, i)
+		if entityFixed(serverItem.EntityState) != entityFixed(clientItem.EntityState) || serverItem.Type != clientItem.Type {
+			add("item %d: server %s type %d, client %s type %d", i,
+				describeEntity(serverItem.EntityState, false), serverItem.Type, describeEntity(clientItem.EntityState, false), clientItem.Type)
+		}
+	}
+
+	return lines
+}
+
+// at returns values[i], the zero value past the end like a missing slot.
+func at[T any](values []T, i int) T {
+	var zero T
+	if i >= len(values) {
+		return zero
+	}
+
+	return values[i]
+}
+
+// entityFixed is what the wire keeps of the activity and position of an entity.
+func entityFixed(entity EntityState) [3]int32 {
+	if !entity.Active {
+		return [3]int32{}
+	}
+
+	return [3]int32{1, positionFixed(entity.Position.X), positionFixed(entity.Position.Y)}
+}
+
+func describeEntity(entity EntityState, withRotation bool) string {
+	if !entity.Active {
+		return "inactive"
+	}
+	if withRotation {
+		return fmt.Sprintf("at %.2f,%.2f rotation %.3f", entity.Position.X, entity.Position.Y, entity.Rotation)
+	}
+
+	return fmt.Sprintf("at %.2f,%.2f", entity.Position.X, entity.Position.Y)
+}
@@ -0,0 +1,86 @@
+package protocol
+
+import (
+	"encoding/binary"
+
+	"myebiten/internal/models"
+)
+
+const (
+	BUTTON_ROTATE_RIGHT = 1 << iota
+	BUTTON_ROTATE_LEFT
+	BUTTON_MOVE_FORWARD
+	BUTTON_MOVE_BACKWARD
+	BUTTON_SHOOT
+
+	BUTTONS_MASK = BUTTON_SHOOT<<1 - 1
+)
+
+// InputMessage is sent by clients every tick. Sequence numbers inputs from 1,
+// the server echoes the last one it simulated so clients can replay the rest.
+// SnapshotAck is the sequence of the last snapshot the client decoded, 0 asks for a full snapshot.
+type InputMessage struct {
+	Input       models.Input
+	Sequence    uint64
+	SnapshotAck uint64
+}
+
+func AppendInput(dst []byte, message *InputMessage) []byte {
+	dst = append(dst, VERSION, MESSAGE_INPUT)
+	dst = append(dst, Buttons(message.Input))
+	dst = binary.AppendUvarint(dst, message.Sequence)
+	return binary.AppendUvarint(dst, message.SnapshotAck)
+}
+
+func DecodeInput(data []byte, message *InputMessage) error {
+	r := &reader{data: data}
+	if err := checkHeader(r, MESSAGE_INPUT); err != nil {
+		return err
+	}
+
+	b := r.byte()
+	if b&^BUTTONS_MASK != 0 {
+		r.fail("unknown buttons %08b", b&^BUTTONS_MASK)
+	}
+	message.Sequence = r.uvarint()
+	message.SnapshotAck = r.uvarint()
+	if err := r.finish(); err != nil {
+		return err
+	}
+
+	message.Input = InputFromButtons(b)
+	return nil
+}
+
+// Buttons packs input into one byte of BUTTON_* bits, replays store inputs the same way.
+func Buttons(input models.Input) byte {
+	var b byte
+	if input.RotateRight {
+		b |= BUTTON_ROTATE_RIGHT
+	}
+	if input.RotateLeft {
+		b |= BUTTON_ROTATE_LEFT
+	}
+	if input.MoveForward {
+		b |= BUTTON_MOVE_FORWARD
+	}
+	if input.MoveBackward {
+		b |= BUTTON_MOVE_BACKWARD
+	}
+	if input.Shoot {
+		b |= BUTTON_SHOOT
+	}
+
+	return b
+}
+
+// InputFromButtons unpacks what Buttons packed, unknown bits are ignored.
+func InputFromButtons(b byte) models.Input {
+	return models.Input{
+		RotateRight:  b&BUTTON_ROTATE_RIGHT != 0,
+		RotateLeft:   b&BUTTON_ROTATE_LEFT != 0,
+		MoveForward:  b&BUTTON_MOVE_FORWARD != 0,
+		MoveBackward: b&BUTTON_MOVE_BACKWARD != 0,
+		Shoot:        b&BUTTON_SHOOT != 0,
+	}
+}
@@ -0,0 +1,19 @@
+package protocol
+
+import "encoding/binary"
+
+// AppendMaze announces a new round, clients rebuild the same maze from its seed.
+func AppendMaze(dst []byte, seed int64) []byte {
+	dst = append(dst, VERSION, MESSAGE_MAZE)
+	return binary.AppendVarint(dst, seed)
+}
+
+func DecodeMaze(data []byte) (int64, error) {
+	r := &reader{data: data}
+	if err := checkHeader(r, MESSAGE_MAZE); err != nil {
+		return 0, err
+	}
+
+	seed := r.varint()
+	return seed, r.finish()
+}
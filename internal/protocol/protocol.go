@@ -0,0 +1,89 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// VERSION must be bumped on every change of the wire format,
+// server and clients only talk to each other when their versions are equal.
+const VERSION = 9
+
+const (
+	VERSION_QUERY_PARAM   = "protocol_version"
+	PLAYER_ID_QUERY_PARAM = "player_id"
+	// TOKEN_QUERY_PARAM carries the session token the server gave the slot, reconnects need it
+	TOKEN_QUERY_PARAM    = "token"
+	PASSWORD_QUERY_PARAM = "password"
+)
+
+const (
+	MESSAGE_SNAPSHOT = iota + 1
+	MESSAGE_DELTA_SNAPSHOT
+	MESSAGE_INPUT
+	MESSAGE_MAZE
+	MESSAGE_CONTROL
+	MESSAGE_CHAT
+	// MESSAGE_SNAPSHOT_DUMP is a full snapshot the server sends a client that reported a desync
+	MESSAGE_SNAPSHOT_DUMP
+)
+
+var (
+	ErrVersionMismatch = errors.New("protocol version mismatch")
+	ErrMalformed       = errors.New("malformed message")
+	ErrMissingBase     = errors.New("delta snapshot base is not in history")
+)
+
+// CheckVersion validates the version a client announced during the handshake.
+func CheckVersion(clientVersion string) error {
+	version, err := strconv.Atoi(clientVersion)
+	if err != nil {
+		return fmt.Errorf("%w: server speaks version %d, client did not send a valid version %q", ErrVersionMismatch, VERSION, clientVersion)
+	}
+
+	if version != VERSION {
+		return fmt.Errorf("%w: server speaks version %d, client speaks version %d", ErrVersionMismatch, VERSION, version)
+	}
+
+	return nil
+}
+
+// Droppable tells whether the game copes with losing the message:
+// a newer snapshot replaces a lost one and the server repeats the last input of a player.
+func Droppable(message []byte) bool {
+	kind, err := MessageType(message)
+	return err == nil && (kind == MESSAGE_SNAPSHOT || kind == MESSAGE_DELTA_SNAPSHOT || kind == MESSAGE_INPUT)
+}
+
+// MessageType returns the type of a message so it can be routed to its decoder.
+func MessageType(data []byte) (byte, error) {
+	return readHeader(&reader{data: data})
+}
+
+func checkHeader(r *reader, messageType byte) error {
+	kind, err := readHeader(r)
+	if err != nil {
+		return err
+	}
+
+	if kind != messageType {
+		return fmt.Errorf("%w: got message type %d, expected %d", ErrMalformed, kind, messageType)
+	}
+
+	return nil
+}
+
+func readHeader(r *reader) (byte, error) {
+	version := r.byte()
+	kind := r.byte()
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	if version != VERSION {
+		return 0, fmt.Errorf("%w: got message of version %d, expected %d", ErrVersionMismatch, version, VERSION)
+	}
+
+	return kind, nil
+}
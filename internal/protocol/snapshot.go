@@ -0,0 +1,265 @@
+package protocol
+
+import (
+	"encoding/binary"
+
+	"myebiten/internal/models"
+	"myebiten/internal/models/item"
+	"myebiten/internal/sim"
+)
+
+const (
+	MAX_CHARACTERS = 64
+	MAX_BULLETS    = 4096
+	MAX_ITEMS      = 4096
+)
+
+type EntityState struct {
+	Active   bool
+	Position models.Vector2D
+	Rotation float64
+}
+
+type BulletState struct {
+	EntityState
+	R float64
+}
+
+type ItemState struct {
+	EntityState
+	Type item.ItemType
+}
+
+// Snapshot is what clients need to draw a tick of the world.
+// Slices keep one entry per world slot, inactive entries are zeroed.
+// Sequence numbers every snapshot the server sends starting from 1.
+// InputAcks holds the sequence of the last input simulated for every character.
+// StateHash is the WorldHash of the server world at Tick, computed every few ticks, 0 in the snapshots between.
+type Snapshot struct {
+	Sequence   uint64
+	Tick       uint64
+	StateHash  uint64
+	Scores     []uint
+	InputAcks  []uint64
+	Characters []EntityState
+	Bullets    []BulletState
+	Items      []ItemState
+}
+
+// CaptureSnapshot copies the state of world into snapshot reusing its slices.
+// InputAcks are not part of the world and are left for the caller to fill.
+func CaptureSnapshot(world *sim.World, snapshot *Snapshot) {
+	snapshot.Tick = world.Tick
+
+	snapshot.Scores = append(snapshot.Scores[:0], world.CharactersScores...)
+
+	snapshot.Characters = resize(snapshot.Characters, len(world.Characters))
+	for i, char := range world.Characters {
+		if char.IsActive() {
+			snapshot.Characters[i] = entityState(&char.GameObject)
+		}
+	}
+
+	snapshot.Bullets = resize(snapshot.Bullets, len(world.Bullets))
+	for i, bullet := range world.Bullets {
+		if bullet.IsActive() {
+			snapshot.Bullets[i] = BulletState{EntityState: entityState(&bullet.GameObject), R: bullet.R}
+		}
+	}
+
+	snapshot.Items = resize(snapshot.Items, len(world.Items))
+	for i, worldItem := range world.Items {
+		// clients leave the slots of items they never saw nil
+		if worldItem != nil && worldItem.IsActive() {
+			snapshot.Items[i] = ItemState{EntityState: entityState(&worldItem.GameObject), Type: worldItem.Type}
+		}
+	}
+}
+
+func entityState(gameObject *models.GameObject) EntityState {
+	return EntityState{
+		Active:   gameObject.IsActive(),
+		Position: gameObject.Position,
+		Rotation: gameObject.Rotation,
+	}
+}
+
+// CopySnapshot copies src into dst reusing the slices of dst.
+func CopySnapshot(dst, src *Snapshot) {
+	dst.Sequence = src.Sequence
+	dst.Tick = src.Tick
+	dst.StateHash = src.StateHash
+	dst.Scores = append(dst.Scores[:0], src.Scores...)
+	dst.InputAcks = append(dst.InputAcks[:0], src.InputAcks...)
+	dst.Characters = append(dst.Characters[:0], src.Characters...)
+	dst.Bullets = append(dst.Bullets[:0], src.Bullets...)
+	dst.Items = append(dst.Items[:0], src.Items...)
+}
+
+// AppendSnapshot encodes snapshot to dst. Only active entities are written,
+// which slots they occupy is encoded as a bitmask.
+func AppendSnapshot(dst []byte, snapshot *Snapshot) []byte {
+	return appendSnapshot(dst, MESSAGE_SNAPSHOT, snapshot)
+}
+
+// AppendSnapshotDump encodes snapshot like AppendSnapshot, as the answer to a CONTROL_DESYNC.
+func AppendSnapshotDump(dst []byte, snapshot *Snapshot) []byte {
+	return appendSnapshot(dst, MESSAGE_SNAPSHOT_DUMP, snapshot)
+}
+
+func appendSnapshot(dst []byte, messageType byte, snapshot *Snapshot) []byte {
+	dst = append(dst, VERSION, messageType)
+	dst = binary.AppendUvarint(dst, snapshot.Sequence)
+	dst = binary.AppendUvarint(dst, snapshot.Tick)
+	dst = appendStateHash(dst, snapshot.StateHash)
+
+	dst = binary.AppendUvarint(dst, uint64(len(snapshot.Scores)))
+	for _, score := range snapshot.Scores {
+		dst = binary.AppendUvarint(dst, uint64(score))
+	}
+
+	dst = binary.AppendUvarint(dst, uint64(len(snapshot.InputAcks)))
+	for _, ack := range snapshot.InputAcks {
+		dst = binary.AppendUvarint(dst, ack)
+	}
+
+	dst = appendMask(dst, activeFlags(snapshot.Characters, func(c EntityState) bool { return c.Active }))
+	for _, char := range snapshot.Characters {
+		if char.Active {
+			dst = appendEntity(dst, char)
+		}
+	}
+
+	dst = appendMask(dst, activeFlags(snapshot.Bullets, func(b BulletState) bool { return b.Active }))
+	for _, bullet := range snapshot.Bullets {
+		if bullet.Active {
+			dst = appendPosition(dst, bullet.Position.X)
+			dst = appendPosition(dst, bullet.Position.Y)
+			dst = appendPosition(dst, bullet.R)
+		}
+	}
+
+	dst = appendMask(dst, activeFlags(snapshot.Items, func(i ItemState) bool { return i.Active }))
+	for _, snapshotItem := range snapshot.Items {
+		if snapshotItem.Active {
+			dst = append(dst, byte(snapshotItem.Type))
+			dst = appendPosition(dst, snapshotItem.Position.X)
+			dst = appendPosition(dst, snapshotItem.Position.Y)
+		}
+	}
+
+	return dst
+}
+
+// appendStateHash writes a flag byte, followed by the hash when there is one.
+func appendStateHash(dst []byte, hash uint64) []byte {
+	if hash == 0 {
+		return append(dst, 0)
+	}
+
+	dst = append(dst, 1)
+	return binary.LittleEndian.AppendUint64(dst, hash)
+}
+
+func readStateHash(r *reader) uint64 {
+	if r.byte() == 0 {
+		return 0
+	}
+
+	return r.uint64()
+}
+
+func appendEntity(dst []byte, entity EntityState) []byte {
+	dst = appendPosition(dst, entity.Position.X)
+	dst = appendPosition(dst, entity.Position.Y)
+	return appendRotation(dst, entity.Rotation)
+}
+
+// DecodeSnapshot decodes data written by AppendSnapshot into snapshot reusing its slices.
+func DecodeSnapshot(data []byte, snapshot *Snapshot) error {
+	r := &reader{data: data}
+	if err := checkHeader(r, MESSAGE_SNAPSHOT); err != nil {
+		return err
+	}
+
+	return readSnapshot(r, snapshot)
+}
+
+// DecodeSnapshotDump decodes data written by AppendSnapshotDump into snapshot reusing its slices.
+func DecodeSnapshotDump(data []byte, snapshot *Snapshot) error {
+	r := &reader{data: data}
+	if err := checkHeader(r, MESSAGE_SNAPSHOT_DUMP); err != nil {
+		return err
+	}
+
+	return readSnapshot(r, snapshot)
+}
+
+func readSnapshot(r *reader, snapshot *Snapshot) error {
+	snapshot.Sequence = r.uvarint()
+	snapshot.Tick = r.uvarint()
+	snapshot.StateHash = readStateHash(r)
+
+	snapshot.Scores = resize(snapshot.Scores, r.count(MAX_CHARACTERS))
+	for i := range snapshot.Scores {
+		snapshot.Scores[i] = uint(r.uvarint())
+	}
+
+	snapshot.InputAcks = resize(snapshot.InputAcks, r.count(MAX_CHARACTERS))
+	for i := range snapshot.InputAcks {
+		snapshot.InputAcks[i] = r.uvarint()
+	}
+
+	var active []bool
+
+	active = r.mask(active, MAX_CHARACTERS)
+	snapshot.Characters = resize(snapshot.Characters, len(active))
+	for i := range active {
+		if active[i] {
+			snapshot.Characters[i] = readEntity(r)
+		}
+	}
+
+	active = r.mask(active, MAX_BULLETS)
+	snapshot.Bullets = resize(snapshot.Bullets, len(active))
+	for i := range active {
+		if active[i] {
+			bullet := &snapshot.Bullets[i]
+			bullet.Active = true
+			bullet.Position.X = r.position()
+			bullet.Position.Y = r.position()
+			bullet.R = r.position()
+		}
+	}
+
+	active = r.mask(active, MAX_ITEMS)
+	snapshot.Items = resize(snapshot.Items, len(active))
+	for i := range active {
+		if active[i] {
+			snapshotItem := &snapshot.Items[i]
+			snapshotItem.Active = true
+			snapshotItem.Type = item.ItemType(r.byte())
+			snapshotItem.Position.X = r.position()
+			snapshotItem.Position.Y = r.position()
+		}
+	}
+
+	return r.finish()
+}
+
+func readEntity(r *reader) EntityState {
+	return EntityState{
+		Active:   true,
+		Position: models.Vector2D{X: r.position(), Y: r.position()},
+		Rotation: r.rotation(),
+	}
+}
+
+func activeFlags[T any](entities []T, isActive func(T) bool) []bool {
+	flags := make([]bool, len(entities))
+	for i, entity := range entities {
+		flags[i] = isActive(entity)
+	}
+
+	return flags
+}
@@ -0,0 +1,203 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"strconv"
+	"testing"
+
+	"myebiten/internal/models"
+	"myebiten/internal/models/item"
+)
+
+func testSnapshot(sequence uint64) *Snapshot {
+	return &Snapshot{
+		Sequence:  sequence,
+		Tick:      sequence * 5,
+		StateHash: 0x0123456789abcdef,
+		Scores:    []uint{3, 0, 7},
+		InputAcks: []uint64{100, 0, 42},
+		Characters: []EntityState{
+			{Active: true, Position: models.Vector2D{X: 12.5, Y: 40.0625}, Rotation: math.Pi / 2},
+			{},
+			{Active: true, Position: models.Vector2D{X: -3, Y: 700}, Rotation: 0},
+		},
+		Bullets: []BulletState{
+			{},
+			{EntityState: EntityState{Active: true, Position: models.Vector2D{X: 100, Y: 200.5}}, R: 4},
+		},
+		Items: []ItemState{
+			{EntityState: EntityState{Active: true, Position: models.Vector2D{X: 64, Y: 32}}, Type: item.ItemType(1)},
+		},
+	}
+}
+
+// checkSameSnapshot compares snapshots as the wire sees them, positions and rotations are quantized.
+func checkSameSnapshot(t *testing.T, want, got *Snapshot) {
+	t.Helper()
+
+	if got.Sequence != want.Sequence || got.Tick != want.Tick || got.StateHash != want.StateHash {
+		t.Fatalf("header: got %d/%d/%x, want %d/%d/%x", got.Sequence, got.Tick, got.StateHash, want.Sequence, want.Tick, want.StateHash)
+	}
+	if len(got.Scores) != len(want.Scores) || len(got.InputAcks) != len(want.InputAcks) {
+		t.Fatalf("got %d scores and %d acks, want %d and %d", len(got.Scores), len(got.InputAcks), len(want.Scores), len(want.InputAcks))
+	}
+	for i := range want.Scores {
+		if got.Scores[i] != want.Scores[i] || got.InputAcks[i] != want.InputAcks[i] {
+			t.Fatalf("player %d: got score %d ack %d, want %d and %d", i, got.Scores[i], got.InputAcks[i], want.Scores[i], want.InputAcks[i])
+		}
+	}
+
+	if len(got.Characters) != len(want.Characters) || len(got.Bullets) != len(want.Bullets) || len(got.Items) != len(want.Items) {
+		t.Fatalf("got %d/%d/%d entities, want %d/%d/%d",
+			len(got.Characters), len(got.Bullets), len(got.Items), len(want.Characters), len(want.Bullets), len(want.Items))
+	}
+	for i := range want.Characters {
+		checkSameEntity(t, "character "+strconv.Itoa(i), want.Characters[i], got.Characters[i])
+	}
+	for i := range want.Bullets {
+		checkSameEntity(t, "bullet "+strconv.Itoa(i), want.Bullets[i].EntityState, got.Bullets[i].EntityState)
+		if !bytes.Equal(appendPosition(nil, got.Bullets[i].R), appendPosition(nil, want.Bullets[i].R)) {
+			t.Fatalf("bullet %d: got radius %v, want %v", i, got.Bullets[i].R, want.Bullets[i].R)
+		}
+	}
+	for i := range want.Items {
+		checkSameEntity(t, "item "+strconv.Itoa(i), want.Items[i].EntityState, got.Items[i].EntityState)
+		if got.Items[i].Type != want.Items[i].Type {
+			t.Fatalf("item %d: got type %d, want %d", i, got.Items[i].Type, want.Items[i].Type)
+		}
+	}
+}
+
+func checkSameEntity(t *testing.T, name string, want, got EntityState) {
+	t.Helper()
+
+	if got.Active != want.Active ||
+		!bytes.Equal(appendEntity(nil, got), appendEntity(nil, want)) {
+		t.Fatalf("%s: got %+v, want %+v", name, got, want)
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	sent := testSnapshot(1)
+
+	var decoded Snapshot
+	if err := DecodeSnapshot(AppendSnapshot(nil, sent), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	checkSameSnapshot(t, sent, &decoded)
+
+	// reused slices must not keep entities of the previous snapshot
+	sent.Characters[0] = EntityState{}
+	sent.StateHash = 0
+	if err := DecodeSnapshot(AppendSnapshot(nil, sent), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	checkSameSnapshot(t, sent, &decoded)
+}
+
+func TestDeltaSnapshotRoundTrip(t *testing.T) {
+	base := testSnapshot(1)
+	next := testSnapshot(2)
+	next.StateHash = 0
+	next.Scores[1] = 1
+	next.InputAcks[0] = 105
+	next.Characters[0].Position.X += 1.5
+	next.Characters[1] = EntityState{Active: true, Position: models.Vector2D{X: 8, Y: 8}, Rotation: math.Pi}
+	next.Characters[2] = EntityState{}
+	next.Bullets = append(next.Bullets, BulletState{EntityState: EntityState{Active: true, Position: models.Vector2D{X: 1, Y: 2}}, R: 4})
+	next.Items[0] = ItemState{}
+
+	var server, client SnapshotHistory
+	server.Put(base)
+	client.Put(base)
+
+	message := AppendSnapshotMessage(nil, next, server.Get(base.Sequence))
+	if full := AppendSnapshot(nil, next); len(message) >= len(full) {
+		t.Errorf("delta takes %d bytes, the full snapshot %d", len(message), len(full))
+	}
+
+	var decoded Snapshot
+	if err := DecodeSnapshotMessage(message, &client, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	checkSameSnapshot(t, next, &decoded)
+}
+
+func TestDeltaSnapshotMissingBase(t *testing.T) {
+	base := testSnapshot(1)
+	message := AppendDeltaSnapshot(nil, base, testSnapshot(2))
+
+	var client SnapshotHistory
+	var decoded Snapshot
+	if err := DecodeSnapshotMessage(message, &client, &decoded); !errors.Is(err, ErrMissingBase) {
+		t.Fatalf("got %v, want ErrMissingBase", err)
+	}
+
+	// a base overwritten by a newer snapshot in the same history slot is missing as well
+	client.Put(testSnapshot(1 + SNAPSHOT_HISTORY_SIZE))
+	if err := DecodeSnapshotMessage(message, &client, &decoded); !errors.Is(err, ErrMissingBase) {
+		t.Fatalf("got %v, want ErrMissingBase", err)
+	}
+}
+
+func TestCheckVersion(t *testing.T) {
+	if err := CheckVersion(strconv.Itoa(VERSION)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, version := range []string{strconv.Itoa(VERSION - 1), strconv.Itoa(VERSION + 1), "", "nine"} {
+		if err := CheckVersion(version); !errors.Is(err, ErrVersionMismatch) {
+			t.Errorf("version %q: got %v, want ErrVersionMismatch", version, err)
+		}
+	}
+
+	message := AppendSnapshot(nil, testSnapshot(1))
+	message[0] = VERSION + 1
+	var decoded Snapshot
+	if err := DecodeSnapshot(message, &decoded); !errors.Is(err, ErrVersionMismatch) {
+		t.Fatalf("got %v, want ErrVersionMismatch", err)
+	}
+}
+
+func TestTruncatedSnapshots(t *testing.T) {
+	base := testSnapshot(1)
+	var history SnapshotHistory
+	history.Put(base)
+
+	messages := map[string][]byte{
+		"full":  AppendSnapshot(nil, testSnapshot(2)),
+		"delta": AppendDeltaSnapshot(nil, base, testSnapshot(2)),
+	}
+	for name, message := range messages {
+		for size := range len(message) {
+			var decoded Snapshot
+			if err := DecodeSnapshotMessage(message[:size], &history, &decoded); err == nil {
+				t.Errorf("%s snapshot cut to %d of %d bytes decoded without an error", name, size, len(message))
+			}
+		}
+	}
+}
+
+func TestMalformedSnapshots(t *testing.T) {
+	cases := map[string][]byte{
+		"empty":           {},
+		"unknown type":    {VERSION, 200},
+		"not a snapshot":  {VERSION, MESSAGE_INPUT, 1},
+		"too many scores": {VERSION, MESSAGE_SNAPSHOT, 1, 5, 0, MAX_CHARACTERS + 1},
+		"trailing bytes":  append(AppendSnapshot(nil, testSnapshot(1)), 0xff),
+		"short hash":      {VERSION, MESSAGE_SNAPSHOT, 1, 5, 1, 0xaa},
+		"huge varint":     {VERSION, MESSAGE_SNAPSHOT, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+	}
+	for name, message := range cases {
+		var history SnapshotHistory
+		var decoded Snapshot
+		if err := DecodeSnapshotMessage(message, &history, &decoded); err == nil {
+			t.Errorf("%s: decoded without an error", name)
+		}
+		if err := DecodeSnapshot(message, &decoded); err == nil {
+			t.Errorf("%s: DecodeSnapshot decoded without an error", name)
+		}
+	}
+}
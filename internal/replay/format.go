@@ -0,0 +1,134 @@
+package replay
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"myebiten/internal/models"
+	"myebiten/internal/protocol"
+)
+
+// A replay file starts with MAGIC and a header of uvarints: FORMAT_VERSION, protocol.VERSION,
+// the tick rate and the players count. Records follow until RECORD_END, each is its type byte,
+// the uvarint count of ticks since the previous record and the payload of the type.
+const (
+	MAGIC = "TANKREPLAY"
+	// FORMAT_VERSION must be bumped on every change of the file layout
+	FORMAT_VERSION = 2
+	// seconds between two checkpoints
+	CHECKPOINT_INTERVAL = 1.0
+
+	// more would not be a replay of ours
+	MAX_PLAYERS    = 64
+	MAX_MAZE_NODES = 4096
+)
+
+const (
+	// RECORD_ROUND starts a round: varint seed, uvarint seated mask, uvarint maze height and width
+	// and the passages of the maze nodes, two nodes per byte
+	RECORD_ROUND = iota + 1
+	// RECORD_INPUTS holds one byte of protocol buttons per player, written when any input changes.
+	// The inputs hold for every tick until the next RECORD_INPUTS.
+	RECORD_INPUTS
+	// RECORD_EVENT is a sim event: uvarint type and varint character ID
+	RECORD_EVENT
+	// RECORD_END is the tick after the last recorded one
+	RECORD_END
+	// RECORD_CHECKPOINT is sim.World.StateHash after the tick as 8 little endian bytes,
+	// playback compares it with the hash of the world it re-simulated
+	RECORD_CHECKPOINT
+)
+
+var ErrIncompatible = errors.New("incompatible replay")
+
+// Header describes the match a replay was recorded from.
+type Header struct {
+	FormatVersion   int
+	ProtocolVersion int
+	TickRate        int
+	PlayersCount    int
+}
+
+// Record is one entry of a replay, the fields used depend on Type.
+type Record struct {
+	Type byte
+	// Tick is the tick the record belongs to: rounds and inputs take effect from it, events happened during it
+	Tick uint64
+
+	Seed   int64
+	Seated []bool
+	MazeH  int
+	MazeW  int
+	// Maze holds MazeH*MazeW node passages in sim.MAZE_PASSAGE_* bits
+	Maze []byte
+
+	Inputs []models.Input
+
+	EventType   int
+	CharacterID int
+
+	StateHash uint64
+}
+
+func appendHeader(dst []byte, header *Header) []byte {
+	dst = append(dst, MAGIC...)
+	dst = binary.AppendUvarint(dst, uint64(header.FormatVersion))
+	dst = binary.AppendUvarint(dst, uint64(header.ProtocolVersion))
+	dst = binary.AppendUvarint(dst, uint64(header.TickRate))
+	return binary.AppendUvarint(dst, uint64(header.PlayersCount))
+}
+
+// checkHeader tells whether this build plays replays recorded with header.
+func checkHeader(header *Header) error {
+	if header.FormatVersion != FORMAT_VERSION || header.ProtocolVersion != protocol.VERSION {
+		return fmt.Errorf("%w: recorded with format %d and protocol %d, this build plays format %d and protocol %d",
+			ErrIncompatible, header.FormatVersion, header.ProtocolVersion, FORMAT_VERSION, protocol.VERSION)
+	}
+	if header.TickRate < models.MIN_TICK_RATE || header.TickRate > models.MAX_TICK_RATE {
+		return fmt.Errorf("%w: tick rate %d", ErrIncompatible, header.TickRate)
+	}
+	if header.PlayersCount < 1 || header.PlayersCount > MAX_PLAYERS {
+		return fmt.Errorf("%w: %d players", ErrIncompatible, header.PlayersCount)
+	}
+
+	return nil
+}
+
+// appendRecord encodes record, previousTick is the tick of the record written before it.
+func appendRecord(dst []byte, record *Record, previousTick uint64) []byte {
+	dst = append(dst, record.Type)
+	dst = binary.AppendUvarint(dst, record.Tick-previousTick)
+
+	switch record.Type {
+	case RECORD_ROUND:
+		dst = binary.AppendVarint(dst, record.Seed)
+		var seated uint64
+		for i, isSeated := range record.Seated {
+			if isSeated {
+				seated |= 1 << i
+			}
+		}
+		dst = binary.AppendUvarint(dst, seated)
+		dst = binary.AppendUvarint(dst, uint64(record.MazeH))
+		dst = binary.AppendUvarint(dst, uint64(record.MazeW))
+		for i := 0; i < len(record.Maze); i += 2 {
+			b := record.Maze[i]
+			if i+1 < len(record.Maze) {
+				b |= record.Maze[i+1] << 4
+			}
+			dst = append(dst, b)
+		}
+	case RECORD_INPUTS:
+		for _, input := range record.Inputs {
+			dst = append(dst, protocol.Buttons(input))
+		}
+	case RECORD_EVENT:
+		dst = binary.AppendUvarint(dst, uint64(record.EventType))
+		dst = binary.AppendVarint(dst, int64(record.CharacterID))
+	case RECORD_CHECKPOINT:
+		dst = binary.LittleEndian.AppendUint64(dst, record.StateHash)
+	}
+
+	return dst
+}
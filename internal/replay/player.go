@@ -0,0 +1,220 @@
+package replay
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"myebiten/internal/models"
+	"myebiten/internal/sim"
+)
+
+// Desync is the first place a re-simulated world differed from the recorded one.
+type Desync struct {
+	Tick   uint64
+	Reason string
+}
+
+// Player re-simulates a recorded match tick by tick. Seeking back starts over from the first tick,
+// the simulation is fast enough for that. World is replaced on every seek back.
+type Player struct {
+	World *sim.World
+
+	header  Header
+	records []Record
+	// next is the first record not applied yet
+	next    int
+	inputs  []models.Input
+	rounds  []uint64
+	endTick uint64
+
+	// round is the record of the round being played, checked against the maze the world built
+	round  *Record
+	desync *Desync
+}
+
+// Load reads the whole replay at path. A replay cut short, e.g. by a crashed server,
+// plays up to its last complete record.
+func Load(path string) (*Player, error) {
+	replayReader, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer replayReader.Close()
+
+	player := &Player{header: replayReader.Header()}
+	for {
+		var record Record
+		err := replayReader.Next(&record)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) && len(player.records) > 0 {
+			log.Printf("%s: %s, playing what was recorded\n", path, err)
+			player.endTick = player.records[len(player.records)-1].Tick + 1
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		switch record.Type {
+		case RECORD_ROUND:
+			player.rounds = append(player.rounds, record.Tick)
+		case RECORD_END:
+			player.endTick = record.Tick
+		}
+		player.records = append(player.records, record)
+	}
+	if len(player.rounds) == 0 {
+		return nil, fmt.Errorf("%s: %w: no round was recorded", path, ErrMalformed)
+	}
+
+	player.restart()
+	return player, nil
+}
+
+func (player *Player) Header() Header {
+	return player.header
+}
+
+// restart puts the match back before its first tick.
+func (player *Player) restart() {
+	player.World = sim.NewWorld(player.header.PlayersCount, player.records[player.firstRound()].Seed, player.header.TickRate)
+	player.next = 0
+	player.inputs = make([]models.Input, player.header.PlayersCount)
+	player.round = nil
+}
+
+func (player *Player) firstRound() int {
+	for i := range player.records {
+		if player.records[i].Type == RECORD_ROUND {
+			return i
+		}
+	}
+
+	return 0
+}
+
+// Ended tells whether every recorded tick was played.
+func (player *Player) Ended() bool {
+	return player.World.Tick >= player.endTick
+}
+
+// EndTick is the tick after the last recorded one.
+func (player *Player) EndTick() uint64 {
+	return player.endTick
+}
+
+// RoundStarts are the ticks the recorded rounds start at.
+func (player *Player) RoundStarts() []uint64 {
+	return player.rounds
+}
+
+// Desync returns the first difference from the recording found so far.
+func (player *Player) Desync() (Desync, bool) {
+	if player.desync == nil {
+		return Desync{}, false
+	}
+
+	return *player.desync, true
+}
+
+// Step plays the next tick, past the end it does nothing.
+// The returned events are only valid until the next call.
+func (player *Player) Step() []sim.Event {
+	if player.Ended() {
+		return nil
+	}
+
+	world := player.World
+	tick := world.Tick
+
+	// a tick is recorded as its round and inputs followed by what came out of it
+	for ; player.next < len(player.records) && player.records[player.next].Tick == tick; player.next++ {
+		record := &player.records[player.next]
+		if record.Type == RECORD_ROUND {
+			copy(world.Seated, record.Seated)
+			player.round = record
+		} else if record.Type == RECORD_INPUTS {
+			copy(player.inputs, record.Inputs)
+		} else {
+			break
+		}
+	}
+
+	events := world.Step(player.inputs)
+	for _, event := range events {
+		if event.Type == sim.EVENT_ROUND_STARTED {
+			player.checkMaze(tick)
+		}
+	}
+
+	for ; player.next < len(player.records) && player.records[player.next].Tick == tick; player.next++ {
+		record := &player.records[player.next]
+		if record.Type != RECORD_CHECKPOINT {
+			continue
+		}
+		if hash := world.StateHash(); hash != record.StateHash {
+			player.reportDesync(tick, fmt.Sprintf("state hash %016x, recorded %016x", hash, record.StateHash))
+		}
+	}
+
+	return events
+}
+
+// Seek plays the match up to tick, the next Step plays tick itself.
+func (player *Player) Seek(tick uint64) {
+	if tick < player.World.Tick {
+		player.restart()
+	}
+
+	for player.World.Tick < tick && !player.Ended() {
+		player.Step()
+	}
+}
+
+// RoundIndex is the index in RoundStarts of the round being played, -1 before the first one.
+func (player *Player) RoundIndex() int {
+	index := -1
+	for i, start := range player.rounds {
+		if start < player.World.Tick {
+			index = i
+		}
+	}
+
+	return index
+}
+
+// checkMaze compares the maze of the round started at tick with the recorded one.
+func (player *Player) checkMaze(tick uint64) {
+	round := player.round
+	world := player.World
+	if round == nil || round.Tick != tick || round.Seed != world.Seed {
+		player.reportDesync(tick, "a round started that was not recorded")
+		return
+	}
+
+	if len(world.Maze) != round.MazeH {
+		player.reportDesync(tick, fmt.Sprintf("maze of %d rows, recorded %d", len(world.Maze), round.MazeH))
+		return
+	}
+	for i := range world.Maze {
+		for j := range world.Maze[i] {
+			if j >= round.MazeW || world.Maze[i][j].Passages() != round.Maze[i*round.MazeW+j] {
+				player.reportDesync(tick, fmt.Sprintf("maze node %d,%d differs from the recorded %dx%d maze", i, j, round.MazeH, round.MazeW))
+				return
+			}
+		}
+	}
+}
+
+func (player *Player) reportDesync(tick uint64, reason string) {
+	if player.desync != nil && player.desync.Tick <= tick {
+		return
+	}
+
+	player.desync = &Desync{Tick: tick, Reason: reason}
+	log.Printf("replay desync at tick %d: %s\n", tick, reason)
+}
@@ -0,0 +1,97 @@
+package replay
+
+import (
+	"os"
+	"testing"
+)
+
+// checkPlayback steps player to its end comparing the world with the recorded hashes.
+func checkPlayback(t *testing.T, player *Player, hashes []uint64) {
+	t.Helper()
+
+	for !player.Ended() {
+		player.Step()
+		tick := player.World.Tick - 1
+		if hash := player.World.StateHash(); hash != hashes[tick] {
+			t.Fatalf("tick %d: replayed state hash %016x, recorded world had %016x", tick, hash, hashes[tick])
+		}
+	}
+	if desync, ok := player.Desync(); ok {
+		t.Fatalf("desync at tick %d: %s", desync.Tick, desync.Reason)
+	}
+}
+
+func TestReplayPlaysRecordedMatch(t *testing.T) {
+	path, hashes := recordMatch(t)
+	player, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkPlayback(t, player, hashes)
+	if player.World.Tick != TEST_TICKS || player.EndTick() != TEST_TICKS {
+		t.Fatalf("playback ended at tick %d, end tick %d, want %d", player.World.Tick, player.EndTick(), TEST_TICKS)
+	}
+
+	rounds := player.RoundStarts()
+	if len(rounds) < 2 {
+		t.Fatalf("got %d rounds", len(rounds))
+	}
+	// seeking back plays the match again from its first tick
+	start := rounds[1]
+	player.Seek(start)
+	if player.World.Tick != start || player.World.StateHash() != hashes[start-1] {
+		t.Fatalf("seek to tick %d got to tick %d with another world", start, player.World.Tick)
+	}
+	if index := player.RoundIndex(); index != 0 {
+		t.Fatalf("at the start of the second round the round index is %d", index)
+	}
+	checkPlayback(t, player, hashes)
+}
+
+func TestTruncatedReplayPlaysUpToLastRecord(t *testing.T) {
+	path, hashes := recordMatch(t)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data[:len(data)/2], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	records, _ := readRecords(t, path)
+	last := records[len(records)-1]
+
+	player, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if player.EndTick() != last.Tick+1 {
+		t.Fatalf("got end tick %d, the last complete record is of tick %d", player.EndTick(), last.Tick)
+	}
+
+	checkPlayback(t, player, hashes)
+	if player.World.Tick != last.Tick+1 {
+		t.Fatalf("playback ended at tick %d, want %d", player.World.Tick, last.Tick+1)
+	}
+}
+
+func TestChangedWorldDesyncsAtNextCheckpoint(t *testing.T) {
+	path, _ := recordMatch(t)
+	player, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	player.Seek(TEST_TICK_RATE / 2)
+	player.World.CharactersScores[0]++
+	player.Seek(player.EndTick())
+
+	desync, ok := player.Desync()
+	if !ok {
+		t.Fatal("a changed score was not noticed")
+	}
+	// the first checkpoint is written after the tick that completes the first second
+	if desync.Tick != TEST_TICK_RATE-1 {
+		t.Fatalf("got desync at tick %d, want the checkpoint of tick %d", desync.Tick, TEST_TICK_RATE-1)
+	}
+}
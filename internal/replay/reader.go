@@ -0,0 +1,190 @@
+package replay
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"myebiten/internal/protocol"
+)
+
+var ErrMalformed = errors.New("malformed replay")
+
+// Reader reads the records of a replay file in the order they were written.
+type Reader struct {
+	file   *os.File
+	reader *bufio.Reader
+	header Header
+
+	lastTick uint64
+	ended    bool
+}
+
+// Open reads the header of the replay at path, replays of other versions return ErrIncompatible.
+func Open(path string) (*Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	replayReader := &Reader{file: file, reader: bufio.NewReader(file)}
+	if err := replayReader.readHeader(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return replayReader, nil
+}
+
+func (r *Reader) Header() Header {
+	return r.header
+}
+
+func (r *Reader) readHeader() error {
+	magic := make([]byte, len(MAGIC))
+	if _, err := io.ReadFull(r.reader, magic); err != nil || string(magic) != MAGIC {
+		return fmt.Errorf("%w: not a replay file", ErrIncompatible)
+	}
+
+	values := []*int{&r.header.FormatVersion, &r.header.ProtocolVersion, &r.header.TickRate, &r.header.PlayersCount}
+	for _, value := range values {
+		v, err := binary.ReadUvarint(r.reader)
+		if err != nil {
+			return fmt.Errorf("%w: header: %s", ErrMalformed, err)
+		}
+		*value = int(min(v, 1<<31))
+	}
+
+	return checkHeader(&r.header)
+}
+
+// Next reads the next record into record, reusing its slices.
+// It returns io.EOF after RECORD_END, a file cut short before it is ErrMalformed.
+func (r *Reader) Next(record *Record) error {
+	if r.ended {
+		return io.EOF
+	}
+
+	recordType, err := r.reader.ReadByte()
+	if err != nil {
+		return r.malformed(err)
+	}
+	delta, err := binary.ReadUvarint(r.reader)
+	if err != nil {
+		return r.malformed(err)
+	}
+	r.lastTick += delta
+	record.Type = recordType
+	record.Tick = r.lastTick
+
+	switch recordType {
+	case RECORD_ROUND:
+		err = r.readRound(record)
+	case RECORD_INPUTS:
+		err = r.readInputs(record)
+	case RECORD_EVENT:
+		err = r.readEvent(record)
+	case RECORD_CHECKPOINT:
+		var hash [8]byte
+		_, err = io.ReadFull(r.reader, hash[:])
+		record.StateHash = binary.LittleEndian.Uint64(hash[:])
+	case RECORD_END:
+		r.ended = true
+	default:
+		err = fmt.Errorf("unknown record type %d", recordType)
+	}
+
+	if err != nil {
+		return r.malformed(err)
+	}
+	return nil
+}
+
+func (r *Reader) readRound(record *Record) error {
+	seed, err := binary.ReadVarint(r.reader)
+	if err != nil {
+		return err
+	}
+	seated, err := binary.ReadUvarint(r.reader)
+	if err != nil {
+		return err
+	}
+	mazeH, err := binary.ReadUvarint(r.reader)
+	if err != nil {
+		return err
+	}
+	mazeW, err := binary.ReadUvarint(r.reader)
+	if err != nil {
+		return err
+	}
+	if mazeH*mazeW > MAX_MAZE_NODES {
+		return fmt.Errorf("maze of %dx%d nodes", mazeH, mazeW)
+	}
+
+	record.Seed = seed
+	record.Seated = record.Seated[:0]
+	for i := range r.header.PlayersCount {
+		record.Seated = append(record.Seated, seated&(1<<i) != 0)
+	}
+	record.MazeH, record.MazeW = int(mazeH), int(mazeW)
+
+	packed := make([]byte, (record.MazeH*record.MazeW+1)/2)
+	if _, err := io.ReadFull(r.reader, packed); err != nil {
+		return err
+	}
+	record.Maze = record.Maze[:0]
+	for i := range record.MazeH * record.MazeW {
+		record.Maze = append(record.Maze, packed[i/2]>>(4*(i%2))&0x0f)
+	}
+
+	return nil
+}
+
+func (r *Reader) readInputs(record *Record) error {
+	record.Inputs = record.Inputs[:0]
+	for range r.header.PlayersCount {
+		b, err := r.reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b&^protocol.BUTTONS_MASK != 0 {
+			return fmt.Errorf("unknown buttons %08b", b&^protocol.BUTTONS_MASK)
+		}
+		record.Inputs = append(record.Inputs, protocol.InputFromButtons(b))
+	}
+
+	return nil
+}
+
+func (r *Reader) readEvent(record *Record) error {
+	eventType, err := binary.ReadUvarint(r.reader)
+	if err != nil {
+		return err
+	}
+	characterID, err := binary.ReadVarint(r.reader)
+	if err != nil {
+		return err
+	}
+	if characterID < -1 || characterID >= int64(r.header.PlayersCount) {
+		return fmt.Errorf("event about character %d", characterID)
+	}
+
+	record.EventType = int(min(eventType, 1<<31))
+	record.CharacterID = int(characterID)
+	return nil
+}
+
+func (r *Reader) malformed(err error) error {
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return fmt.Errorf("%w at tick %d: %w", ErrMalformed, r.lastTick, err)
+}
+
+func (r *Reader) Close() error {
+	return r.file.Close()
+}
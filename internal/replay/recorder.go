@@ -0,0 +1,166 @@
+package replay
+
+import (
+	"bufio"
+	"log"
+	"os"
+
+	"myebiten/internal/models"
+	"myebiten/internal/protocol"
+	"myebiten/internal/sim"
+)
+
+// Recorder writes a match to a replay file while it is played. The world replays exactly
+// from its round seeds, seats and inputs, events are kept to find the moments worth watching.
+// A write error is logged once and stops the recording, the match goes on.
+type Recorder struct {
+	file   *os.File
+	writer *bufio.Writer
+	failed bool
+
+	playersCount    int
+	checkpointTicks uint64
+	lastTick        uint64
+	lastInputs      []models.Input
+	record          Record
+	buffer          []byte
+}
+
+// Create starts recording the match of world to path, it must be called before the first Step.
+func Create(path string, world *sim.World) (*Recorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	recorder := &Recorder{
+		file:            file,
+		writer:          bufio.NewWriter(file),
+		playersCount:    world.PlayersCount,
+		checkpointTicks: uint64(max(models.Ticks(CHECKPOINT_INTERVAL, world.TickRate), 1)),
+	}
+	header := Header{
+		FormatVersion:   FORMAT_VERSION,
+		ProtocolVersion: protocol.VERSION,
+		TickRate:        world.TickRate,
+		PlayersCount:    world.PlayersCount,
+	}
+	if _, err := recorder.writer.Write(appendHeader(nil, &header)); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	log.Printf("recording the match to %s\n", path)
+	return recorder, nil
+}
+
+// Record stores the tick world.Step just simulated with inputs and returned events,
+// it must be called after every Step.
+func (recorder *Recorder) Record(world *sim.World, inputs []models.Input, events []sim.Event) {
+	if recorder.failed {
+		return
+	}
+	tick := world.Tick - 1
+
+	for _, event := range events {
+		if event.Type == sim.EVENT_ROUND_STARTED {
+			recorder.writeRound(world, tick)
+		}
+	}
+
+	if recorder.inputsChanged(inputs) {
+		copy(recorder.lastInputs, inputs)
+		recorder.record = Record{Type: RECORD_INPUTS, Tick: tick, Inputs: recorder.lastInputs}
+		recorder.write()
+	}
+
+	for _, event := range events {
+		recorder.record = Record{Type: RECORD_EVENT, Tick: tick, EventType: event.Type, CharacterID: event.CharacterID}
+		recorder.write()
+		if event.Type == sim.EVENT_ROUND_ENDED {
+			// a crash loses at most the round being played
+			recorder.flush()
+		}
+	}
+
+	if world.Tick%recorder.checkpointTicks == 0 {
+		recorder.record = Record{Type: RECORD_CHECKPOINT, Tick: tick, StateHash: world.StateHash()}
+		recorder.write()
+	}
+}
+
+// writeRound stores what the round starting at tick was built from.
+// The seats are the ones the round was set up with, players joining later only play from the next round.
+func (recorder *Recorder) writeRound(world *sim.World, tick uint64) {
+	maze := make([]byte, 0, len(world.Maze)*recorder.mazeWidth(world))
+	for i := range world.Maze {
+		for j := range world.Maze[i] {
+			maze = append(maze, world.Maze[i][j].Passages())
+		}
+	}
+
+	recorder.record = Record{
+		Type:   RECORD_ROUND,
+		Tick:   tick,
+		Seed:   world.Seed,
+		Seated: world.Seated,
+		MazeH:  len(world.Maze),
+		MazeW:  recorder.mazeWidth(world),
+		Maze:   maze,
+	}
+	recorder.write()
+}
+
+func (recorder *Recorder) mazeWidth(world *sim.World) int {
+	if len(world.Maze) == 0 {
+		return 0
+	}
+
+	return len(world.Maze[0])
+}
+
+// inputsChanged compares inputs with the last written ones, missing players keep their input.
+func (recorder *Recorder) inputsChanged(inputs []models.Input) bool {
+	if len(recorder.lastInputs) == 0 {
+		recorder.lastInputs = make([]models.Input, recorder.playersCount)
+		return true
+	}
+
+	for i := range min(len(inputs), recorder.playersCount) {
+		if inputs[i] != recorder.lastInputs[i] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (recorder *Recorder) write() {
+	recorder.buffer = appendRecord(recorder.buffer[:0], &recorder.record, recorder.lastTick)
+	recorder.lastTick = recorder.record.Tick
+	if _, err := recorder.writer.Write(recorder.buffer); err != nil {
+		recorder.fail(err)
+	}
+}
+
+func (recorder *Recorder) flush() {
+	if err := recorder.writer.Flush(); err != nil {
+		recorder.fail(err)
+	}
+}
+
+func (recorder *Recorder) fail(err error) {
+	log.Printf("recording stopped: %s\n", err)
+	recorder.failed = true
+}
+
+// Close ends the replay after the last recorded tick and closes the file.
+func (recorder *Recorder) Close(world *sim.World) error {
+	if !recorder.failed {
+		recorder.record = Record{Type: RECORD_END, Tick: world.Tick}
+		recorder.write()
+		recorder.flush()
+	}
+
+	return recorder.file.Close()
+}
@@ -0,0 +1,145 @@
+package replay
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"myebiten/internal/models"
+	"myebiten/internal/protocol"
+	"myebiten/internal/sim"
+)
+
+const (
+	TEST_PLAYERS   = 3
+	TEST_TICK_RATE = 60
+	TEST_TICKS     = 20 * TEST_TICK_RATE
+)
+
+// recordMatch records TEST_TICKS seeded ticks of scripted play to a file in a temp dir.
+// It returns the path and the state hash of the world after every tick.
+func recordMatch(t *testing.T) (string, []uint64) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "match.replay")
+	world := sim.NewWorld(TEST_PLAYERS, 42, TEST_TICK_RATE)
+	recorder, err := Create(path, world)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hashes := make([]uint64, TEST_TICKS)
+	inputs := make([]models.Input, TEST_PLAYERS)
+	for tick := range hashes {
+		for player := range inputs {
+			phase := (tick/20 + player*5) % 8
+			inputs[player] = models.Input{
+				MoveForward: phase != 3 && phase != 7,
+				RotateLeft:  phase == 1 || phase == 4,
+				RotateRight: phase == 2 || phase == 6,
+				Shoot:       (tick+player*7)%15 == 0,
+			}
+		}
+
+		events := world.Step(inputs)
+		recorder.Record(world, inputs, events)
+		hashes[tick] = world.StateHash()
+	}
+	if err := recorder.Close(world); err != nil {
+		t.Fatal(err)
+	}
+
+	return path, hashes
+}
+
+// readRecords reads the records of the replay at path until the first error, which is returned with them.
+func readRecords(t *testing.T, path string) ([]Record, error) {
+	t.Helper()
+
+	replayReader, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replayReader.Close()
+
+	var records []Record
+	for {
+		var record Record
+		if err := replayReader.Next(&record); err != nil {
+			return records, err
+		}
+		records = append(records, record)
+	}
+}
+
+func TestRecordedMatchReadsBack(t *testing.T) {
+	path, _ := recordMatch(t)
+
+	replayReader, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := replayReader.Header()
+	replayReader.Close()
+	want := Header{FormatVersion: FORMAT_VERSION, ProtocolVersion: protocol.VERSION, TickRate: TEST_TICK_RATE, PlayersCount: TEST_PLAYERS}
+	if header != want {
+		t.Fatalf("got header %+v, want %+v", header, want)
+	}
+
+	records, err := readRecords(t, path)
+	if !errors.Is(err, io.EOF) {
+		t.Fatalf("got %v after %d records, want io.EOF", err, len(records))
+	}
+
+	counts := map[byte]int{}
+	var tick uint64
+	for _, record := range records {
+		if record.Tick < tick {
+			t.Fatalf("record of tick %d after tick %d", record.Tick, tick)
+		}
+		tick = record.Tick
+		counts[record.Type]++
+	}
+	if counts[RECORD_ROUND] < 2 || counts[RECORD_INPUTS] == 0 || counts[RECORD_EVENT] == 0 {
+		t.Fatalf("got %d rounds, %d inputs and %d events", counts[RECORD_ROUND], counts[RECORD_INPUTS], counts[RECORD_EVENT])
+	}
+	if counts[RECORD_CHECKPOINT] != TEST_TICKS/TEST_TICK_RATE {
+		t.Fatalf("got %d checkpoints in %d seconds", counts[RECORD_CHECKPOINT], TEST_TICKS/TEST_TICK_RATE)
+	}
+	if last := records[len(records)-1]; last.Type != RECORD_END || last.Tick != TEST_TICKS {
+		t.Fatalf("got last record %d at tick %d, want the end at tick %d", last.Type, last.Tick, TEST_TICKS)
+	}
+}
+
+func TestTruncatedReplayIsMalformed(t *testing.T) {
+	path, _ := recordMatch(t)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data[:len(data)/2], 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := readRecords(t, path)
+	if !errors.Is(err, ErrMalformed) || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("got %v, want ErrMalformed for an unexpected EOF", err)
+	}
+	if len(records) == 0 || records[len(records)-1].Type == RECORD_END {
+		t.Fatalf("got %d records of a file cut in half", len(records))
+	}
+}
+
+func TestOtherFormatVersionIsIncompatible(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "other.replay")
+	header := Header{FormatVersion: FORMAT_VERSION + 1, ProtocolVersion: protocol.VERSION, TickRate: TEST_TICK_RATE, PlayersCount: TEST_PLAYERS}
+	if err := os.WriteFile(path, appendHeader(nil, &header), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open(path); !errors.Is(err, ErrIncompatible) {
+		t.Fatalf("got %v, want ErrIncompatible", err)
+	}
+}
@@ -0,0 +1,43 @@
+package sim
+
+import (
+	"time"
+)
+
+// MAX_CATCH_UP is the most simulated time a Clock hands out at once,
+// after a longer stall the world skips ahead instead of racing through the missed ticks.
+const MAX_CATCH_UP = 250 * time.Millisecond
+
+// Clock counts the ticks due at a fixed tick rate however often it is asked,
+// so windows step the world at its tick rate whatever their frame rate is.
+type Clock struct {
+	TickRate int
+
+	start time.Time
+	ticks uint64
+}
+
+func NewClock(tickRate int) *Clock {
+	return &Clock{TickRate: tickRate}
+}
+
+// Due returns how many ticks to step now, the first call is due one tick.
+func (clock *Clock) Due(now time.Time) int {
+	if clock.start.IsZero() {
+		clock.start = now
+	}
+
+	target := uint64(now.Sub(clock.start)*time.Duration(clock.TickRate)/time.Second) + 1
+	if target <= clock.ticks {
+		return 0
+	}
+
+	maxTicks := uint64(MAX_CATCH_UP * time.Duration(clock.TickRate) / time.Second)
+	if target-clock.ticks > maxTicks {
+		clock.ticks = target - maxTicks
+	}
+
+	due := int(target - clock.ticks)
+	clock.ticks = target
+	return due
+}
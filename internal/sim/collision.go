@@ -0,0 +1,177 @@
+package sim
+
+import (
+	"myebiten/internal/models"
+	"myebiten/internal/models/character"
+)
+
+func (world *World) getClosestWalls(c *character.Character) []*models.Wall {
+	// yes, this is shit, I see it too, dw it will all change
+	i, j := getMazeCoordinates(c.Position)
+	if i < 1 || i >= len(world.Maze)-1 || j < 1 || j >= len(world.Maze[0])-1 {
+		return nil
+	}
+
+	k := 0
+	if world.Maze[i][j].topWall != nil {
+		world.wallsToCheck[k] = world.Maze[i][j].topWall
+		k++
+	}
+	if world.Maze[i][j].bottomWall != nil {
+		world.wallsToCheck[k] = world.Maze[i][j].bottomWall
+		k++
+	}
+	if world.Maze[i][j].leftWall != nil {
+		world.wallsToCheck[k] = world.Maze[i][j].leftWall
+		k++
+	}
+	if world.Maze[i][j].rightWall != nil {
+		world.wallsToCheck[k] = world.Maze[i][j].rightWall
+		k++
+	}
+
+	if world.Maze[i-1][j].leftWall != nil {
+		world.wallsToCheck[k] = world.Maze[i-1][j].leftWall
+		k++
+	}
+	if world.Maze[i-1][j].rightWall != nil {
+		world.wallsToCheck[k] = world.Maze[i-1][j].rightWall
+		k++
+	}
+
+	if world.Maze[i+1][j].leftWall != nil {
+		world.wallsToCheck[k] = world.Maze[i+1][j].leftWall
+		k++
+	}
+	if world.Maze[i+1][j].rightWall != nil {
+		world.wallsToCheck[k] = world.Maze[i+1][j].rightWall
+		k++
+	}
+
+	if world.Maze[i][j-1].topWall != nil {
+		world.wallsToCheck[k] = world.Maze[i][j-1].topWall
+		k++
+	}
+	if world.Maze[i][j-1].bottomWall != nil {
+		world.wallsToCheck[k] = world.Maze[i][j-1].bottomWall
+		k++
+	}
+
+	if world.Maze[i][j+1].topWall != nil {
+		world.wallsToCheck[k] = world.Maze[i][j+1].topWall
+		k++
+	}
+	if world.Maze[i][j+1].bottomWall != nil {
+		world.wallsToCheck[k] = world.Maze[i][j+1].bottomWall
+		k++
+	}
+
+	return world.wallsToCheck[:k]
+}
+
+func (world *World) DetectCharacterToWallCollision(c *character.Character) {
+	closestWalls := world.getClosestWalls(c)
+	for _, w := range closestWalls {
+		isCollide := c.DetectWallCollision(*w)
+		if isCollide {
+			c.MoveBack()
+		}
+	}
+}
+
+func (world *World) DetectBulletToWallCollision(b *models.Bullet) {
+	wh := float64(WALL_HEIGHT)
+	ww := float64(WALL_WIDTH)
+
+	i, j := getMazeCoordinates(b.Position)
+	nodeCenter := getSceneCoordinates(i, j)
+
+	if i >= len(world.Maze)-1 || i < 0 || j >= len(world.Maze[0])-1 || j < 0 {
+		return
+	}
+
+	// Here top and bottom mean how these directions appear on the screen
+	// meaning, that distToTop actually measures the distance to the wall
+	// that is stored as MazeNode.bottomWall
+	distToTop := b.Position.Y - (nodeCenter.Y - wh/2 + ww)
+	distToRight := (nodeCenter.X + wh/2 - ww) - b.Position.X
+	distToLeft := b.Position.X - (nodeCenter.X - wh/2 + ww)
+	distToBottom := (nodeCenter.Y + wh/2 - ww) - b.Position.Y
+
+	minDist := min(distToBottom, distToLeft, distToRight, distToTop)
+
+	if minDist > b.R {
+		return
+	}
+
+	var horizontalReflection, verticalReflection bool = false, false
+
+	if minDist == distToBottom {
+		// again, because of mismatch between how directions are logically stored
+		// and how they are presented on screen bottom reflection requires MazeNode.topWall
+
+		// check if the top wall is present
+		horizontalReflection = !world.Maze[i][j].up
+
+		// if close to the left check 3 corner walls, same if close to the right
+		// if at least one corner wall is present, perform reflection
+		verticalReflection = (distToLeft < b.R) && !(world.Maze[i][j].up && world.Maze[i+1][j].left && world.Maze[i][j-1].up) ||
+			(distToRight < b.R) && !(world.Maze[i][j].up && world.Maze[i+1][j].right && world.Maze[i][j+1].up)
+
+		// prioritize reflection of the main wall
+		verticalReflection = verticalReflection && !horizontalReflection
+	}
+
+	if minDist == distToTop {
+		// check comments in minDist == distToBottom block
+		horizontalReflection = !world.Maze[i][j].down
+
+		verticalReflection = (distToLeft < b.R) && !(world.Maze[i][j].down && world.Maze[i-1][j].left && world.Maze[i][j-1].down) ||
+			(distToRight < b.R) && !(world.Maze[i][j].down && world.Maze[i-1][j].right && world.Maze[i][j+1].down)
+
+		verticalReflection = verticalReflection && !horizontalReflection
+	}
+
+	if minDist == distToLeft {
+		// check comments in minDist == distToBottom block
+		verticalReflection = !world.Maze[i][j].left
+
+		horizontalReflection = (distToTop < b.R) && !(world.Maze[i][j].down && world.Maze[i-1][j].left && world.Maze[i][j-1].down) ||
+			(distToBottom < b.R) && !(world.Maze[i][j].up && world.Maze[i+1][j].left && world.Maze[i][j-1].up)
+
+		horizontalReflection = horizontalReflection && !verticalReflection
+	}
+
+	if minDist == distToRight {
+		// check comments in minDist == distToBottom block
+		verticalReflection = !world.Maze[i][j].right
+
+		horizontalReflection = (distToTop < b.R) && !(world.Maze[i][j].down && world.Maze[i-1][j].right && world.Maze[i][j+1].down) ||
+			(distToBottom < b.R) && !(world.Maze[i][j].up && world.Maze[i+1][j].right && world.Maze[i][j+1].up)
+
+		horizontalReflection = horizontalReflection && !verticalReflection
+	}
+
+	if verticalReflection {
+		// cosine := math.Abs(b.Speed.X) / b.Speed.Length()
+		// l := minDist / cosine
+		// L := b.R / cosine
+		// t := (L - l) / b.Speed.Length()
+
+		// b.Position.X -= t * b.Speed.X
+		// b.Position.Y -= t * b.Speed.Y
+
+		b.Speed.X = -b.Speed.X
+
+	} else if horizontalReflection {
+		// cosine := math.Abs(b.Speed.Y) / b.Speed.Length()
+		// l := minDist / cosine
+		// L := b.R / cosine
+		// t := (L - l) / b.Speed.Length()
+
+		// b.Position.X -= t * b.Speed.X
+		// b.Position.Y -= t * b.Speed.Y
+
+		b.Speed.Y = -b.Speed.Y
+	}
+}
@@ -0,0 +1,28 @@
+package sim
+
+import "myebiten/internal/models/item"
+
+const (
+	EVENT_ROUND_STARTED = iota
+	EVENT_ROUND_ENDED
+	EVENT_ITEM_SPAWNED
+	EVENT_ITEM_PICKED
+	EVENT_CHARACTER_KILLED
+)
+
+// Event tells the caller of Step about something that happened during a tick.
+// CharacterID is -1 when the event is not about a character,
+// e.g. a round that ended without a winner.
+type Event struct {
+	Type        int
+	CharacterID int
+	Item        *item.Item
+}
+
+func (world *World) emit(eventType, characterID int, eventItem *item.Item) {
+	world.events = append(world.events, Event{
+		Type:        eventType,
+		CharacterID: characterID,
+		Item:        eventItem,
+	})
+}
@@ -1,4 +1,4 @@
-package game
+package sim
 
 type Generator struct {
 	sources func(int, int) []Coordinates
@@ -0,0 +1,82 @@
+package sim
+
+import (
+	"math"
+
+	"myebiten/internal/models"
+)
+
+const (
+	FNV_OFFSET = 14695981039346656037
+	FNV_PRIME  = 1099511628211
+)
+
+// Hash is a 64-bit FNV-1a hash fed eight bytes at a time, stable across runs and platforms.
+type Hash uint64
+
+func NewHash() Hash {
+	return FNV_OFFSET
+}
+
+func (hash *Hash) Add(value uint64) {
+	for range 8 {
+		*hash ^= Hash(value & 0xff)
+		*hash *= FNV_PRIME
+		value >>= 8
+	}
+}
+
+func (hash *Hash) AddFloat(value float64) {
+	hash.Add(math.Float64bits(value))
+}
+
+func (hash *Hash) AddBool(value bool) {
+	if value {
+		hash.Add(1)
+	} else {
+		hash.Add(0)
+	}
+}
+
+func (hash *Hash) addObject(object *models.GameObject) {
+	hash.AddBool(object.Active)
+	if !object.Active {
+		return
+	}
+
+	hash.AddFloat(object.Position.X)
+	hash.AddFloat(object.Position.Y)
+	hash.AddFloat(object.Rotation)
+	hash.AddFloat(object.Speed.X)
+	hash.AddFloat(object.Speed.Y)
+}
+
+// StateHash hashes the exact state of the round: the tick, the scores, the characters, bullets and items.
+// Worlds stepped with the same seed and inputs on the same build have the same hash at every tick.
+func (world *World) StateHash() uint64 {
+	hash := NewHash()
+	hash.Add(world.Tick)
+	hash.Add(uint64(world.state))
+	for _, score := range world.CharactersScores {
+		hash.Add(uint64(score))
+	}
+
+	for _, char := range world.Characters {
+		hash.addObject(&char.GameObject)
+	}
+	for _, bullet := range world.Bullets {
+		hash.addObject(&bullet.GameObject)
+		if bullet.IsActive() {
+			hash.AddFloat(bullet.R)
+			hash.Add(uint64(bullet.TTL))
+		}
+	}
+	for _, worldItem := range world.Items {
+		hash.addObject(&worldItem.GameObject)
+		if worldItem.IsActive() {
+			hash.Add(uint64(worldItem.Type))
+		}
+	}
+
+	return uint64(hash)
+}
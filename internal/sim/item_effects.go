@@ -0,0 +1,53 @@
+package sim
+
+import (
+	"myebiten/internal/models"
+	"myebiten/internal/models/character"
+	"myebiten/internal/models/item"
+	"myebiten/internal/weapons"
+)
+
+func (world *World) applyItemEffect(itemToApply *item.Item, char *character.Character, charIndex int) {
+	switch itemToApply.Type {
+	case item.TypeExplosion:
+		world.applyExplosion(char, charIndex)
+	case item.TypeMinigun:
+		world.applyMinigun(char)
+	case item.TypeRocket:
+		world.applyRocket(char, charIndex)
+	}
+}
+
+func (world *World) applyExplosion(char *character.Character, charIndex int) {
+	clip := world.weaponClipFor(charIndex)
+	char.SetWeapon(weapons.NewExplosionWeapon(clip, world.TickRate))
+}
+
+func (world *World) applyMinigun(char *character.Character) {
+	start := weapons.DEFAULT_GUN_BULLETS_COUNT*world.PlayersCount + char.ID*weapons.MINIGUN_BULLETS_COUNT
+	end := weapons.DEFAULT_GUN_BULLETS_COUNT*world.PlayersCount + (char.ID+1)*weapons.MINIGUN_BULLETS_COUNT
+	clip := models.CreatePool(world.Bullets[start:end])
+
+	char.SetWeapon(weapons.NewMinigunWeapon(clip, world.rng, world.TickRate))
+}
+
+func (world *World) applyRocket(char *character.Character, charIndex int) {
+	clip := world.weaponClipFor(charIndex)
+	char.SetWeapon(weapons.NewRocketWeapon(clip, world.TickRate))
+}
+
+func (world *World) weaponClipFor(charIndex int) models.Pool[*models.Bullet] {
+	start := charIndex * weapons.DEFAULT_GUN_BULLETS_COUNT
+	end := (charIndex + 1) * weapons.DEFAULT_GUN_BULLETS_COUNT
+	return models.CreatePool(world.Bullets[start:end])
+}
+
+func (world *World) randomItemType() item.ItemType {
+	itemTypes := []item.ItemType{item.TypeExplosion, item.TypeMinigun, item.TypeRocket}
+	selected := itemTypes[world.rng.Intn(len(itemTypes))]
+
+	//TODO: REMOVE THIS LINES TO SPAWN OTHER ITEM TYPES
+	selected = item.TypeMinigun
+
+	return selected
+}
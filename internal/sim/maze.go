@@ -1,4 +1,4 @@
-package game
+package sim
 
 import (
 	"math"
@@ -7,6 +7,7 @@ import (
 	"myebiten/internal/models"
 )
 
+// Mazes have from MIN up to but not including MAX nodes per side.
 const (
 	MAX_BOARD_HEIGHT = 7
 	MAX_BOARD_WIDTH  = 12
@@ -35,6 +36,26 @@ type MazeNode struct {
 	topWall, bottomWall, rightWall, leftWall *models.Wall
 }
 
+// MAZE_PASSAGE_* are the bits of MazeNode.Passages.
+const (
+	MAZE_PASSAGE_UP = 1 << iota
+	MAZE_PASSAGE_DOWN
+	MAZE_PASSAGE_RIGHT
+	MAZE_PASSAGE_LEFT
+)
+
+// Passages packs the directions the node is open to into MAZE_PASSAGE_* bits.
+func (mNode *MazeNode) Passages() byte {
+	var passages byte
+	for bit, open := range []bool{mNode.up, mNode.down, mNode.right, mNode.left} {
+		if open {
+			passages |= 1 << bit
+		}
+	}
+
+	return passages
+}
+
 func (mNode *MazeNode) addDirection(x, y int) {
 	if y == 0 {
 		if x == 1 {
@@ -69,7 +90,7 @@ func getSceneCoordinates(i, j int) models.Vector2D {
 	return models.Vector2D{X: float64(j-1)*(wh-ww) + wh/2, Y: float64(i-1)*(wh-ww) + wh/2}
 }
 
-func getRandomDirection(prevDir int) int {
+func getRandomDirection(rng *rand.Rand, prevDir int) int {
 	distribution := [4]float32{0.25, 0.25, 0.25, 0.25}
 
 	if prevDir != -1 {
@@ -79,7 +100,7 @@ func getRandomDirection(prevDir int) int {
 		distribution[prevDir] = 0.1
 	}
 
-	p := rand.Float32()
+	p := rng.Float32()
 
 	var s float32 = 0.0
 	for index := range distribution {
@@ -92,15 +113,15 @@ func getRandomDirection(prevDir int) int {
 	return -1
 }
 
-func getInitialMaze(N, M int) ([][]MazeNode, Coordinates) {
+func getInitialMaze(rng *rand.Rand, N, M int) ([][]MazeNode, Coordinates) {
 	mazeNodes := make([][]MazeNode, N+2)
 	for i := range N + 2 {
 		mazeNodes[i] = make([]MazeNode, M+2)
 	}
 
-	root := Coordinates{rand.Intn(N) + 1, rand.Intn(M) + 1}
+	root := Coordinates{rng.Intn(N) + 1, rng.Intn(M) + 1}
 
-	randomInt := rand.Intn(len(Generators))
+	randomInt := rng.Intn(len(Generators))
 
 	sources := Generators[randomInt].sources
 	next := Generators[randomInt].next
@@ -126,19 +147,19 @@ func getInitialMaze(N, M int) ([][]MazeNode, Coordinates) {
 	return mazeNodes, root
 }
 
-func addConnections(mazeNodes [][]MazeNode) [][]MazeNode {
+func addConnections(rng *rand.Rand, mazeNodes [][]MazeNode) [][]MazeNode {
 	count := min(len(mazeNodes), len(mazeNodes[0])) - 2
 	total := (len(mazeNodes)-2)*(len(mazeNodes[0])-2) - len(mazeNodes) - len(mazeNodes[0]) + 4
 	p := float64(count) / float64(total)
 
 	for i := 1; i <= len(mazeNodes)-2; i++ {
 		for j := 1; j <= len(mazeNodes[0])-2; j++ {
-			randomFloat := rand.Float64()
+			randomFloat := rng.Float64()
 			if i != len(mazeNodes)-2 && !mazeNodes[i][j].up && randomFloat <= p {
 				mazeNodes[i][j].up = true
 			}
 
-			randomFloat = rand.Float64()
+			randomFloat = rng.Float64()
 			if j != len(mazeNodes[0])-2 && !mazeNodes[i][j].right && randomFloat <= p {
 				mazeNodes[i][j].right = true
 			}
@@ -148,13 +169,13 @@ func addConnections(mazeNodes [][]MazeNode) [][]MazeNode {
 	return mazeNodes
 }
 
-func createMaze(N, M int) [][]MazeNode {
-	mazeNodes, root := getInitialMaze(N, M)
+func createMaze(rng *rand.Rand, N, M int) [][]MazeNode {
+	mazeNodes, root := getInitialMaze(rng, N, M)
 
 	dirIndex := -1
 	count := 0
 	for count < N*M {
-		dirIndex = getRandomDirection(dirIndex)
+		dirIndex = getRandomDirection(rng, dirIndex)
 
 		switch dirIndex {
 		case 0:
@@ -206,7 +227,7 @@ func createMaze(N, M int) [][]MazeNode {
 		}
 	}
 
-	mazeNodes = addConnections(mazeNodes)
+	mazeNodes = addConnections(rng, mazeNodes)
 
 	// fill in missing connections on all nodes for consistency
 	for i := 1; i < N+1; i++ {
@@ -267,4 +288,4 @@ func buildMaze(mazeNodes [][]MazeNode, walls []models.Wall) []models.Wall {
 	}
 
 	return walls
-}
\ No newline at end of file
+}
@@ -0,0 +1,170 @@
+package sim
+
+import (
+	"myebiten/internal/models"
+	"myebiten/internal/models/character"
+)
+
+// Step advances the world by one tick. inputs are indexed by character ID,
+// missing entries leave the previous input of the character untouched.
+// The returned events are only valid until the next call to Step.
+func (world *World) Step(inputs []models.Input) []Event {
+	world.events = world.events[:0]
+
+	world.updateState()
+	world.updateCharacters(inputs)
+	world.updateBullets()
+
+	world.Tick++
+	return world.events
+}
+
+func (world *World) updateState() {
+	switch world.state {
+	case STATE_MAZE_CREATING:
+		world.startNewRound()
+	case STATE_GAME_RUNNING:
+		world.updateRunningState()
+	case STATE_GAME_ENDING:
+		world.updateEndingState()
+	}
+}
+
+func (world *World) startNewRound() {
+	world.Reset()
+	world.itemSpawnTicks = models.Ticks(ITEM_SPAWN_INTERVAL, world.TickRate)
+
+	world.SetupLevel()
+
+	world.leftAlive = 0
+	for _, char := range world.Characters {
+		if char.IsActive() {
+			world.leftAlive++
+		}
+	}
+	world.state = STATE_GAME_RUNNING
+	world.emit(EVENT_ROUND_STARTED, -1, nil)
+}
+
+func (world *World) updateRunningState() {
+	world.itemSpawnTicks--
+	if world.itemSpawnTicks <= 0 {
+		world.itemSpawnTicks = models.Ticks(ITEM_SPAWN_INTERVAL, world.TickRate)
+		if newItem := world.SpawnItem(); newItem != nil {
+			world.emit(EVENT_ITEM_SPAWNED, -1, newItem)
+		}
+		return
+	}
+
+	if world.leftAlive <= 1 {
+		world.endingTicks = models.Ticks(STATE_GAME_ENDING_TIMER_SECONDS, world.TickRate)
+		world.state = STATE_GAME_ENDING
+	}
+}
+
+func (world *World) updateEndingState() {
+	world.endingTicks--
+	if world.endingTicks > 0 {
+		return
+	}
+
+	winnerID := -1
+	for _, char := range world.Characters {
+		if char.IsActive() {
+			winnerID = char.ID
+			world.updateScores(winnerID)
+			break
+		}
+	}
+
+	world.state = STATE_MAZE_CREATING
+	world.emit(EVENT_ROUND_ENDED, winnerID, nil)
+}
+
+func (world *World) updateScores(id int) {
+	if id < 0 || id >= len(world.CharactersScores) {
+		return
+	}
+
+	world.CharactersScores[id]++
+}
+
+func (world *World) updateCharacters(inputs []models.Input) {
+	for i, char := range world.Characters {
+		if !char.IsActive() {
+			continue
+		}
+
+		if i < len(inputs) {
+			char.Input = inputs[i]
+		}
+
+		char.ProcessInput()
+		char.Move()
+		world.DetectCharacterToWallCollision(char)
+		world.collectItems(char, i)
+	}
+}
+
+func (world *World) updateBullets() {
+	for _, bullet := range world.Bullets {
+		if !bullet.IsActive() {
+			continue
+		}
+
+		bullet.TTL--
+		if bullet.TTL <= 0 {
+			bullet.SetActive(false)
+			continue
+		}
+
+		bullet.Move()
+		world.DetectBulletToWallCollision(bullet)
+		world.detectBulletHitsCharacters(bullet)
+	}
+}
+
+func (world *World) detectBulletHitsCharacters(bullet *models.Bullet) {
+	for _, char := range world.Characters {
+		if !char.IsActive() {
+			continue
+		}
+
+		if char.DetectBulletToCharacterCollision(bullet) {
+			bullet.SetActive(false)
+			char.SetActive(false)
+			world.leftAlive--
+			world.emit(EVENT_CHARACTER_KILLED, char.ID, nil)
+		}
+	}
+}
+
+func (world *World) collectItems(char *character.Character, charIndex int) {
+	for _, item := range world.Items {
+		if !item.DetectCharacterCollision(char) {
+			continue
+		}
+
+		item.SetActive(false)
+		world.applyItemEffect(item, char, charIndex)
+		world.emit(EVENT_ITEM_PICKED, char.ID, item)
+	}
+}
+
+// PredictCharacter moves one character by a tick of input ignoring everything else in the world.
+// Clients use it to move their own tank before the server confirms the move.
+func (world *World) PredictCharacter(id int, input models.Input) {
+	if id < 0 || id >= len(world.Characters) || len(world.Maze) == 0 {
+		return
+	}
+
+	char := world.Characters[id]
+	if !char.IsActive() {
+		return
+	}
+
+	char.Input = input
+	char.ProcessMovement()
+	char.Move()
+	world.DetectCharacterToWallCollision(char)
+}
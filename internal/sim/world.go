@@ -0,0 +1,188 @@
+package sim
+
+import (
+	"math"
+	"math/rand"
+
+	"myebiten/internal/models"
+	"myebiten/internal/models/character"
+	"myebiten/internal/models/item"
+	"myebiten/internal/weapons"
+)
+
+const (
+	STATE_GAME_ENDING_TIMER_SECONDS = 1
+	ITEM_SPAWN_INTERVAL             = 4
+)
+
+const (
+	STATE_MAZE_CREATING = iota
+	STATE_GAME_RUNNING
+	STATE_GAME_ENDING
+)
+
+// World is the whole state of a match. It knows nothing about drawing,
+// keyboards or sockets and only changes when Step is called.
+type World struct {
+	PlayersCount int
+	Tick         uint64
+	// TickRate is how many times per second Step is called
+	TickRate int
+
+	// Seed drives every random decision of the current round.
+	// The seed of the next round is the first number drawn from it.
+	Seed     int64
+	nextSeed int64
+	rng      *rand.Rand
+
+	H, W             int
+	Maze             [][]MazeNode
+	Walls            []models.Wall
+	Bullets          []*models.Bullet
+	Items            []*item.Item
+	Characters       []*character.Character
+	CharactersScores []uint
+	// Seated tells which characters take part in rounds, empty slots sit out until somebody takes them
+	Seated []bool
+
+	state          int
+	leftAlive      int
+	itemSpawnTicks int
+	endingTicks    int
+
+	events       []Event
+	wallsToCheck []*models.Wall
+}
+
+// NewWorld creates a world whose first round is generated from seed,
+// so two worlds with the same seed, tick rate and inputs play exactly the same match.
+func NewWorld(playersCount int, seed int64, tickRate int) *World {
+	bullets := make([]*models.Bullet, weapons.DEFAULT_GUN_BULLETS_COUNT*playersCount+weapons.MINIGUN_BULLETS_COUNT*playersCount)
+	for i := range bullets {
+		bullets[i] = models.CreateBullet(weapons.DEFAULT_GUN_BULLET_RADIUS)
+	}
+
+	world := &World{
+		PlayersCount:     playersCount,
+		TickRate:         tickRate,
+		Bullets:          bullets,
+		CharactersScores: make([]uint, playersCount),
+		Seated:           make([]bool, playersCount),
+		nextSeed:         seed,
+		rng:              rand.New(rand.NewSource(seed)),
+		state:            STATE_MAZE_CREATING,
+		wallsToCheck:     make([]*models.Wall, 12),
+	}
+
+	for id := 0; id < playersCount; id++ {
+		world.createCharacter(id)
+		world.Seated[id] = true
+	}
+
+	return world
+}
+
+func (world *World) createCharacter(id int) {
+	clip := models.CreatePool(world.Bullets[id*weapons.DEFAULT_GUN_BULLETS_COUNT : (id+1)*weapons.DEFAULT_GUN_BULLETS_COUNT])
+	defaultWeapon := weapons.NewDefaultWeapon(clip, world.TickRate)
+
+	char := character.CreateCharacter(id, defaultWeapon, world.TickRate)
+	char.SetActive(true)
+	world.Characters = append(world.Characters, &char)
+}
+
+func (world *World) State() int {
+	return world.state
+}
+
+func (world *World) SetupLevel() (int, int, []models.Wall) {
+	h, w, walls := world.BuildLevel(world.nextSeed)
+	world.SetCharacters(h, w)
+
+	return h, w, walls
+}
+
+// BuildLevel seeds the round and builds its maze. Clients call it with the seed
+// received from the server to get the same walls without receiving them.
+func (world *World) BuildLevel(seed int64) (int, int, []models.Wall) {
+	world.Seed = seed
+	world.rng = rand.New(rand.NewSource(seed))
+	world.nextSeed = world.rng.Int63()
+
+	h := world.rng.Intn(MAX_BOARD_HEIGHT-MIN_BOARD_HEIGHT) + MIN_BOARD_HEIGHT
+	w := world.rng.Intn(MAX_BOARD_WIDTH-MIN_BOARD_WIDTH) + MIN_BOARD_WIDTH
+
+	walls := world.CreateMaze(h, w)
+
+	return h, w, walls
+}
+
+func (world *World) SetCharacters(h, w int) {
+	spawnPlaces := []models.Vector2D{}
+	for range world.Characters {
+		i := world.rng.Intn(h) + 1
+		j := world.rng.Intn(w) + 1
+		spawnPlace := getSceneCoordinates(i, j)
+		spawnPlaces = append(spawnPlaces, spawnPlace)
+	}
+
+	i := 0
+	for _, char := range world.Characters {
+		if !char.IsActive() {
+			continue
+		}
+
+		char.Position.X = spawnPlaces[i].X
+		char.Position.Y = spawnPlaces[i].Y
+
+		char.Rotation = math.Pi / 2
+
+		char.Speed.X = 0
+		char.Speed.Y = 0
+
+		i++
+	}
+}
+
+func (world *World) CreateMaze(h, w int) []models.Wall {
+	world.H = h
+	world.W = w
+	world.Walls = make([]models.Wall, 0)
+
+	world.Maze = createMaze(world.rng, h, w)
+	world.Walls = buildMaze(world.Maze, world.Walls)
+
+	return world.Walls
+}
+
+func (world *World) Reset() {
+	for _, bullet := range world.Bullets {
+		bullet.SetActive(false)
+	}
+
+	for _, item := range world.Items {
+		item.SetActive(false)
+	}
+	world.Items = nil
+
+	for i, char := range world.Characters {
+		char.SetActive(world.Seated[i])
+		char.Input.Reset()
+		char.SwitchToDefaultWeapon()
+	}
+}
+
+func (world *World) SpawnItem() *item.Item {
+	if len(world.Maze) < 3 || len(world.Maze[0]) < 3 {
+		return nil
+	}
+
+	i := world.rng.Intn(len(world.Maze)-2) + 1
+	j := world.rng.Intn(len(world.Maze[0])-2) + 1
+
+	position := getSceneCoordinates(i, j)
+	newItem := item.CreateItem(world.randomItemType(), position)
+	world.Items = append(world.Items, newItem)
+
+	return newItem
+}
@@ -0,0 +1,71 @@
+package sim
+
+import (
+	"testing"
+
+	"myebiten/internal/models"
+)
+
+const (
+	TEST_PLAYERS   = 3
+	TEST_TICK_RATE = 60
+	// a match that takes longer than this means the scripted tanks stopped hitting each other
+	TEST_MAX_TICKS = 10 * 60 * TEST_TICK_RATE
+)
+
+// scriptedInput drives every tank around the maze in its own pattern, shooting now and then.
+func scriptedInput(tick uint64, player int) models.Input {
+	phase := (tick/20 + uint64(player)*5) % 8
+	return models.Input{
+		MoveForward:  phase != 3 && phase != 7,
+		MoveBackward: phase == 7,
+		RotateLeft:   phase == 1 || phase == 4,
+		RotateRight:  phase == 2 || phase == 6,
+		Shoot:        (tick+uint64(player)*7)%15 == 0,
+	}
+}
+
+// The worlds play until a round has a winner, rounds before it may end with every tank dead.
+func TestWorldsWithSameSeedPlaySameMatch(t *testing.T) {
+	worlds := []*World{NewWorld(TEST_PLAYERS, 42, TEST_TICK_RATE), NewWorld(TEST_PLAYERS, 42, TEST_TICK_RATE)}
+	inputs := make([]models.Input, TEST_PLAYERS)
+
+	for range TEST_MAX_TICKS {
+		for player := range inputs {
+			inputs[player] = scriptedInput(worlds[0].Tick, player)
+		}
+
+		winner := -1
+		for _, world := range worlds {
+			for _, event := range world.Step(inputs) {
+				if event.Type == EVENT_ROUND_ENDED && event.CharacterID >= 0 {
+					winner = event.CharacterID
+				}
+			}
+		}
+
+		tick := worlds[0].Tick
+		if hash, other := worlds[0].StateHash(), worlds[1].StateHash(); hash != other {
+			t.Fatalf("tick %d: state hashes %016x and %016x", tick, hash, other)
+		}
+		if winner >= 0 {
+			if score := worlds[0].CharactersScores[winner]; score != 1 {
+				t.Fatalf("player %d won a round at tick %d and has score %d", winner, tick, score)
+			}
+			return
+		}
+	}
+
+	t.Fatalf("nobody won a round in %d ticks", TEST_MAX_TICKS)
+}
+
+func TestWorldsWithOtherSeedsDiffer(t *testing.T) {
+	world, other := NewWorld(TEST_PLAYERS, 1, TEST_TICK_RATE), NewWorld(TEST_PLAYERS, 2, TEST_TICK_RATE)
+	inputs := make([]models.Input, TEST_PLAYERS)
+	world.Step(inputs)
+	other.Step(inputs)
+
+	if world.StateHash() == other.StateHash() {
+		t.Fatal("rounds from seeds 1 and 2 start the same")
+	}
+}
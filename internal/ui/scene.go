@@ -1,8 +1,10 @@
-package models
+package ui
 
 import (
 	"image/color"
 
+	"myebiten/internal/models"
+
 	"github.com/hajimehoshi/ebiten/v2"
 )
 
@@ -14,7 +16,7 @@ type Drawable interface {
 }
 
 type DrawingSettings struct {
-	Offset Vector2D
+	Offset models.Vector2D
 	Scale  float64
 }
 
@@ -37,7 +39,7 @@ func (d *DrawingArea) NewArea(height, width float64, settings DrawingSettings) (
 		BoardImage: d.BoardImage,
 
 		DrawingSettings: DrawingSettings{
-			Offset: Vector2D{
+			Offset: models.Vector2D{
 				X: d.Offset.X + settings.Offset.X,
 				Y: d.Offset.Y + settings.Offset.Y,
 			},
@@ -0,0 +1,90 @@
+package ui
+
+import (
+	"image/color"
+
+	"myebiten/internal/models"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+type RectangleSprite struct {
+	W, H float64
+}
+
+func (rectangleSprite RectangleSprite) Draw(centerX, centerY, rotation float64, drawingArea *DrawingArea) {
+	width, height := rectangleSprite.W, rectangleSprite.H
+
+	if rotation == 0.0 {
+		width, height = height, width
+	}
+	drawFilledRect(drawingArea, centerX, centerY, width, height, color.Black)
+}
+
+type CircleSprite struct {
+	R     float64
+	Color color.RGBA
+}
+
+func (circleSprite CircleSprite) Draw(centerX, centerY float64, drawingArea *DrawingArea) {
+	sc := drawingArea.Scale
+	offX := drawingArea.Offset.X
+	offY := drawingArea.Offset.Y
+
+	x := float32(centerX)*float32(sc) + float32(offX)
+	y := float32(centerY)*float32(sc) + float32(offY)
+	r := float32(circleSprite.R) * float32(sc)
+
+	image := drawingArea.BoardImage
+
+	fillColor := circleSprite.Color
+	if fillColor.A == 0 {
+		fillColor = color.RGBA{0x00, 0x00, 0x00, 0xff}
+	}
+
+	vector.DrawFilledCircle(image, x, y, r, fillColor, false)
+}
+
+type ImageSprite struct {
+	*ebiten.Image
+}
+
+func (imageSprite ImageSprite) Draw(centerX, centerY, rotation float64, drawingArea *DrawingArea) {
+	if drawingArea == nil || imageSprite.Image == nil {
+		return
+	}
+	op := &ebiten.DrawImageOptions{}
+
+	w := imageSprite.Image.Bounds().Max.X - imageSprite.Image.Bounds().Min.X
+	h := imageSprite.Image.Bounds().Max.Y - imageSprite.Image.Bounds().Min.Y
+
+	sc := drawingArea.Scale
+	offX := drawingArea.Offset.X
+	offY := drawingArea.Offset.Y
+
+	op.GeoM.Reset()
+	op.GeoM.Translate(-float64(w)/2, -float64(h)/2)
+	op.GeoM.Rotate(rotation)
+	op.GeoM.Scale(sc, sc)
+	op.GeoM.Translate(centerX*sc+offX, centerY*sc+offY)
+
+	image := drawingArea.BoardImage
+
+	image.DrawImage(imageSprite.Image, op)
+}
+
+func drawFilledRect(drawingArea *DrawingArea, centerX, centerY, width, height float64, fillColor color.Color) {
+	topLeftCorner := models.Vector2D{X: centerX - width/2, Y: centerY - height/2}
+
+	sc := drawingArea.Scale
+	offX := drawingArea.Offset.X
+	offY := drawingArea.Offset.Y
+
+	x := float32(topLeftCorner.X)*float32(sc) + float32(offX)
+	y := float32(topLeftCorner.Y)*float32(sc) + float32(offY)
+	w := float32(width) * float32(sc)
+	h := float32(height) * float32(sc)
+
+	vector.DrawFilledRect(drawingArea.BoardImage, x, y, w, h, fillColor, false)
+}
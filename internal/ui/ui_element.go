@@ -1,4 +1,4 @@
-package models
+package ui
 
 import (
 	"image/color"
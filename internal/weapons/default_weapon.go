@@ -2,40 +2,47 @@ package weapons
 
 import (
 	"math"
-	"sync"
-	"time"
 
 	"myebiten/internal/models"
 )
 
 const (
-	DEFAULT_GUN_BULLET_SPEED  = 1.15
+	// pixels per second
+	DEFAULT_GUN_BULLET_SPEED  = 345.0
 	DEFAULT_GUN_BULLET_RADIUS = 4
 	DEFAULT_GUN_BULLETS_COUNT = 3
-	DEFAULT_GUN_BULLET_TTL    = 7 * time.Second
+	// seconds
+	DEFAULT_GUN_BULLET_TTL = 7.0
+	DEFAULT_GUN_COOLDOWN   = 0.5
 )
 
+// DefaultWeapon shoots one bullet per Shoot call at most once per Cooldown seconds.
+// TickRate is the rate of the world the weapon is updated in.
 type DefaultWeapon struct {
-	Clip         models.Pool[*models.Bullet]
-	Cooldown     time.Duration
-	BulletRadius float64
-	BulletSpeed  float64
-	mu           sync.Mutex
-	lastShotAt   time.Time
+	Clip          models.Pool[*models.Bullet]
+	TickRate      int
+	Cooldown      float64
+	BulletRadius  float64
+	BulletSpeed   float64
+	cooldownTicks int
 }
 
 func (dw *DefaultWeapon) Shoot(origin models.Vector2D, rotation float64) {
-	dw.mu.Lock()
-	if dw.Cooldown > 0 && !dw.lastShotAt.IsZero() && time.Since(dw.lastShotAt) < dw.Cooldown {
-		dw.mu.Unlock()
+	if dw.cooldownTicks > 0 {
 		return
 	}
-	dw.lastShotAt = time.Now()
-	dw.mu.Unlock()
+	dw.cooldownTicks = models.Ticks(dw.Cooldown, dw.TickRate)
 
 	dw.spawnBullet(origin, rotation)
 }
 
+// Update advances the weapon timers by one tick.
+func (dw *DefaultWeapon) Update() {
+	if dw.cooldownTicks > 0 {
+		dw.cooldownTicks--
+	}
+}
+
 func (dw *DefaultWeapon) spawnBullet(origin models.Vector2D, rotation float64) {
 	bullet := dw.Clip.Get()
 	if bullet == nil {
@@ -48,17 +55,13 @@ func (dw *DefaultWeapon) spawnBullet(origin models.Vector2D, rotation float64) {
 	bullet.Rotation = rotation
 
 	sin, cos := math.Sincos(rotation)
-	bullet.Speed.X = cos * dw.bulletSpeed()
-	bullet.Speed.Y = sin * dw.bulletSpeed()
+	speed := models.PerTick(dw.bulletSpeed(), dw.TickRate)
+	bullet.Speed.X = cos * speed
+	bullet.Speed.Y = sin * speed
 	bullet.R = dw.bulletRadius()
-	bullet.Sprite.R = dw.bulletRadius()
+	bullet.TTL = models.Ticks(DEFAULT_GUN_BULLET_TTL, dw.TickRate)
 
 	bullet.SetActive(true)
-
-	go func() {
-		time.Sleep(DEFAULT_GUN_BULLET_TTL)
-		bullet.SetActive(false)
-	}()
 }
 
 func (dw *DefaultWeapon) bulletSpeed() float64 {
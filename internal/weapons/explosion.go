@@ -1,8 +1,6 @@
 package weapons
 
 import (
-	"time"
-
 	"myebiten/internal/models"
 )
 
@@ -10,13 +8,14 @@ type ExplosionWeapon struct {
 	DefaultWeapon
 }
 
-func NewExplosionWeapon(clip models.Pool[*models.Bullet]) *ExplosionWeapon {
+func NewExplosionWeapon(clip models.Pool[*models.Bullet], tickRate int) *ExplosionWeapon {
 	return &ExplosionWeapon{
 		DefaultWeapon: DefaultWeapon{
 			Clip:         clip,
-			Cooldown:     250 * time.Millisecond,
+			TickRate:     tickRate,
+			Cooldown:     0.25,
 			BulletRadius: 18,
-			BulletSpeed:  0.7,
+			BulletSpeed:  210,
 		},
 	}
 }
@@ -1,14 +1,13 @@
 package weapons
 
 import (
-	"time"
-
 	"myebiten/internal/models"
 )
 
-func NewDefaultWeapon(clip models.Pool[*models.Bullet]) *DefaultWeapon {
+func NewDefaultWeapon(clip models.Pool[*models.Bullet], tickRate int) *DefaultWeapon {
 	return &DefaultWeapon{
 		Clip:     clip,
-		Cooldown: time.Millisecond * 500,
+		TickRate: tickRate,
+		Cooldown: DEFAULT_GUN_COOLDOWN,
 	}
 }
@@ -3,86 +3,95 @@ package weapons
 import (
 	"math"
 	"math/rand"
-	"sync"
-	"time"
 
 	"myebiten/internal/models"
 )
 
+// MinigunWeapon starts a burst after a warmup and keeps firing
+// for as long as Shoot is called, up to MINIGUN_BULLETS_COUNT bullets.
 type MinigunWeapon struct {
 	DefaultWeapon
-	mu            sync.Mutex
-	isShooting    bool
-	shootHeldTill time.Time
-	origin        models.Vector2D
-	rotation      float64
+	rng          *rand.Rand
+	isShooting   bool
+	warmupTicks  int
+	heldTicks    int
+	bulletsFired int
+	origin       models.Vector2D
+	rotation     float64
 }
 
 const (
-	MINIGUN_WARMUP            = 500 * time.Millisecond
+	// seconds
+	MINIGUN_WARMUP            = 0.5
 	MINIGUN_BULLETS_COUNT     = 30
 	MINIGUN_DISPERSION_DEGREE = 10.0
-	MINIGUN_COOLDOWN          = 100 * time.Millisecond
+	// seconds
+	MINIGUN_COOLDOWN = 0.1
 )
 
-func NewMinigunWeapon(clip models.Pool[*models.Bullet]) *MinigunWeapon {
+// NewMinigunWeapon creates a minigun whose bullet dispersion is drawn from rng.
+func NewMinigunWeapon(clip models.Pool[*models.Bullet], rng *rand.Rand, tickRate int) *MinigunWeapon {
 	return &MinigunWeapon{
 		DefaultWeapon: DefaultWeapon{
 			Clip:         clip,
+			TickRate:     tickRate,
 			Cooldown:     MINIGUN_COOLDOWN,
 			BulletRadius: 2,
 			BulletSpeed:  DEFAULT_GUN_BULLET_SPEED * 1.1,
 		},
+		rng: rng,
 	}
 }
 
 func (mw *MinigunWeapon) Shoot(origin models.Vector2D, rotation float64) {
-	mw.mu.Lock()
-	mw.shootHeldTill = time.Now().Add(MINIGUN_COOLDOWN)
+	// the trigger counts as held until a full cooldown passes without Shoot
+	mw.heldTicks = models.Ticks(MINIGUN_COOLDOWN, mw.TickRate)
 	mw.origin = origin
 	mw.rotation = rotation
 	if mw.isShooting {
-		mw.mu.Unlock()
 		return
 	}
-	mw.isShooting = true
-	mw.mu.Unlock()
 
-	go mw.fireBurst(origin, rotation)
+	mw.isShooting = true
+	mw.warmupTicks = models.Ticks(MINIGUN_WARMUP, mw.TickRate)
+	mw.bulletsFired = 0
+	mw.cooldownTicks = 0
 }
 
 func (mw *MinigunWeapon) IsShooting() bool {
-	mw.mu.Lock()
-	defer mw.mu.Unlock()
-
 	return mw.isShooting
 }
 
-func (mw *MinigunWeapon) fireBurst(origin models.Vector2D, rotation float64) {
-	timer := time.NewTimer(MINIGUN_WARMUP)
-	defer timer.Stop()
+func (mw *MinigunWeapon) Update() {
+	if !mw.isShooting {
+		return
+	}
 
-	<-timer.C
+	if mw.heldTicks > 0 {
+		mw.heldTicks--
+	}
 
-	for i := 0; i < MINIGUN_BULLETS_COUNT; i++ {
-		mw.mu.Lock()
-		held := time.Now().Before(mw.shootHeldTill)
-		origin := mw.origin
-		rotation := mw.rotation
-		if !held {
-			mw.isShooting = false
-			mw.mu.Unlock()
-			return
-		}
-		mw.mu.Unlock()
+	if mw.warmupTicks > 0 {
+		mw.warmupTicks--
+		return
+	}
 
-		dispersion := (rand.Float64()*2 - 1) * MINIGUN_DISPERSION_DEGREE * math.Pi / 180
-		mw.spawnBullet(origin, rotation+dispersion)
+	if mw.heldTicks <= 0 {
+		mw.isShooting = false
+		return
+	}
 
-		time.Sleep(mw.Cooldown)
+	mw.DefaultWeapon.Update()
+	if mw.cooldownTicks > 0 {
+		return
 	}
 
-	mw.mu.Lock()
-	mw.isShooting = false
-	mw.mu.Unlock()
+	dispersion := (mw.rng.Float64()*2 - 1) * MINIGUN_DISPERSION_DEGREE * math.Pi / 180
+	mw.spawnBullet(mw.origin, mw.rotation+dispersion)
+	mw.cooldownTicks = models.Ticks(mw.Cooldown, mw.TickRate)
+
+	mw.bulletsFired++
+	if mw.bulletsFired >= MINIGUN_BULLETS_COUNT {
+		mw.isShooting = false
+	}
 }
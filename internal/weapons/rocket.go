@@ -1,8 +1,6 @@
 package weapons
 
 import (
-	"time"
-
 	"myebiten/internal/models"
 )
 
@@ -10,13 +8,14 @@ type RocketWeapon struct {
 	DefaultWeapon
 }
 
-func NewRocketWeapon(clip models.Pool[*models.Bullet]) *RocketWeapon {
+func NewRocketWeapon(clip models.Pool[*models.Bullet], tickRate int) *RocketWeapon {
 	return &RocketWeapon{
 		DefaultWeapon: DefaultWeapon{
 			Clip:         clip,
-			Cooldown:     900 * time.Millisecond,
+			TickRate:     tickRate,
+			Cooldown:     0.9,
 			BulletRadius: 12,
-			BulletSpeed:  1.35,
+			BulletSpeed:  405,
 		},
 	}
 }
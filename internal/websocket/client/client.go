@@ -1,136 +1,379 @@
 package client
 
 import (
-	"encoding/json"
-	"errors"
 	"fmt"
+	"io"
 	"log"
-	"net/http"
-	"runtime"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
+
+	"myebiten/internal/models"
+	"myebiten/internal/netcond"
+	"myebiten/internal/netstats"
+	"myebiten/internal/protocol"
 
 	"github.com/gorilla/websocket"
 )
 
+// MessageStore keeps received messages in arrival order until the game reads them.
 type MessageStore struct {
 	sync.Mutex
-	message []byte
+	messages [][]byte
 }
 
+// SPECTATOR_ID is the player id of a client that only watches the match.
+const SPECTATOR_ID = -1
+
+const (
+	RECONNECT_MIN_DELAY = 250 * time.Millisecond
+	RECONNECT_MAX_DELAY = 5 * time.Second
+)
+
+// Client keeps one websocket to the server and dials again with backoff when it breaks.
 type Client struct {
-	charInputConn    *websocket.Conn
-	thingsUpdateConn *websocket.Conn
-	MapUpdateConn    *websocket.Conn
-	msgStore         *MessageStore
-	mapMsgStore      *MessageStore
-	playerID         int
+	connMutex sync.Mutex
+	conn      netcond.Transport
+	connected bool
+	// closed clients no longer reconnect
+	closed       bool
+	hostAddress  string
+	msgStore     *MessageStore
+	playerID     int
+	playersCount int
+	// tickRate is how many inputs per second the server simulates
+	tickRate int
+	// the session token of our slot, reconnects present it to get the slot back
+	token    string
+	password string
+	// conditions simulate a bad network on every connection the client opens
+	conditions netcond.Config
+	counters   *netstats.Counters
 }
 
-func New(hostAddress string, playerID int) *Client {
-	address := fmt.Sprintf("ws://%s/ws1?player_id=%d", hostAddress, playerID)
-	charInputConn, _, err := websocket.DefaultDialer.Dial(address, nil)
-	if err != nil {
-		log.Fatal(err)
-	}
+// New connects to the server and waits for its welcome.
+// token is empty when claiming the slot for the first time, password is what the server was started with.
+func New(hostAddress string, playerID int, token, password string, conditions netcond.Config) (*Client, error) {
+	return connect(hostAddress, playerID, token, password, conditions)
+}
 
-	address = fmt.Sprintf("ws://%s/ws2?player_id=%d", hostAddress, playerID)
-	thingsUpdateConn, _, err := websocket.DefaultDialer.Dial(address, nil)
+// NewSpectator connects to the server to watch the match, it never sends anything.
+func NewSpectator(hostAddress, password string, conditions netcond.Config) (*Client, error) {
+	return connect(hostAddress, SPECTATOR_ID, "", password, conditions)
+}
+
+func connect(hostAddress string, playerID int, token, password string, conditions netcond.Config) (*Client, error) {
+	if conditions.Enabled() {
+		log.Printf("simulating a bad network %+v\n", conditions)
+	}
+	conn, err := dial(hostAddress, playerID, token, password, conditions)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	address = fmt.Sprintf("ws://%s/ws3?player_id=%d", hostAddress, playerID)
-	mapUpdateConn, _, err := websocket.DefaultDialer.Dial(address, nil)
+	joined, err := readWelcome(conn)
 	if err != nil {
-		log.Fatal(err)
+		conn.Close()
+		return nil, err
+	}
+	if playerID == SPECTATOR_ID {
+		log.Printf("joined as spectator, server ticks %d times per second\n", joined.tickRate)
+	} else {
+		log.Printf("joined as player %d, session token %s, server ticks %d times per second\n", playerID, joined.token, joined.tickRate)
 	}
 
 	c := &Client{
-		charInputConn:    charInputConn,
-		thingsUpdateConn: thingsUpdateConn,
-		MapUpdateConn:    mapUpdateConn,
-		msgStore:         &MessageStore{},
-		mapMsgStore:      &MessageStore{},
-		playerID:         playerID,
+		conn:         conn,
+		connected:    true,
+		hostAddress:  hostAddress,
+		msgStore:     &MessageStore{},
+		playerID:     playerID,
+		playersCount: joined.playersCount,
+		tickRate:     joined.tickRate,
+		token:        joined.token,
+		password:     password,
+		conditions:   conditions,
+		counters:     &netstats.Counters{},
 	}
 	go c.ReceiveUpdates()
-	go c.ReceiveMapUpdates()
+	go c.ping()
 
-	return c
+	return c, nil
 }
 
-func GetPlayersCount(hostAddress string) (int, error) {
-	address := fmt.Sprintf("http://%s/players_count", hostAddress)
-	response, err := http.Get(address)
-	if err != nil {
-		return 0, err
+// dial opens a websocket announcing our protocol version and credentials, spectators connect to /spectate.
+// When the server refuses the connection its explanation is returned as the error.
+func dial(hostAddress string, playerID int, token, password string, conditions netcond.Config) (netcond.Transport, error) {
+	path := "/ws"
+	query := url.Values{}
+	query.Set(protocol.VERSION_QUERY_PARAM, strconv.Itoa(protocol.VERSION))
+	if playerID == SPECTATOR_ID {
+		path = "/spectate"
+	} else {
+		query.Set(protocol.PLAYER_ID_QUERY_PARAM, strconv.Itoa(playerID))
+	}
+	if token != "" {
+		query.Set(protocol.TOKEN_QUERY_PARAM, token)
+	}
+	if password != "" {
+		query.Set(protocol.PASSWORD_QUERY_PARAM, password)
+	}
+
+	address := url.URL{Scheme: "ws", Host: hostAddress, Path: path, RawQuery: query.Encode()}
+	conn, response, err := websocket.DefaultDialer.Dial(address.String(), nil)
+	if err == nil {
+		return netcond.Wrap(conn, conditions, protocol.Droppable), nil
+	}
+
+	if response == nil {
+		return nil, err
 	}
 	defer response.Body.Close()
-	if response.StatusCode != http.StatusOK {
-		return 0, errors.New(response.Status)
+
+	body, _ := io.ReadAll(response.Body)
+	return nil, fmt.Errorf("server refused connection to %s: %s: %s", path, response.Status, strings.TrimSpace(string(body)))
+}
+
+// welcome is what the server tells about the match when we connect.
+type welcome struct {
+	playersCount int
+	tickRate     int
+	token        string
+}
+
+// readWelcome waits for the first messages of the connection: the welcome with the players count
+// and the session token, then the tick rate.
+func readWelcome(conn netcond.Transport) (welcome, error) {
+	var joined welcome
+	greeting, err := readControl(conn, protocol.CONTROL_WELCOME)
+	if err != nil {
+		return joined, err
+	}
+	joined.playersCount = int(greeting.Value)
+	joined.token = greeting.Text
+
+	tickRate, err := readControl(conn, protocol.CONTROL_TICK_RATE)
+	if err != nil {
+		return joined, err
+	}
+	if tickRate.Value < models.MIN_TICK_RATE || tickRate.Value > models.MAX_TICK_RATE {
+		return joined, fmt.Errorf("server tick rate %d is outside %d to %d", tickRate.Value, models.MIN_TICK_RATE, models.MAX_TICK_RATE)
+	}
+	joined.tickRate = int(tickRate.Value)
+
+	return joined, nil
+}
+
+func readControl(conn netcond.Transport, kind byte) (protocol.ControlMessage, error) {
+	var control protocol.ControlMessage
+	_, message, err := conn.ReadMessage()
+	if err != nil {
+		return control, err
 	}
 
-	var playersCount int
-	if err := json.NewDecoder(response.Body).Decode(&playersCount); err != nil {
-		return 0, err
+	if err := protocol.DecodeControl(message, &control); err != nil {
+		return control, err
+	}
+	if control.Kind != kind {
+		return control, fmt.Errorf("expected control message %d from server, got %d", kind, control.Kind)
 	}
 
-	return playersCount, nil
+	return control, nil
 }
 
 func (c *Client) ReceiveUpdates() {
+	conn := c.conn
 	for {
-		_, message, err := c.thingsUpdateConn.ReadMessage()
+		_, message, err := conn.ReadMessage()
 		if err != nil {
-			log.Println(runtime.Caller(1))
+			if c.isClosed() {
+				return
+			}
 			log.Println(err)
+			conn = c.reconnect(conn)
+			continue
+		}
+		c.counters.Received(len(message))
+
+		if kind, err := protocol.MessageType(message); err == nil && kind == protocol.MESSAGE_CONTROL {
+			c.receiveControl(message)
+			continue
 		}
 
 		c.msgStore.Lock()
-		c.msgStore.message = message
+		c.msgStore.messages = appendMessage(c.msgStore.messages, message)
 		c.msgStore.Unlock()
 	}
 }
 
-func (c *Client) ReceiveMapUpdates() {
+// receiveControl answers pings of the server and takes the round trip from its pongs.
+func (c *Client) receiveControl(message []byte) {
+	var control protocol.ControlMessage
+	if err := protocol.DecodeControl(message, &control); err != nil {
+		log.Println(err)
+		return
+	}
+
+	switch control.Kind {
+	case protocol.CONTROL_PING:
+		c.WriteMessage(protocol.AppendControl(nil, &protocol.ControlMessage{Kind: protocol.CONTROL_PONG, Value: control.Value}))
+	case protocol.CONTROL_PONG:
+		c.counters.AddPong(control.Value)
+	default:
+		log.Printf("server sent unexpected control message %d\n", control.Kind)
+	}
+}
+
+// ping pings the server each netstats.PING_INTERVAL.
+func (c *Client) ping() {
+	ticker := time.NewTicker(netstats.PING_INTERVAL)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if c.isClosed() {
+			return
+		}
+		c.WriteMessage(protocol.AppendControl(nil, &protocol.ControlMessage{Kind: protocol.CONTROL_PING, Value: netstats.Stamp()}))
+	}
+}
+
+// reconnect replaces the broken connection, retrying with a growing delay until the server takes us back
+// or the client is closed.
+func (c *Client) reconnect(broken netcond.Transport) netcond.Transport {
+	broken.Close()
+	c.connMutex.Lock()
+	c.connected = false
+	c.connMutex.Unlock()
+
+	delay := RECONNECT_MIN_DELAY
 	for {
-		_, message, err := c.MapUpdateConn.ReadMessage()
-		if err != nil {
-			log.Println(runtime.Caller(1))
-			log.Println(err)
+		log.Printf("reconnecting in %s\n", delay)
+		time.Sleep(delay)
+
+		conn, err := dial(c.hostAddress, c.playerID, c.token, c.password, c.conditions)
+		if err == nil {
+			_, err = readWelcome(conn)
+			if err != nil {
+				conn.Close()
+			}
 		}
+		if err == nil {
+			c.connMutex.Lock()
+			c.conn = conn
+			c.connected = !c.closed
+			c.connMutex.Unlock()
+			if c.isClosed() {
+				conn.Close()
+				return conn
+			}
 
-		c.mapMsgStore.Lock()
-		c.mapMsgStore.message = message
-		c.mapMsgStore.Unlock()
+			log.Println("reconnected")
+			return conn
+		}
+
+		log.Println(err)
+		if c.isClosed() {
+			return broken
+		}
+		delay = min(delay*2, RECONNECT_MAX_DELAY)
 	}
 }
 
-func (c *Client) ReadMessage() []byte {
-	c.msgStore.Lock()
-	message := c.msgStore.message
-	c.msgStore.Unlock()
+// Close drops the connection for good and frees it on the server, the slot stays claimed by Token.
+func (c *Client) Close() {
+	c.connMutex.Lock()
+	defer c.connMutex.Unlock()
+
+	c.closed = true
+	c.connected = false
+	c.conn.Close()
+}
+
+func (c *Client) isClosed() bool {
+	c.connMutex.Lock()
+	defer c.connMutex.Unlock()
+	return c.closed
+}
+
+// Connected is false while the client is reconnecting.
+func (c *Client) Connected() bool {
+	c.connMutex.Lock()
+	defer c.connMutex.Unlock()
+	return c.connected
+}
+
+// appendMessage queues message, a snapshot replaces the snapshot queued right before it
+// since only the newest one matters, but never jumps over a maze or a control message.
+func appendMessage(messages [][]byte, message []byte) [][]byte {
+	if n := len(messages); n > 0 && isSnapshot(message) && isSnapshot(messages[n-1]) {
+		messages[n-1] = message
+		return messages
+	}
+
+	return append(messages, message)
+}
 
-	return message
+func isSnapshot(message []byte) bool {
+	kind, err := protocol.MessageType(message)
+	return err == nil && (kind == protocol.MESSAGE_SNAPSHOT || kind == protocol.MESSAGE_DELTA_SNAPSHOT)
 }
 
-func (c *Client) ReadMapMessage() []byte {
-	c.mapMsgStore.Lock()
-	message := c.mapMsgStore.message
-	c.mapMsgStore.message = nil
-	c.mapMsgStore.Unlock()
+// ReadMessages moves the received messages to dst in the order they arrived.
+func (c *Client) ReadMessages(dst [][]byte) [][]byte {
+	c.msgStore.Lock()
+	dst = append(dst, c.msgStore.messages...)
+	clear(c.msgStore.messages)
+	c.msgStore.messages = c.msgStore.messages[:0]
+	c.msgStore.Unlock()
 
-	return message
+	return dst
 }
 
+// WriteMessage sends message to the server, while reconnecting it is dropped.
+// Write errors are left to the reading side, which notices the broken connection too.
 func (c *Client) WriteMessage(message []byte) error {
-	if err := c.charInputConn.WriteMessage(websocket.TextMessage, message); err != nil {
-		return err
+	c.connMutex.Lock()
+	defer c.connMutex.Unlock()
+
+	if !c.connected {
+		return nil
+	}
+
+	if err := c.conn.WriteMessage(websocket.BinaryMessage, message); err != nil {
+		log.Println(err)
+		return nil
 	}
+	c.counters.Sent(len(message))
 
 	return nil
 }
 
+// Counters gather the stats of the connection, they outlive reconnects.
+func (c *Client) Counters() *netstats.Counters {
+	return c.counters
+}
+
+// Spectating tells whether the client only watches the match.
+func (c *Client) Spectating() bool {
+	return c.playerID == SPECTATOR_ID
+}
+
+// Token is the session token of our slot, it gets the slot back on a new connection.
+func (c *Client) Token() string {
+	return c.token
+}
+
 func (c *Client) GetPlayerID() int {
 	return c.playerID
 }
+
+func (c *Client) PlayersCount() int {
+	return c.playersCount
+}
+
+// TickRate is how many ticks per second the server simulates, the client predicts and sends inputs at it.
+func (c *Client) TickRate() int {
+	return c.tickRate
+}
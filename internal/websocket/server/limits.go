@@ -0,0 +1,63 @@
+package server
+
+import (
+	"time"
+)
+
+const (
+	// inputs are a few bytes, anything much bigger is not from our client
+	MAX_MESSAGE_SIZE = 256
+	// clients send one input per tick, the burst of a second of inputs lets them catch up after a hiccup
+	MAX_MESSAGES_PER_TICK  = 2
+	MESSAGES_BURST_SECONDS = 1
+	// a connection breaking the rules more often than this is closed
+	MAX_VIOLATIONS = 100
+
+	// players may say a few lines at once but not flood the chat
+	CHAT_MESSAGES_PER_SECOND = 1
+	CHAT_BURST               = 5
+	// chat lines waiting for the host to relay them, more are dropped
+	MAX_QUEUED_CHAT = 64
+	// desync reports waiting for the host to answer them, more are dropped
+	MAX_QUEUED_DESYNC_REPORTS = 16
+)
+
+const (
+	VIOLATION_TOO_LARGE       = "message too large"
+	VIOLATION_MALFORMED       = "malformed message"
+	VIOLATION_UNEXPECTED_TYPE = "unexpected message type"
+	VIOLATION_RATE            = "message rate exceeded"
+	VIOLATION_STALE_INPUT     = "input sequence not increasing"
+	VIOLATION_CHAT_RATE       = "chat rate exceeded"
+)
+
+// rateLimiter is a token bucket refilled at rate tokens per second up to burst.
+type rateLimiter struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate, burst float64) *rateLimiter {
+	return &rateLimiter{rate: rate, burst: burst, tokens: burst}
+}
+
+// newMessageLimiter limits all messages of a connection to a server simulating tickRate ticks per second.
+func newMessageLimiter(tickRate int) *rateLimiter {
+	return newRateLimiter(float64(MAX_MESSAGES_PER_TICK*tickRate), float64(MESSAGES_BURST_SECONDS*tickRate))
+}
+
+func (limiter *rateLimiter) allow(now time.Time) bool {
+	if !limiter.last.IsZero() {
+		limiter.tokens = min(limiter.burst, limiter.tokens+now.Sub(limiter.last).Seconds()*limiter.rate)
+	}
+	limiter.last = now
+
+	if limiter.tokens < 1 {
+		return false
+	}
+
+	limiter.tokens--
+	return true
+}
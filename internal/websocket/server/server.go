@@ -2,28 +2,54 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"runtime"
 	"strconv"
 	"sync"
+	"time"
 
 	"myebiten/internal/models"
+	"myebiten/internal/netcond"
+	"myebiten/internal/netstats"
+	"myebiten/internal/protocol"
 
 	"github.com/gorilla/websocket"
 )
 
+// MAX_QUEUED_INPUTS bounds the inputs waiting to be simulated for one player,
+// when a client gets that far ahead its oldest inputs are dropped.
+const MAX_QUEUED_INPUTS = 32
+
+// InputStore queues inputs per player so each of them is simulated for exactly one tick.
 type InputStore struct {
 	sync.Mutex
-	inputs map[int]models.Input
+	queues       map[int][]protocol.InputMessage
+	lastInputs   map[int]protocol.InputMessage
+	snapshotAcks map[int]uint64
 }
 
+// Server keeps one websocket per client, every message on it starts with its type.
+// A player that drops keeps its slot and can connect again at any time.
 type Server struct {
-	charInputConns    map[int]*websocket.Conn
-	thingsUpdateConns map[int]*websocket.Conn
-	mapUpdateConns    map[int]*websocket.Conn
-	inputStore        *InputStore
+	sync.Mutex
+	sessions *sessions
+	// tickRate is told to every client when it connects
+	tickRate int
+	// conditions simulate a bad network on every connection
+	conditions netcond.Config
+	conns      map[int]netcond.Transport
+	joining    map[int]netcond.Transport
+	spectators *spectators
+	// traffic and round trip of every player connection
+	counters   map[int]*netstats.Counters
+	violations map[string]uint64
+	inputStore *InputStore
+	// chat lines waiting for the host to relay them
+	chat []protocol.ChatMessage
+	// desyncs reported by players waiting for the host to answer them
+	desyncReports []protocol.DesyncReport
 }
 
 var upgrader = websocket.Upgrader{
@@ -31,19 +57,64 @@ var upgrader = websocket.Upgrader{
 	WriteBufferSize: 1024,
 }
 
+// connectionState is what the server remembers about one connection while reading it.
+type connectionState struct {
+	conn         netcond.Transport
+	counters     *netstats.Counters
+	lastSequence uint64
+	chatLimiter  *rateLimiter
+	// a client reports only its first desync
+	desyncReported bool
+}
+
+// lockedTransport lets the host loop and the pongs of the reading goroutine write to one connection,
+// a websocket takes only one writer at a time.
+type lockedTransport struct {
+	netcond.Transport
+	mutex sync.Mutex
+}
+
+func (t *lockedTransport) WriteMessage(messageType int, data []byte) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.Transport.WriteMessage(messageType, data)
+}
+
 type playerConn struct {
 	playerID int
-	conn     *websocket.Conn
+	conn     netcond.Transport
 }
 
-func New(port string, playersCount int) *Server {
-	ch1 := make(chan playerConn)
-	ch2 := make(chan playerConn)
-	ch3 := make(chan playerConn)
+// New starts listening and returns right away, players join whenever they connect.
+// The first hostSlots slots are played on the server machine and can't be claimed.
+// With a non-empty password only clients knowing it can claim a slot.
+// Clients are told to simulate tickRate ticks per second.
+func New(port string, playersCount, hostSlots int, password string, tickRate int, conditions netcond.Config) *Server {
+	ch := make(chan playerConn)
+
+	s := &Server{
+		sessions:   newSessions(password),
+		tickRate:   tickRate,
+		conditions: conditions,
+		conns:      map[int]netcond.Transport{},
+		joining:    map[int]netcond.Transport{},
+		spectators: newSpectators(),
+		counters:   map[int]*netstats.Counters{},
+		violations: map[string]uint64{},
+		inputStore: &InputStore{
+			queues:       map[int][]protocol.InputMessage{},
+			lastInputs:   map[int]protocol.InputMessage{},
+			snapshotAcks: map[int]uint64{},
+		},
+	}
+	go s.acceptConnections(ch)
+	go s.pingPlayers()
+	if conditions.Enabled() {
+		log.Printf("simulating a bad network %+v\n", conditions)
+	}
 
-	http.HandleFunc("/ws1", connectionHandler(playersCount, ch1))
-	http.HandleFunc("/ws2", connectionHandler(playersCount, ch2))
-	http.HandleFunc("/ws3", connectionHandler(playersCount, ch3))
+	http.HandleFunc("/ws", s.connectionHandler(playersCount, hostSlots, ch))
+	http.HandleFunc("/spectate", s.spectateHandler(playersCount))
 	http.HandleFunc("/players_count", playersCountHandler(playersCount))
 
 	go func() {
@@ -52,20 +123,6 @@ func New(port string, playersCount int) *Server {
 		log.Fatal(http.ListenAndServe(addr, nil))
 	}()
 
-	inputConns, thingsUpdateConns, mapUpdateConns := waitForClientConnections(playersCount, ch1, ch2, ch3)
-
-	s := &Server{
-		charInputConns:    inputConns,
-		thingsUpdateConns: thingsUpdateConns,
-		mapUpdateConns:    mapUpdateConns,
-		inputStore:        &InputStore{inputs: map[int]models.Input{}},
-	}
-
-	for playerID, conn := range s.charInputConns {
-		go s.ReceiveUpdates(playerID, conn)
-	}
-	log.Printf("%d clients connected\n", playersCount-1)
-
 	return s
 }
 
@@ -78,17 +135,48 @@ func playersCountHandler(playersCount int) http.HandlerFunc {
 	}
 }
 
-func connectionHandler(playersCount int, ch chan<- playerConn) http.HandlerFunc {
+// connectionHandler is the join handshake: the client names its slot and proves it may take it
+// with the session token of the slot, or with the password when the slot is claimed for the first time.
+func (s *Server) connectionHandler(playersCount, hostSlots int, ch chan<- playerConn) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		playerID, err := strconv.Atoi(r.URL.Query().Get("player_id"))
-		if err != nil || playerID <= 0 || playerID >= playersCount {
-			http.Error(w, fmt.Sprintf("player_id must be from 1 to %d", playersCount-1), http.StatusBadRequest)
+		query := r.URL.Query()
+		if err := protocol.CheckVersion(query.Get(protocol.VERSION_QUERY_PARAM)); err != nil {
+			log.Println(err)
+			http.Error(w, err.Error(), http.StatusUpgradeRequired)
 			return
 		}
 
-		conn, err := upgrader.Upgrade(w, r, nil)
+		playerID, err := strconv.Atoi(query.Get(protocol.PLAYER_ID_QUERY_PARAM))
+		if err != nil || playerID < hostSlots || playerID >= playersCount {
+			http.Error(w, fmt.Sprintf("player_id must be from %d to %d", hostSlots, playersCount-1), http.StatusBadRequest)
+			return
+		}
+
+		token, claimed, status, err := s.sessions.claim(playerID, query.Get(protocol.TOKEN_QUERY_PARAM), query.Get(protocol.PASSWORD_QUERY_PARAM))
+		if err != nil {
+			log.Printf("refused player %d from %s: %s\n", playerID, r.RemoteAddr, err)
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		wsConn, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
 			log.Println(err)
+			if claimed {
+				s.sessions.release(playerID, token)
+			}
+			return
+		}
+		wsConn.SetReadLimit(MAX_MESSAGE_SIZE)
+		conn := &lockedTransport{Transport: netcond.Wrap(wsConn, s.conditions, protocol.Droppable)}
+
+		if err := s.writeWelcome(conn, playersCount, token); err != nil {
+			log.Println(err)
+			conn.Close()
+			// the client never got the token, nobody could take the slot back with it
+			if claimed {
+				s.sessions.release(playerID, token)
+			}
 			return
 		}
 
@@ -96,75 +184,400 @@ func connectionHandler(playersCount int, ch chan<- playerConn) http.HandlerFunc
 	}
 }
 
-func waitForClientConnections(
-	playersCount int,
-	inputCh <-chan playerConn,
-	thingsUpdateCh <-chan playerConn,
-	mapUpdateCh <-chan playerConn,
-) (map[int]*websocket.Conn, map[int]*websocket.Conn, map[int]*websocket.Conn) {
-	remotePlayersCount := playersCount - 1
-	inputConns := make(map[int]*websocket.Conn, remotePlayersCount)
-	thingsUpdateConns := make(map[int]*websocket.Conn, remotePlayersCount)
-	mapUpdateConns := make(map[int]*websocket.Conn, remotePlayersCount)
+// writeWelcome tells a new connection the players count, its session token and the tick rate.
+func (s *Server) writeWelcome(conn netcond.Transport, playersCount int, token string) error {
+	welcome := protocol.ControlMessage{Kind: protocol.CONTROL_WELCOME, Value: uint64(playersCount), Text: token}
+	if err := conn.WriteMessage(websocket.BinaryMessage, protocol.AppendControl(nil, &welcome)); err != nil {
+		return err
+	}
+
+	tickRate := protocol.ControlMessage{Kind: protocol.CONTROL_TICK_RATE, Value: uint64(s.tickRate)}
+	return conn.WriteMessage(websocket.BinaryMessage, protocol.AppendControl(nil, &tickRate))
+}
+
+// acceptConnections puts players into their slots, in the lobby as well as mid-match.
+// A newer connection for a slot replaces the older one.
+func (s *Server) acceptConnections(ch <-chan playerConn) {
+	for pc := range ch {
+		s.inputStore.resetPlayer(pc.playerID)
 
-	for len(inputConns) < remotePlayersCount ||
-		len(thingsUpdateConns) < remotePlayersCount ||
-		len(mapUpdateConns) < remotePlayersCount {
-		select {
-		case pc := <-inputCh:
-			inputConns[pc.playerID] = pc.conn
-		case pc := <-thingsUpdateCh:
-			thingsUpdateConns[pc.playerID] = pc.conn
-		case pc := <-mapUpdateCh:
-			mapUpdateConns[pc.playerID] = pc.conn
+		s.Lock()
+		for _, conns := range []map[int]netcond.Transport{s.conns, s.joining} {
+			if old, ok := conns[pc.playerID]; ok {
+				old.Close()
+				delete(conns, pc.playerID)
+			}
 		}
+		s.joining[pc.playerID] = pc.conn
+		counters := &netstats.Counters{}
+		s.counters[pc.playerID] = counters
+		s.Unlock()
+
+		log.Printf("player %d connected\n", pc.playerID)
+		go s.ReceiveUpdates(pc.playerID, pc.conn, counters)
 	}
+}
+
+// IsConnected tells whether the slot of the player has a live connection.
+func (s *Server) IsConnected(playerID int) bool {
+	s.Lock()
+	defer s.Unlock()
 
-	return inputConns, thingsUpdateConns, mapUpdateConns
+	_, connected := s.conns[playerID]
+	_, joining := s.joining[playerID]
+	return connected || joining
 }
 
-func (s *Server) ReceiveUpdates(playerID int, conn *websocket.Conn) {
+// TakeJoinedPlayers appends the players that connected since the last call to dst.
+// They get no messages before this call, so the caller can send them the current maze first.
+func (s *Server) TakeJoinedPlayers(dst []int) []int {
+	s.Lock()
+	defer s.Unlock()
+
+	for playerID, conn := range s.joining {
+		s.conns[playerID] = conn
+		dst = append(dst, playerID)
+	}
+	clear(s.joining)
+	return dst
+}
+
+// disconnect frees the connection of the player, its tank stands still until it comes back.
+func (s *Server) disconnect(playerID int, conn netcond.Transport) {
+	conn.Close()
+
+	s.Lock()
+	current := false
+	for _, conns := range []map[int]netcond.Transport{s.conns, s.joining} {
+		if conns[playerID] == conn {
+			delete(conns, playerID)
+			current = true
+		}
+	}
+	s.Unlock()
+
+	if current {
+		s.inputStore.resetPlayer(playerID)
+		log.Printf("player %d disconnected, keeping the slot\n", playerID)
+	}
+}
+
+// ReceiveUpdates routes the messages of one client by their type until the connection breaks.
+// Oversized messages close the connection, other violations drop the message
+// and a connection with more than MAX_VIOLATIONS of them is closed.
+func (s *Server) ReceiveUpdates(playerID int, conn netcond.Transport, counters *netstats.Counters) {
+	limiter := newMessageLimiter(s.tickRate)
+	state := connectionState{
+		conn:        conn,
+		counters:    counters,
+		chatLimiter: newRateLimiter(CHAT_MESSAGES_PER_SECOND, CHAT_BURST),
+	}
+	violations := 0
+
 	for {
 		_, rawMessage, err := conn.ReadMessage()
 		if err != nil {
-			log.Println(runtime.Caller(1))
+			if errors.Is(err, websocket.ErrReadLimit) {
+				s.countViolation(VIOLATION_TOO_LARGE)
+			}
 			log.Println(err)
-			log.Fatal()
+			s.disconnect(playerID, conn)
+			return
 		}
+		counters.Received(len(rawMessage))
 
-		var input models.Input
-		if err := json.Unmarshal(rawMessage, &input); err != nil {
+		violation := VIOLATION_RATE
+		if limiter.allow(time.Now()) {
+			violation = s.route(playerID, rawMessage, &state)
+		}
+		if violation == "" {
 			continue
 		}
 
-		s.inputStore.Lock()
-		s.inputStore.inputs[playerID] = input
-		s.inputStore.Unlock()
+		violations++
+		if total := s.countViolation(violation); violations == 1 {
+			log.Printf("player %d: %s, %d on the server so far\n", playerID, violation, total)
+		}
+		if violations > MAX_VIOLATIONS {
+			log.Printf("player %d broke the rules %d times, disconnecting\n", playerID, violations)
+			s.disconnect(playerID, conn)
+			return
+		}
 	}
 }
 
-func (s *Server) GetInput(playerID int) models.Input {
+// route handles one message and returns the violation it is, "" for a good one.
+func (s *Server) route(playerID int, rawMessage []byte, state *connectionState) string {
+	kind, err := protocol.MessageType(rawMessage)
+	if err != nil {
+		return VIOLATION_MALFORMED
+	}
+
+	switch kind {
+	case protocol.MESSAGE_INPUT:
+		return s.receiveInput(playerID, rawMessage, &state.lastSequence)
+	case protocol.MESSAGE_CHAT:
+		return s.receiveChat(playerID, rawMessage, state.chatLimiter)
+	case protocol.MESSAGE_CONTROL:
+		return s.receivePlayerControl(playerID, rawMessage, state)
+	default:
+		return VIOLATION_UNEXPECTED_TYPE
+	}
+}
+
+// receiveInput queues an input, only its buttons reach the simulation.
+// Sequences must grow on every connection so replayed or reordered inputs are dropped.
+func (s *Server) receiveInput(playerID int, rawMessage []byte, lastSequence *uint64) string {
+	var message protocol.InputMessage
+	if err := protocol.DecodeInput(rawMessage, &message); err != nil {
+		return VIOLATION_MALFORMED
+	}
+
+	if message.Sequence <= *lastSequence {
+		// an input overtaken by newer ones on the way is just too late, replaying old ones is not
+		if *lastSequence-message.Sequence < MAX_QUEUED_INPUTS {
+			return ""
+		}
+		return VIOLATION_STALE_INPUT
+	}
+	*lastSequence = message.Sequence
+
 	s.inputStore.Lock()
-	defer s.inputStore.Unlock()
-	return s.inputStore.inputs[playerID]
+	queue := append(s.inputStore.queues[playerID], message)
+	if len(queue) > MAX_QUEUED_INPUTS {
+		queue = queue[len(queue)-MAX_QUEUED_INPUTS:]
+	}
+	s.inputStore.queues[playerID] = queue
+	s.inputStore.snapshotAcks[playerID] = message.SnapshotAck
+	s.inputStore.Unlock()
+
+	return ""
 }
 
-func (s *Server) WriteThingsMessage(message []byte) error {
-	for _, conn := range s.thingsUpdateConns {
-		if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
-			return err
+// receivePlayerControl queues the desync report of a player for the host,
+// other control messages are handled like those of spectators.
+func (s *Server) receivePlayerControl(playerID int, rawMessage []byte, state *connectionState) string {
+	var message protocol.ControlMessage
+	if err := protocol.DecodeControl(rawMessage, &message); err != nil {
+		return VIOLATION_MALFORMED
+	}
+	if message.Kind != protocol.CONTROL_DESYNC {
+		return receiveControl(rawMessage, state.conn, state.counters)
+	}
+
+	if state.desyncReported {
+		return ""
+	}
+	state.desyncReported = true
+
+	s.Lock()
+	if len(s.desyncReports) < MAX_QUEUED_DESYNC_REPORTS {
+		s.desyncReports = append(s.desyncReports, protocol.DesyncReport{PlayerID: playerID, Sequence: message.Value})
+	}
+	s.Unlock()
+
+	return ""
+}
+
+// TakeDesyncReports appends the desyncs reported since the last call to dst.
+func (s *Server) TakeDesyncReports(dst []protocol.DesyncReport) []protocol.DesyncReport {
+	s.Lock()
+	defer s.Unlock()
+
+	dst = append(dst, s.desyncReports...)
+	s.desyncReports = s.desyncReports[:0]
+	return dst
+}
+
+// receiveControl answers pings and takes the round trip from pongs.
+func receiveControl(rawMessage []byte, conn netcond.Transport, counters *netstats.Counters) string {
+	var message protocol.ControlMessage
+	if err := protocol.DecodeControl(rawMessage, &message); err != nil {
+		return VIOLATION_MALFORMED
+	}
+
+	switch message.Kind {
+	case protocol.CONTROL_PING:
+		pong := protocol.AppendControl(nil, &protocol.ControlMessage{Kind: protocol.CONTROL_PONG, Value: message.Value})
+		if err := conn.WriteMessage(websocket.BinaryMessage, pong); err != nil {
+			// the reading side notices the broken connection
+			return ""
 		}
+		counters.Sent(len(pong))
+	case protocol.CONTROL_PONG:
+		counters.AddPong(message.Value)
+	default:
+		return VIOLATION_UNEXPECTED_TYPE
 	}
 
-	return nil
+	return ""
 }
 
-func (s *Server) WriteMapMessage(message []byte) error {
-	for _, conn := range s.mapUpdateConns {
-		if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
-			return err
+// pingPlayers pings every connected player each netstats.PING_INTERVAL.
+func (s *Server) pingPlayers() {
+	ticker := time.NewTicker(netstats.PING_INTERVAL)
+	defer ticker.Stop()
+
+	var playerIDs []int
+	for range ticker.C {
+		s.Lock()
+		playerIDs = playerIDs[:0]
+		for playerID := range s.conns {
+			playerIDs = append(playerIDs, playerID)
+		}
+		s.Unlock()
+
+		for _, playerID := range playerIDs {
+			ping := protocol.AppendControl(nil, &protocol.ControlMessage{Kind: protocol.CONTROL_PING, Value: netstats.Stamp()})
+			if err := s.WriteMessage(playerID, ping); err != nil {
+				log.Println(err)
+			}
 		}
 	}
+}
+
+// PlayerStats describes the connection of the player, the zero value when it never connected.
+func (s *Server) PlayerStats(playerID int) netstats.Stats {
+	s.Lock()
+	counters, ok := s.counters[playerID]
+	s.Unlock()
+	if !ok {
+		return netstats.Stats{}
+	}
+
+	return counters.Stats()
+}
+
+// receiveChat queues a chat line for the host to relay, signed with the slot of the connection.
+// Lines are cleaned of control characters and empty ones are dropped.
+func (s *Server) receiveChat(playerID int, rawMessage []byte, limiter *rateLimiter) string {
+	var message protocol.ChatMessage
+	if err := protocol.DecodeChat(rawMessage, &message); err != nil {
+		return VIOLATION_MALFORMED
+	}
+
+	if !limiter.allow(time.Now()) {
+		return VIOLATION_CHAT_RATE
+	}
+
+	message.Sender = playerID
+	message.Text = protocol.CleanChatText(message.Text)
+	if message.Text == "" {
+		return ""
+	}
+
+	s.Lock()
+	if len(s.chat) < MAX_QUEUED_CHAT {
+		s.chat = append(s.chat, message)
+	}
+	s.Unlock()
+
+	return ""
+}
+
+// TakeChat appends the chat lines received since the last call to dst.
+func (s *Server) TakeChat(dst []protocol.ChatMessage) []protocol.ChatMessage {
+	s.Lock()
+	defer s.Unlock()
+
+	dst = append(dst, s.chat...)
+	s.chat = s.chat[:0]
+	return dst
+}
+
+// countViolation adds the violation to the server totals and returns its total.
+func (s *Server) countViolation(violation string) uint64 {
+	s.Lock()
+	defer s.Unlock()
+
+	s.violations[violation]++
+	return s.violations[violation]
+}
+
+// Violations returns how many times each rule was broken since the server started.
+func (s *Server) Violations() map[string]uint64 {
+	s.Lock()
+	defer s.Unlock()
+
+	violations := make(map[string]uint64, len(s.violations))
+	for violation, count := range s.violations {
+		violations[violation] = count
+	}
+	return violations
+}
+
+// resetPlayer drops the queued inputs and releases all buttons but keeps the last sequence,
+// the snapshot ack is cleared so the next snapshot is a full one.
+func (store *InputStore) resetPlayer(playerID int) {
+	store.Lock()
+	defer store.Unlock()
+
+	delete(store.queues, playerID)
+	last := store.lastInputs[playerID]
+	last.Input = models.Input{}
+	store.lastInputs[playerID] = last
+	store.snapshotAcks[playerID] = 0
+}
+
+// GetInput takes the next queued input of the player together with its sequence.
+// When nothing new arrived the last input is repeated with the same sequence.
+func (s *Server) GetInput(playerID int) (models.Input, uint64) {
+	s.inputStore.Lock()
+	defer s.inputStore.Unlock()
+
+	if queue := s.inputStore.queues[playerID]; len(queue) > 0 {
+		s.inputStore.lastInputs[playerID] = queue[0]
+		s.inputStore.queues[playerID] = queue[1:]
+	}
+
+	last := s.inputStore.lastInputs[playerID]
+	return last.Input, last.Sequence
+}
+
+// GetSnapshotAck returns the sequence of the last snapshot the player decoded, 0 if none.
+func (s *Server) GetSnapshotAck(playerID int) uint64 {
+	s.inputStore.Lock()
+	defer s.inputStore.Unlock()
+	return s.inputStore.snapshotAcks[playerID]
+}
+
+// WriteMessage sends message to the player if it is connected,
+// a failed write disconnects the player and is returned.
+func (s *Server) WriteMessage(playerID int, message []byte) error {
+	s.Lock()
+	conn, ok := s.conns[playerID]
+	counters := s.counters[playerID]
+	s.Unlock()
+	if !ok {
+		return nil
+	}
+
+	if err := conn.WriteMessage(websocket.BinaryMessage, message); err != nil {
+		s.disconnect(playerID, conn)
+		return err
+	}
+	counters.Sent(len(message))
 
 	return nil
 }
+
+// BroadcastMessage sends message to every connected player and spectator and returns the first failure.
+func (s *Server) BroadcastMessage(message []byte) error {
+	spectatorsErr := s.BroadcastToSpectators(message)
+
+	s.Lock()
+	playerIDs := make([]int, 0, len(s.conns))
+	for playerID := range s.conns {
+		playerIDs = append(playerIDs, playerID)
+	}
+	s.Unlock()
+
+	firstErr := spectatorsErr
+	for _, playerID := range playerIDs {
+		if err := s.WriteMessage(playerID, message); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
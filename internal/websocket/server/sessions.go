@@ -0,0 +1,80 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+const TOKEN_BYTES = 16
+
+// sessions remembers the token issued for every claimed slot,
+// only the holder of the token may connect to the slot again.
+type sessions struct {
+	sync.Mutex
+	password string
+	tokens   map[int]string
+}
+
+func newSessions(password string) *sessions {
+	return &sessions{password: password, tokens: map[int]string{}}
+}
+
+// claim checks the credentials for the slot and returns its token, issuing one on the first claim.
+// When it fails the HTTP status and the explanation for the client are returned.
+func (sessions *sessions) claim(playerID int, token, password string) (string, bool, int, error) {
+	sessions.Lock()
+	defer sessions.Unlock()
+
+	if slotToken, ok := sessions.tokens[playerID]; ok {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(slotToken)) != 1 {
+			return "", false, http.StatusConflict, fmt.Errorf("player slot %d is taken, only its owner can connect to it again", playerID)
+		}
+
+		return slotToken, false, 0, nil
+	}
+
+	// a token of a slot nobody claimed is left from a restarted server, the slot is claimed anew
+	if err := sessions.checkPassword(password); err != nil {
+		return "", false, http.StatusUnauthorized, err
+	}
+
+	newToken, err := generateToken()
+	if err != nil {
+		return "", false, http.StatusInternalServerError, err
+	}
+	sessions.tokens[playerID] = newToken
+
+	return newToken, true, 0, nil
+}
+
+// checkPassword lets in clients knowing the server password, everybody when there is none.
+func (sessions *sessions) checkPassword(password string) error {
+	if subtle.ConstantTimeCompare([]byte(password), []byte(sessions.password)) != 1 {
+		return fmt.Errorf("wrong password")
+	}
+
+	return nil
+}
+
+// release frees a slot claimed by a connection that never got established.
+func (sessions *sessions) release(playerID int, token string) {
+	sessions.Lock()
+	defer sessions.Unlock()
+
+	if sessions.tokens[playerID] == token {
+		delete(sessions.tokens, playerID)
+	}
+}
+
+func generateToken() (string, error) {
+	token := make([]byte, TOKEN_BYTES)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(token), nil
+}
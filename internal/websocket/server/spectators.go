@@ -0,0 +1,190 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"myebiten/internal/netcond"
+	"myebiten/internal/netstats"
+	"myebiten/internal/protocol"
+
+	"github.com/gorilla/websocket"
+)
+
+// spectators are connections that watch the match, they get the maze and snapshots but play no slot.
+// Like players they wait in joining until the host sent them the current maze.
+type spectators struct {
+	sync.Mutex
+	conns   map[int]netcond.Transport
+	joining map[int]netcond.Transport
+	nextID  int
+}
+
+func newSpectators() *spectators {
+	return &spectators{
+		conns:   map[int]netcond.Transport{},
+		joining: map[int]netcond.Transport{},
+	}
+}
+
+// spectateHandler lets anybody knowing the password watch, there is no limit on spectators.
+func (s *Server) spectateHandler(playersCount int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if err := protocol.CheckVersion(query.Get(protocol.VERSION_QUERY_PARAM)); err != nil {
+			log.Println(err)
+			http.Error(w, err.Error(), http.StatusUpgradeRequired)
+			return
+		}
+
+		if err := s.sessions.checkPassword(query.Get(protocol.PASSWORD_QUERY_PARAM)); err != nil {
+			log.Printf("refused spectator from %s: %s\n", r.RemoteAddr, err)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		wsConn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		wsConn.SetReadLimit(MAX_MESSAGE_SIZE)
+		conn := &lockedTransport{Transport: netcond.Wrap(wsConn, s.conditions, protocol.Droppable)}
+
+		if err := s.writeWelcome(conn, playersCount, ""); err != nil {
+			log.Println(err)
+			conn.Close()
+			return
+		}
+
+		spectators := s.spectators
+		spectators.Lock()
+		spectatorID := spectators.nextID
+		spectators.nextID++
+		spectators.joining[spectatorID] = conn
+		count := len(spectators.conns) + len(spectators.joining)
+		spectators.Unlock()
+
+		log.Printf("spectator %d connected, %d watching\n", spectatorID, count)
+		go s.receiveFromSpectator(spectatorID, conn)
+	}
+}
+
+// receiveFromSpectator answers the pings of a spectator until the connection breaks,
+// spectators have nothing else to say.
+func (s *Server) receiveFromSpectator(spectatorID int, conn netcond.Transport) {
+	limiter := newMessageLimiter(s.tickRate)
+	counters := &netstats.Counters{}
+	violations := 0
+
+	for {
+		_, rawMessage, err := conn.ReadMessage()
+		if err != nil {
+			if errors.Is(err, websocket.ErrReadLimit) {
+				s.countViolation(VIOLATION_TOO_LARGE)
+			}
+			s.disconnectSpectator(spectatorID, conn)
+			return
+		}
+
+		violation := VIOLATION_RATE
+		if limiter.allow(time.Now()) {
+			violation = VIOLATION_UNEXPECTED_TYPE
+			if kind, err := protocol.MessageType(rawMessage); err == nil && kind == protocol.MESSAGE_CONTROL {
+				violation = receiveControl(rawMessage, conn, counters)
+			}
+		}
+		if violation == "" {
+			continue
+		}
+
+		violations++
+		s.countViolation(violation)
+		if violations > MAX_VIOLATIONS {
+			log.Printf("spectator %d broke the rules %d times, disconnecting\n", spectatorID, violations)
+			s.disconnectSpectator(spectatorID, conn)
+			return
+		}
+	}
+}
+
+func (s *Server) disconnectSpectator(spectatorID int, conn netcond.Transport) {
+	conn.Close()
+
+	spectators := s.spectators
+	spectators.Lock()
+	current := false
+	for _, conns := range []map[int]netcond.Transport{spectators.conns, spectators.joining} {
+		if conns[spectatorID] == conn {
+			delete(conns, spectatorID)
+			current = true
+		}
+	}
+	count := len(spectators.conns) + len(spectators.joining)
+	spectators.Unlock()
+
+	if current {
+		log.Printf("spectator %d disconnected, %d watching\n", spectatorID, count)
+	}
+}
+
+// SpectatorsCount tells how many spectators are connected.
+func (s *Server) SpectatorsCount() int {
+	s.spectators.Lock()
+	defer s.spectators.Unlock()
+	return len(s.spectators.conns) + len(s.spectators.joining)
+}
+
+// TakeJoinedSpectators appends the spectators that connected since the last call to dst,
+// see TakeJoinedPlayers.
+func (s *Server) TakeJoinedSpectators(dst []int) []int {
+	s.spectators.Lock()
+	defer s.spectators.Unlock()
+
+	for spectatorID, conn := range s.spectators.joining {
+		s.spectators.conns[spectatorID] = conn
+		dst = append(dst, spectatorID)
+	}
+	clear(s.spectators.joining)
+	return dst
+}
+
+// WriteSpectatorMessage sends message to the spectator if it is still watching,
+// a failed write disconnects the spectator and is returned.
+func (s *Server) WriteSpectatorMessage(spectatorID int, message []byte) error {
+	s.spectators.Lock()
+	conn, ok := s.spectators.conns[spectatorID]
+	s.spectators.Unlock()
+	if !ok {
+		return nil
+	}
+
+	if err := conn.WriteMessage(websocket.BinaryMessage, message); err != nil {
+		s.disconnectSpectator(spectatorID, conn)
+		return err
+	}
+
+	return nil
+}
+
+// BroadcastToSpectators sends message to every spectator and returns the first failure.
+func (s *Server) BroadcastToSpectators(message []byte) error {
+	s.spectators.Lock()
+	spectatorIDs := make([]int, 0, len(s.spectators.conns))
+	for spectatorID := range s.spectators.conns {
+		spectatorIDs = append(spectatorIDs, spectatorID)
+	}
+	s.spectators.Unlock()
+
+	var firstErr error
+	for _, spectatorID := range spectatorIDs {
+		if err := s.WriteSpectatorMessage(spectatorID, message); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}